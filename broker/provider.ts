@@ -56,6 +56,25 @@ export function registerProviderRoutes(app: express.Application, db: Db) {
     }
   );
 
+  app.get(
+    "/offers",
+    jwtMiddleware,
+    async function (req: ExpressJwtRequest, res: Response) {
+      const providerCredentials = req.auth as Provider;
+
+      // Find the offers of the cluster corresponding to the credentials, left out of the catalog
+      const offers = await db
+        .collection("offers")
+        .find<Offer>(
+          { clusterID: providerCredentials.clusterID },
+          { projection: { _id: 0, clusterID: 0 } }
+        )
+        .toArray();
+
+      res.json(offers);
+    }
+  );
+
   app.post(
     "/offer/:id",
     jwtMiddleware,
@@ -1,4 +1,5 @@
 import { Contract, Mappers, Offer, Provider } from 'src/models';
+import { OfferAction } from 'src/models/offer';
 import Broker from '../models/broker';
 
 
@@ -131,6 +132,29 @@ const createOrUpdateMyOffer = async (
   }
 };
 
+const transitionMessages = {
+  publish: 'Offer published',
+  suspend: 'Offer suspended',
+  retire: 'Offer retired',
+};
+
+const transitionMyOffer = async (
+  offerID: string,
+  action: OfferAction,
+  handleMessage: (string) => void
+) => {
+  const response = await fetch(`${api}/offers/${offerID}/${action}`, {
+    method: 'POST',
+  });
+  const data = await response.json();
+  if (response.ok) {
+    handleMessage(transitionMessages[action]);
+    return data;
+  } else {
+    throw new Error(data.message);
+  }
+};
+
 // seems OK
 const deleteMyOffer = async (
   offerID: string,
@@ -353,6 +377,7 @@ export const API = {
   subscribeUnsubscribeBroker,
   getMyOffers,
   createMyOffer: createOrUpdateMyOffer,
+  transitionMyOffer,
   //updateMyOffer,
   deleteMyOffer,
   peerWithCluster,
@@ -50,7 +50,7 @@ const applyFilters = (offers: Offer[], filters: Filters): Offer[] => {
     if (
       (filters.offerType && offer.offerType !== filters.offerType) ||
       (filters.availability && offer.availability !== filters.availability) ||
-      (filters.status && String(offer.status) !== filters.status)
+      (filters.status && offer.status !== filters.status)
     ) {
       matches = false;
     }
@@ -122,12 +122,24 @@ const MyCatalogTable: FC<CatalogTableProps> = props => {
       name: 'All',
     },
     {
-      id: 'enabled',
-      name: 'Enabled',
+      id: 'draft',
+      name: 'Draft',
     },
     {
-      id: 'disabled',
-      name: 'Disabled',
+      id: 'published',
+      name: 'Published',
+    },
+    {
+      id: 'suspended',
+      name: 'Suspended',
+    },
+    {
+      id: 'sold-out',
+      name: 'Sold out',
+    },
+    {
+      id: 'retired',
+      name: 'Retired',
     },
   ];
 
@@ -32,7 +32,12 @@ import { API } from 'src/api/Api';
 import Label from 'src/components/Label';
 import { DataContext } from 'src/contexts/DataContext';
 import { SessionContext } from 'src/contexts/SessionContext';
-import { Offer, OfferAvailability, OfferType } from 'src/models/offer';
+import {
+  Offer,
+  OfferAvailability,
+  OfferStatus,
+  OfferType,
+} from 'src/models/offer';
 
 interface IMyCatalogTableRowProps {
   offer: Offer;
@@ -62,19 +67,31 @@ const getAvailabilityLabel = (availability: OfferAvailability): JSX.Element => {
   return <Label color={color}>{text}</Label>;
 };
 
-const getStatusLabel = (status: boolean): JSX.Element => {
+const getStatusLabel = (status: OfferStatus): JSX.Element => {
   const map = {
-    false: {
-      text: 'Disabled',
-      color: 'error',
+    draft: {
+      text: 'Draft',
+      color: 'secondary',
     },
-    true: {
-      text: 'Enabled',
+    published: {
+      text: 'Published',
       color: 'success',
     },
+    suspended: {
+      text: 'Suspended',
+      color: 'warning',
+    },
+    'sold-out': {
+      text: 'Sold out',
+      color: 'error',
+    },
+    retired: {
+      text: 'Retired',
+      color: 'error',
+    },
   };
 
-  const { text, color }: any = map[String(status)];
+  const { text, color }: any = map[status];
 
   return <Label color={color}>{text}</Label>;
 };
@@ -3,7 +3,13 @@ import { FC, useContext, useEffect, useState } from 'react';
 import { API } from 'src/api/Api';
 import { DataContext } from 'src/contexts/DataContext';
 import { SessionContext } from 'src/contexts/SessionContext';
-import { Offer, OfferPlan, OfferType } from 'src/models/offer';
+import {
+  Offer,
+  OfferAction,
+  OfferPlan,
+  OfferStatus,
+  OfferType,
+} from 'src/models/offer';
 import { calculateAvailability } from 'src/utils';
 import { v4 as uuidv4 } from 'uuid';
 import MyPlans from './MyPlans';
@@ -27,7 +33,7 @@ const MyOfferWrapper: FC<IMyOfferWrapperProps> = props => {
   const [offerID, setOfferID] = useState(create ? offerUUID : offer.offerID);
   const [offerName, setOfferName] = useState('test');
   const [offerType, setOfferType] = useState<OfferType>('computational');
-  const [offerStatus, setOfferStatus] = useState<boolean>(false);
+  const [offerStatus, setOfferStatus] = useState<OfferStatus>('draft');
   const [description, setDescription] = useState('test');
   const [offerPlans, setOfferPlans] = useState<OfferPlan[]>([]);
   const [edit, setEdit] = useState(false);
@@ -38,7 +44,6 @@ const MyOfferWrapper: FC<IMyOfferWrapperProps> = props => {
     !create &&
     (offerName !== offer.offerName ||
       offerType !== offer.offerType ||
-      offerStatus !== offer.status ||
       description !== offer.description ||
       offerPlans !== offer.plans);
 
@@ -56,7 +61,8 @@ const MyOfferWrapper: FC<IMyOfferWrapperProps> = props => {
         description,
         plans: offerPlans,
         created: new Date().getTime(),
-        status: offerStatus,
+        // an update fails if the offer has been changed since it was read
+        revision: create ? 0 : props.offer.revision,
         clusterID: clusterParameters.clusterID,
         clusterName: clusterParameters.clusterName,
         clusterPrettyName: clusterPrettyName,
@@ -80,6 +86,18 @@ const MyOfferWrapper: FC<IMyOfferWrapperProps> = props => {
     }
   };
 
+  // the status only changes through the transition API: new offers start as drafts
+  const changeOfferStatus = async (action: OfferAction) => {
+    try {
+      const result = await API.transitionMyOffer(offerID, action, setMessage);
+      if (result) {
+        setDirty();
+      }
+    } catch (error) {
+      setSystemError(error);
+    }
+  };
+
   useEffect(() => {
     if (!create) {
       setOfferID(offer.offerID);
@@ -104,7 +122,7 @@ const MyOfferWrapper: FC<IMyOfferWrapperProps> = props => {
     create,
     setOfferName,
     setOfferType,
-    setOfferStatus,
+    changeOfferStatus,
     setDescription,
     setEdit,
     clusterPrettyName: create ? clusterPrettyName : offer.clusterPrettyName,
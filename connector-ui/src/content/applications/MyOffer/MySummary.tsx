@@ -13,7 +13,6 @@ import {
   IconButton,
   MenuItem,
   Select,
-  Switch,
   TextField,
   Tooltip,
   Typography,
@@ -22,13 +21,18 @@ import {
 
 import { Dispatch, FC, SetStateAction, useState } from 'react';
 import Label from 'src/components/Label';
-import { OfferAvailability, OfferType } from 'src/models/offer';
+import {
+  OfferAction,
+  OfferAvailability,
+  OfferStatus,
+  OfferType,
+} from 'src/models/offer';
 
 interface MySummaryProps {
   offerID: string;
   offerName: string;
   offerType: OfferType;
-  offerStatus: boolean;
+  offerStatus: OfferStatus;
   description: string;
   availability: OfferAvailability;
   clusterPrettyName: string;
@@ -36,7 +40,7 @@ interface MySummaryProps {
   edit: boolean;
   setOfferName: Dispatch<SetStateAction<string>>;
   setOfferType: Dispatch<SetStateAction<OfferType>>;
-  setOfferStatus: Dispatch<SetStateAction<boolean>>;
+  changeOfferStatus: (action: OfferAction) => void;
   setDescription: Dispatch<SetStateAction<string>>;
   setEdit: Dispatch<SetStateAction<boolean>>;
   publishOrUpdateOffer: () => void;
@@ -72,7 +76,7 @@ const MySummary: FC<MySummaryProps> = props => {
     create,
     setDescription,
     setOfferName,
-    setOfferStatus,
+    changeOfferStatus,
     setOfferType,
     setEdit,
     publishOrUpdateOffer,
@@ -132,10 +136,40 @@ const MySummary: FC<MySummaryProps> = props => {
     );
   };
 
-  const handleOfferStatus = event => {
-    setOfferStatus(event.target.checked);
+  const getStatusLabel = (offerStatus: OfferStatus): JSX.Element => {
+    const map = {
+      draft: {
+        text: 'Draft',
+        color: 'secondary',
+      },
+      published: {
+        text: 'Published',
+        color: 'success',
+      },
+      suspended: {
+        text: 'Suspended',
+        color: 'warning',
+      },
+      'sold-out': {
+        text: 'Sold out',
+        color: 'error',
+      },
+      retired: {
+        text: 'Retired',
+        color: 'error',
+      },
+    };
+
+    const { text, color }: any = map[offerStatus];
+
+    return <Label color={color}>{text}</Label>;
   };
 
+  // drafts and suspended offers can be published, published and sold out ones suspended
+  const statusAction: OfferAction = ['draft', 'suspended'].includes(offerStatus)
+    ? 'publish'
+    : 'suspend';
+
   return (
     <>
       <Dialog onClose={() => setShowID(false)} open={showID}>
@@ -308,25 +342,17 @@ const MySummary: FC<MySummaryProps> = props => {
                     alignItems: 'center',
                   }}
                 >
-                  <Typography
-                    variant="h2"
-                    sx={{
-                      color: offerStatus
-                        ? theme.colors.success.main
-                        : theme.colors.error.main,
-                    }}
-                    //color={offerStatus ? 'success' : 'error'}
-                  >
-                    {offerStatus ? 'Enabled' : 'Disabled'}
-                  </Typography>
-
-                  <Switch
-                    disabled={!edit}
-                    edge="end"
-                    color="primary"
-                    onChange={handleOfferStatus}
-                    checked={offerStatus}
-                  />
+                  <Box sx={{ mr: 2 }}>{getStatusLabel(offerStatus)}</Box>
+                  {/* a new offer is stored as a draft, and published once it has been saved */}
+                  {!create && offerStatus !== 'retired' && (
+                    <Button
+                      variant="outlined"
+                      color={statusAction === 'publish' ? 'success' : 'warning'}
+                      onClick={() => changeOfferStatus(statusAction)}
+                    >
+                      {statusAction === 'publish' ? 'Publish' : 'Suspend'}
+                    </Button>
+                  )}
                 </Grid>
                 <Grid sm item>
                   {!edit ? (
@@ -66,6 +66,7 @@ const mapJSONToOffer = (json: any): Offer => {
     status: json.status,
     description: json.description,
     created: json.created,
+    revision: json.revision,
     plans: json.plans.map(mapJSONToOfferPlan),
   };
 };
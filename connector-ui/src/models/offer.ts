@@ -1,6 +1,15 @@
 import { Provider } from './provider';
 
-export type OfferStatus = 'enabled' | 'disabled';
+// lifecycle of an offer: only published offers are sent to the brokers
+export type OfferStatus =
+  | 'draft'
+  | 'published'
+  | 'suspended'
+  | 'sold-out'
+  | 'retired';
+
+// transitions requested through POST /api/offers/{id}/{action}
+export type OfferAction = 'publish' | 'suspend' | 'retire';
 
 export enum OfferAvailability {
   available = 'available',
@@ -63,7 +72,7 @@ export type Offer = {
   offerName: string;
   offerType: OfferType;
   description: string;
-  status: boolean;
+  status: OfferStatus;
   availability?: OfferAvailability;
   plans: OfferPlan[];
   clusterID?: string;
@@ -73,4 +82,6 @@ export type Offer = {
   endpoint?: string;
   token?: string;
   created: number;
+  // revision read from the connector, sent back on update to detect concurrent edits
+  revision?: number;
 };
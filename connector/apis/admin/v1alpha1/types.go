@@ -0,0 +1,58 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// ArchiveVersion is the version of the Archive format produced by GET /api/admin/backup.
+const ArchiveVersion = 1
+
+const (
+	// SecretsEncrypted marks an archive whose tokens are encrypted with the keys of the encryption Secret.
+	SecretsEncrypted = "encrypted"
+	// SecretsRedacted marks an archive whose tokens have been removed, since encryption is not enabled.
+	SecretsRedacted = "redacted"
+)
+
+// Archive is a full snapshot of the connector state.
+type Archive struct {
+	Version       int                                  `json:"version"`
+	SchemaVersion int                                  `json:"schemaVersion"`
+	ClusterID     string                               `json:"clusterID"`
+	Created       int64                                `json:"created"`
+	Secrets       string                               `json:"secrets,omitempty"` // how the tokens are written, empty for plaintext
+	Info          *connectorv1alpha1.ConnectorInfo     `json:"info,omitempty"`
+	Brokers       []brokerv1alpha1.BrokerDocument      `json:"brokers"`
+	Offers        []catalogv1alpha1.Offer              `json:"offers"`
+	Contracts     []contractsv1alpha1.ContractDocument `json:"contracts"`
+}
+
+// RestoreResult summarizes what has been imported by POST /api/admin/restore.
+type RestoreResult struct {
+	Brokers   int `json:"brokers"`
+	Offers    int `json:"offers"`
+	Contracts int `json:"contracts"`
+}
+
+// ReencryptResult summarizes what has been rewritten by POST /api/admin/reencrypt.
+type ReencryptResult struct {
+	PrimaryKey string `json:"primaryKey"`
+	Documents  int    `json:"documents"`
+}
@@ -0,0 +1,185 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// BrokerClient calls the REST API of a broker on behalf of the local cluster. Every call is bound to ctx,
+// and fails with a BrokerError if the broker answers with an unexpected status code.
+type BrokerClient interface {
+	// GetCatalog returns the catalogs of every cluster listed by the broker.
+	GetCatalog(ctx context.Context) ([]catalogv1alpha1.Catalog, error)
+	// ListOffers returns the offers the broker lists for the local cluster, which GetCatalog leaves out.
+	ListOffers(ctx context.Context) ([]catalogv1alpha1.Offer, error)
+	PostOffer(ctx context.Context, offer catalogv1alpha1.Offer) error
+	BulkPostOffer(ctx context.Context, offers []catalogv1alpha1.Offer) error
+	DeleteOffer(ctx context.Context, offerID string) error
+	// DeleteAllOffers withdraws every offer of the local cluster from the broker.
+	DeleteAllOffers(ctx context.Context) error
+}
+
+// TokenRefresher obtains a new token for the broker, after the broker has rejected the given one.
+type TokenRefresher func(ctx context.Context, brokerID, rejected string) (string, error)
+
+// NewClient returns the client of the broker, authenticated with its token, which sends the requests with client,
+// or with a client shared by the brokers if it is nil. If refresh is not nil, a request rejected as unauthorized
+// is sent once more with the token it returns.
+func NewClient(broker *BrokerDocument, client *http.Client, refresh TokenRefresher) BrokerClient {
+	if client == nil {
+		client = httpClient
+	}
+	return &brokerClient{
+		id:      broker.ID,
+		path:    broker.Path,
+		token:   broker.JWTToken,
+		enabled: broker.Enabled,
+		refresh: refresh,
+		client:  client,
+	}
+}
+
+type brokerClient struct {
+	id      string
+	path    string
+	token   string
+	enabled bool
+	refresh TokenRefresher
+	client  *http.Client
+}
+
+func (c *brokerClient) GetCatalog(ctx context.Context) ([]catalogv1alpha1.Catalog, error) {
+	if !c.enabled {
+		return []catalogv1alpha1.Catalog{}, nil
+	}
+	var catalogs []catalogv1alpha1.Catalog
+	if err := c.do(ctx, "GET", "/catalog", nil, &catalogs); err != nil {
+		return nil, err
+	}
+	return catalogs, nil
+}
+
+func (c *brokerClient) ListOffers(ctx context.Context) ([]catalogv1alpha1.Offer, error) {
+	if !c.enabled {
+		return nil, ErrNotEnabled
+	}
+	var offers []catalogv1alpha1.Offer
+	if err := c.do(ctx, "GET", "/offers", nil, &offers); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+func (c *brokerClient) PostOffer(ctx context.Context, offer catalogv1alpha1.Offer) error {
+	if !c.enabled {
+		return ErrNotEnabled
+	}
+	return c.do(ctx, "POST", "/offer/"+url.PathEscape(offer.OfferID), offer, nil)
+}
+
+func (c *brokerClient) BulkPostOffer(ctx context.Context, offers []catalogv1alpha1.Offer) error {
+	if !c.enabled {
+		return ErrNotEnabled
+	}
+	if len(offers) == 0 {
+		return nil
+	}
+	return c.do(ctx, "POST", "/offers", offers, nil)
+}
+
+func (c *brokerClient) DeleteOffer(ctx context.Context, offerID string) error {
+	if !c.enabled {
+		return ErrNotEnabled
+	}
+	return c.do(ctx, "DELETE", "/offer/"+url.PathEscape(offerID), nil, nil)
+}
+
+func (c *brokerClient) DeleteAllOffers(ctx context.Context) error {
+	if !c.enabled {
+		return ErrNotEnabled
+	}
+	log.Print("\tSending clearing request")
+	if err := c.do(ctx, "DELETE", "/cluster", nil, nil); err != nil {
+		log.Printf("\tError sending clearing request: %s", err)
+		return err
+	}
+	return nil
+}
+
+// do sends the request, with body encoded as JSON if not nil, and decodes the response into out if not nil
+func (c *brokerClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	res, err := c.send(ctx, method, path, encoded)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusUnauthorized && c.refresh != nil {
+		// the token has expired or the broker has rotated its keys
+		res.Body.Close()
+		token, err := c.refresh(ctx, c.id, c.token)
+		if err != nil {
+			return fmt.Errorf("%w: re-authentication failed: %s", ErrUnauthorized, err)
+		}
+		c.token = token
+		if res, err = c.send(ctx, method, path, encoded); err != nil {
+			return err
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return responseError(res)
+	}
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return fmt.Errorf("parsing response: %w", err)
+		}
+	}
+	// the connection is reused only once the body has been read
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+func (c *brokerClient) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.path+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return c.client.Do(req)
+}
@@ -0,0 +1,227 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// bodyTracker counts the response bodies opened and closed by the client
+type bodyTracker struct {
+	mu     sync.Mutex
+	opened int
+	closed int
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	tracker *bodyTracker
+}
+
+func (b *trackedBody) Close() error {
+	b.tracker.mu.Lock()
+	b.tracker.closed++
+	b.tracker.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+func (t *bodyTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.opened++
+	t.mu.Unlock()
+	res.Body = &trackedBody{ReadCloser: res.Body, tracker: t}
+	return res, nil
+}
+
+func (t *bodyTracker) check(tb testing.TB) {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.opened == 0 || t.closed != t.opened {
+		tb.Errorf("%d of %d response bodies closed", t.closed, t.opened)
+	}
+}
+
+// testClient returns a client of a broker answering every request with handler, and the tracker of its response bodies
+func testClient(t *testing.T, handler http.HandlerFunc, refresh TokenRefresher) (BrokerClient, *bodyTracker) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	tracker := &bodyTracker{}
+	broker := &BrokerDocument{ID: "b1", Path: server.URL, JWTToken: "old", Enabled: true}
+	return NewClient(broker, &http.Client{Transport: tracker}, refresh), tracker
+}
+
+func TestBrokerClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error // nil for a status without a typed error
+		message string
+	}{
+		{name: "unauthorized", status: 401, body: `{"error":"invalid token"}`, wantErr: ErrUnauthorized, message: "invalid token"},
+		{name: "forbidden", status: 403, body: `{"message":"not subscribed"}`, wantErr: ErrUnauthorized, message: "not subscribed"},
+		{name: "not found", status: 404, body: `{"error":{"offer":"o1"}}`, wantErr: ErrNotFound, message: `{"offer":"o1"}`},
+		{name: "conflict", status: 409, body: `{"error":"duplicate offer"}`, wantErr: ErrConflict, message: "duplicate offer"},
+		{name: "server error", status: 500, body: "database down\n", wantErr: ErrServerError, message: "database down"},
+		{name: "bad gateway", status: 502, body: "", wantErr: ErrServerError},
+		{name: "bad request", status: 400, body: `{"error":"invalid offer"}`, message: "invalid offer"},
+	}
+	calls := []struct {
+		name string
+		call func(ctx context.Context, c BrokerClient) error
+	}{
+		{name: "GetCatalog", call: func(ctx context.Context, c BrokerClient) error { _, err := c.GetCatalog(ctx); return err }},
+		{name: "ListOffers", call: func(ctx context.Context, c BrokerClient) error { _, err := c.ListOffers(ctx); return err }},
+		{name: "PostOffer", call: func(ctx context.Context, c BrokerClient) error {
+			return c.PostOffer(ctx, catalogv1alpha1.Offer{OfferID: "o1"})
+		}},
+		{name: "DeleteAllOffers", call: func(ctx context.Context, c BrokerClient) error { return c.DeleteAllOffers(ctx) }},
+	}
+	for _, tt := range tests {
+		for _, call := range calls {
+			t.Run(tt.name+"/"+call.name, func(t *testing.T) {
+				client, tracker := testClient(t, func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				}, nil)
+				err := call.call(context.Background(), client)
+				var brokerErr *BrokerError
+				if !errors.As(err, &brokerErr) {
+					t.Fatalf("error = %v, want a BrokerError", err)
+				}
+				if brokerErr.StatusCode != tt.status || brokerErr.Message != tt.message {
+					t.Errorf("error = %+v, want status %d and message %q", brokerErr, tt.status, tt.message)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+				for _, other := range []error{ErrUnauthorized, ErrNotFound, ErrConflict, ErrServerError} {
+					if other != tt.wantErr && errors.Is(err, other) {
+						t.Errorf("error = %v, which is also %v", err, other)
+					}
+				}
+				tracker.check(t)
+			})
+		}
+	}
+}
+
+func TestBrokerClientSuccess(t *testing.T) {
+	client, tracker := testClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer old" {
+			w.WriteHeader(401)
+			return
+		}
+		switch req.Method + " " + req.URL.Path {
+		case "GET /catalog":
+			fmt.Fprint(w, `[{"offers":[{"offerID":"o1"}],"clusterID":"c1"}]`)
+		case "GET /offers":
+			fmt.Fprint(w, `[{"offerID":"o1"},{"offerID":"o2"}]`)
+		case "POST /offer/o%2F1", "POST /offer/o/1":
+			fmt.Fprint(w, `{"status":"ok"}`)
+		default:
+			w.WriteHeader(404)
+		}
+	}, nil)
+	ctx := context.Background()
+	catalogs, err := client.GetCatalog(ctx)
+	if err != nil || len(catalogs) != 1 || catalogs[0].ClusterID != "c1" || catalogs[0].Offers[0].OfferID != "o1" {
+		t.Errorf("GetCatalog() = %+v, %v", catalogs, err)
+	}
+	offers, err := client.ListOffers(ctx)
+	if err != nil || len(offers) != 2 {
+		t.Errorf("ListOffers() = %+v, %v", offers, err)
+	}
+	if err := client.PostOffer(ctx, catalogv1alpha1.Offer{OfferID: "o/1"}); err != nil {
+		t.Errorf("PostOffer() error = %v", err)
+	}
+	tracker.check(t)
+}
+
+func TestBrokerClientMalformedCatalog(t *testing.T) {
+	client, tracker := testClient(t, func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"not":"a list"}`)
+	}, nil)
+	if _, err := client.GetCatalog(context.Background()); err == nil {
+		t.Error("GetCatalog() accepted a malformed catalog")
+	}
+	tracker.check(t)
+}
+
+func TestBrokerClientRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		refreshErr error
+		wantErr    error
+		wantTokens []string
+	}{
+		{name: "refreshed", wantTokens: []string{"old", "new"}},
+		{name: "refresh failed", refreshErr: errors.New("login failed"), wantErr: ErrUnauthorized, wantTokens: []string{"old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens []string
+			client, tracker := testClient(t, func(w http.ResponseWriter, req *http.Request) {
+				token := req.Header.Get("Authorization")[len("Bearer "):]
+				tokens = append(tokens, token)
+				if token != "new" {
+					w.WriteHeader(401)
+					fmt.Fprint(w, `{"error":"expired"}`)
+				}
+			}, func(ctx context.Context, brokerID, rejected string) (string, error) {
+				if brokerID != "b1" || rejected != "old" {
+					t.Errorf("refresh(%s, %s)", brokerID, rejected)
+				}
+				return "new", tt.refreshErr
+			})
+			err := client.DeleteOffer(context.Background(), "o1")
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteOffer() error = %v, want %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(tokens) != fmt.Sprint(tt.wantTokens) {
+				t.Errorf("tokens sent = %v, want %v", tokens, tt.wantTokens)
+			}
+			tracker.check(t)
+		})
+	}
+}
+
+func TestBrokerClientNotEnabled(t *testing.T) {
+	client := NewClient(&BrokerDocument{ID: "b1", Path: "http://127.0.0.1:1"}, nil, nil)
+	ctx := context.Background()
+	if catalogs, err := client.GetCatalog(ctx); err != nil || len(catalogs) != 0 {
+		t.Errorf("GetCatalog() = %v, %v, want no catalogs", catalogs, err)
+	}
+	if err := client.PostOffer(ctx, catalogv1alpha1.Offer{OfferID: "o1"}); !errors.Is(err, ErrNotEnabled) {
+		t.Errorf("PostOffer() error = %v, want %v", err, ErrNotEnabled)
+	}
+	if _, err := client.ListOffers(ctx); !errors.Is(err, ErrNotEnabled) {
+		t.Errorf("ListOffers() error = %v, want %v", err, ErrNotEnabled)
+	}
+}
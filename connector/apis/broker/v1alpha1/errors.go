@@ -0,0 +1,102 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is the size of the error payloads read from the brokers
+const maxErrorBody = 64 << 10
+
+var (
+	// ErrNotEnabled is returned by the client of a broker the local cluster is not subscribed to.
+	ErrNotEnabled = errors.New("broker is not enabled")
+	// ErrUnauthorized is returned (wrapped) when the broker rejects the token of the local cluster.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is returned (wrapped) when the broker does not know the requested offer or cluster.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned (wrapped) when the request conflicts with the state of the broker.
+	ErrConflict = errors.New("conflict")
+	// ErrServerError is returned (wrapped) when the broker fails to handle the request.
+	ErrServerError = errors.New("server error")
+)
+
+// BrokerError is a response of a broker with an unexpected status code. It wraps the error matching the status code,
+// if any, so that callers can check it with errors.Is.
+type BrokerError struct {
+	StatusCode int
+	Message    string // decoded from the error payload of the broker
+	kind       error
+}
+
+func (e *BrokerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d - message: %s", e.StatusCode, e.Message)
+}
+
+func (e *BrokerError) Unwrap() error {
+	return e.kind
+}
+
+// responseError decodes the error payload of the response, which is left to the caller to close
+func responseError(res *http.Response) error {
+	brokerErr := &BrokerError{StatusCode: res.StatusCode}
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		brokerErr.kind = ErrUnauthorized
+	case res.StatusCode == http.StatusNotFound:
+		brokerErr.kind = ErrNotFound
+	case res.StatusCode == http.StatusConflict:
+		brokerErr.kind = ErrConflict
+	case res.StatusCode >= 500:
+		brokerErr.kind = ErrServerError
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	if err != nil {
+		return brokerErr
+	}
+	brokerErr.Message = errorMessage(body)
+	return brokerErr
+}
+
+// errorMessage returns the message of a {"error": ...} or {"message": ...} payload, or the payload itself
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error   interface{} `json:"error"`
+		Message interface{} `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		for _, value := range []interface{}{payload.Error, payload.Message} {
+			switch value := value.(type) {
+			case nil:
+			case string:
+				return value
+			default:
+				if encoded, err := json.Marshal(value); err == nil {
+					return string(encoded)
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
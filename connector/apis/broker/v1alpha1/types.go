@@ -15,11 +15,22 @@
 package v1alpha1
 
 type BrokerDocument struct {
-	ID       string `json:"brokerID" bson:"id"`
-	Name     string `json:"brokerName" bson:"name"`
-	Path     string `json:"brokerEndpoint" bson:"path"`
-	JWTToken string `bson:"jwt-token"`
-	Enabled  bool   `json:"subscribed" bson:"enabled"`
+	ID            string     `json:"brokerID" bson:"id"`
+	Name          string     `json:"brokerName" bson:"name"`
+	Path          string     `json:"brokerEndpoint" bson:"path"`
+	JWTToken      string     `bson:"jwt-token"`
+	TokenExpiry   int64      `json:"tokenExpiry,omitempty" bson:"token-expiry,omitempty"` // unix time the JWT expires at, 0 if unknown
+	Enabled       bool       `json:"subscribed" bson:"enabled"`
+	TLS           *BrokerTLS `json:"tls,omitempty" bson:"tls,omitempty"` // CA bundle and client certificate of the broker, nil for the system defaults
+	SchemaVersion int        `json:"-" bson:"schema-version"`
+}
+
+// BrokerTLS references the Kubernetes Secrets (namespace/name) with the TLS material used to reach a broker.
+type BrokerTLS struct {
+	// CASecret holds the PEM bundle of the CAs trusted for the broker in its ca.crt entry, in place of the system ones
+	CASecret string `json:"caSecret,omitempty" bson:"ca-secret,omitempty"`
+	// ClientSecret holds the client certificate presented to the broker in its tls.crt and tls.key entries
+	ClientSecret string `json:"clientSecret,omitempty" bson:"client-secret,omitempty"`
 }
 
 type AuthenticationResponse struct {
@@ -0,0 +1,196 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// amountDigits is the number of decimal digits kept by the amounts that are not exact decimals, e.g. 1/3
+const amountDigits = 12
+
+// Amount is an exact decimal amount of money. The zero value is 0, and amounts are never modified in place.
+// It is encoded as a JSON number with all its digits and as a BSON Decimal128, so it never goes through a float.
+type Amount struct {
+	rat *big.Rat
+}
+
+// ParseAmount parses a decimal number, e.g. "10.25".
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.Contains(s, "/") {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount{rat: rat}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics if s is not a decimal number.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAmountFromRat returns the amount equal to r.
+func NewAmountFromRat(r *big.Rat) Amount {
+	return Amount{rat: new(big.Rat).Set(r)}
+}
+
+// Rat returns a copy of the amount as a rational number.
+func (a Amount) Rat() *big.Rat {
+	if a.rat == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(a.rat)
+}
+
+// DeepCopy returns a copy of the amount that does not share its memory.
+func (a Amount) DeepCopy() Amount {
+	if a.rat == nil {
+		return Amount{}
+	}
+	return Amount{rat: a.Rat()}
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{rat: new(big.Rat).Add(a.Rat(), b.rat0())}
+}
+
+func (a Amount) Mul(r *big.Rat) Amount {
+	return Amount{rat: new(big.Rat).Mul(a.Rat(), r)}
+}
+
+func (a Amount) Sign() int {
+	return a.rat0().Sign()
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.rat0().Cmp(b.rat0())
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// Round returns the amount rounded to the given number of decimal digits, halves away from zero.
+func (a Amount) Round(digits int) Amount {
+	rounded, _ := new(big.Rat).SetString(a.rat0().FloatString(digits))
+	return Amount{rat: rounded}
+}
+
+// String returns the amount as a decimal number, with all its digits if it is an exact decimal.
+func (a Amount) String() string {
+	r := a.rat0()
+	// a fraction is an exact decimal if its denominator has no prime factors other than 2 and 5
+	denom := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		count := 0
+		for new(big.Int).Mod(denom, f).Sign() == 0 {
+			denom.Div(denom, f)
+			count++
+		}
+		if count > digits {
+			digits = count
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		s := r.FloatString(amountDigits)
+		return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return r.FloatString(digits)
+}
+
+func (a Amount) rat0() *big.Rat {
+	if a.rat == nil {
+		return new(big.Rat)
+	}
+	return a.rat
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a number, e.g. 10.25, or a string, e.g. "10.25".
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*a = Amount{}
+		return nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, err := primitive.ParseDecimal128(a.String())
+	if err != nil {
+		return 0, nil, fmt.Errorf("amount %s does not fit a Decimal128: %w", a, err)
+	}
+	return bson.MarshalValue(d)
+}
+
+// UnmarshalBSONValue also accepts the doubles written before amounts were exact decimals,
+// reading them as their shortest decimal representation.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	var s string
+	switch t {
+	case bsontype.Decimal128:
+		s = raw.Decimal128().String()
+	case bsontype.Double:
+		s = strconv.FormatFloat(raw.Double(), 'f', -1, 64)
+	case bsontype.Int32:
+		s = strconv.FormatInt(int64(raw.Int32()), 10)
+	case bsontype.Int64:
+		s = strconv.FormatInt(raw.Int64(), 10)
+	case bsontype.String:
+		s = raw.StringValue()
+	case bsontype.Null, bsontype.Undefined:
+		*a = Amount{}
+		return nil
+	default:
+		return fmt.Errorf("cannot decode %s into an amount", t)
+	}
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
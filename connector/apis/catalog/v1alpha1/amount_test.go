@@ -0,0 +1,236 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.25", want: "10.25"},
+		{in: " 7 ", want: "7"},
+		{in: "0", want: "0"},
+		{in: "-3.5", want: "-3.5"},
+		{in: "1e2", want: "100"},
+		{in: "0.10", want: "0.1"},
+		{in: "12345678901234567890.123456789", want: "12345678901234567890.123456789"},
+		{in: "", wantErr: true},
+		{in: "1/3", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAmount(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAmount(%q) = %s, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAmount(%q) error = %v", tt.in, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseAmount(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want string
+	}{
+		{name: "exact sum", got: MustParseAmount("0.1").Add(MustParseAmount("0.2")), want: "0.3"},
+		{name: "sum with zero value", got: Amount{}.Add(MustParseAmount("1.5")), want: "1.5"},
+		{name: "zero value", got: Amount{}, want: "0"},
+		{name: "product", got: MustParseAmount("19.99").Mul(big.NewRat(3, 1)), want: "59.97"},
+		{name: "product by a fraction", got: MustParseAmount("10").Mul(big.NewRat(1, 4)), want: "2.5"},
+		{name: "inexact division", got: MustParseAmount("10").Mul(big.NewRat(1, 3)), want: "3.333333333333"},
+		{name: "round half away from zero", got: MustParseAmount("2.345").Round(2), want: "2.35"},
+		{name: "round negative half away from zero", got: MustParseAmount("-2.345").Round(2), want: "-2.35"},
+		{name: "round down", got: MustParseAmount("2.344").Round(2), want: "2.34"},
+		{name: "round inexact", got: MustParseAmount("2").Mul(big.NewRat(1, 3)).Round(4), want: "0.6667"},
+		{name: "round to units", got: MustParseAmount("9.5").Round(0), want: "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+	}{
+		{a: "1.10", b: "1.1", cmp: 0},
+		{a: "0.3", b: "0.29999999999999999", cmp: 1},
+		{a: "-1", b: "0", cmp: -1},
+	}
+	for _, tt := range tests {
+		if got := MustParseAmount(tt.a).Cmp(MustParseAmount(tt.b)); got != tt.cmp {
+			t.Errorf("Cmp(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.cmp)
+		}
+	}
+	if !(Amount{}).IsZero() || MustParseAmount("0.01").IsZero() {
+		t.Error("IsZero() is wrong")
+	}
+	if got := MustParseAmount("-0.5").Sign(); got != -1 {
+		t.Errorf("Sign() = %d, want -1", got)
+	}
+}
+
+func TestAmountIsImmutable(t *testing.T) {
+	a := MustParseAmount("1")
+	copied := a.DeepCopy()
+	_ = a.Add(MustParseAmount("1"))
+	_ = a.Mul(big.NewRat(5, 1))
+	r := a.Rat()
+	r.SetInt64(42)
+	if a.String() != "1" || copied.String() != "1" {
+		t.Errorf("the amount has been modified in place: %s, copy %s", a, copied)
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string // encoding of the decoded amount
+		wantErr bool
+	}{
+		{name: "number", in: `10.25`, want: `10.25`},
+		{name: "string", in: `"10.25"`, want: `10.25`},
+		{name: "integer", in: `3`, want: `3`},
+		{name: "null", in: `null`, want: `0`},
+		{name: "every digit", in: `12345678901234567.891`, want: `12345678901234567.891`},
+		{name: "exponent", in: `1.5e3`, want: `1500`},
+		{name: "not a number", in: `"abc"`, wantErr: true},
+		{name: "boolean", in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a Amount
+			err := json.Unmarshal([]byte(tt.in), &a)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %s, want an error", tt.in, a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.in, err)
+			}
+			out, err := json.Marshal(a)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Marshal(Unmarshal(%s)) = %s, want %s", tt.in, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountJSONInStruct(t *testing.T) {
+	in := `{"planID":"p1","planCost":0.1}`
+	var plan Plan
+	if err := json.Unmarshal([]byte(in), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.PlanCost.Add(MustParseAmount("0.2")).String(); got != "0.3" {
+		t.Errorf("0.1 + 0.2 = %s, want 0.3", got)
+	}
+}
+
+func TestAmountBSON(t *testing.T) {
+	type doc struct {
+		Cost Amount `bson:"cost"`
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "decimal", value: mustDecimal128(t, "10.25"), want: "10.25"},
+		{name: "legacy double", value: 0.1, want: "0.1"},
+		{name: "int32", value: int32(7), want: "7"},
+		{name: "int64", value: int64(8), want: "8"},
+		{name: "string", value: "2.50", want: "2.5"},
+		{name: "null", value: nil, want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(bson.M{"cost": tt.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d doc
+			if err := bson.Unmarshal(raw, &d); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got := d.Cost.String(); got != tt.want {
+				t.Errorf("decoded %v as %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	for _, s := range []string{"0", "10.25", "-3.125", "12345678901234567.891"} {
+		raw, err := bson.Marshal(doc{Cost: MustParseAmount(s)})
+		if err != nil {
+			t.Fatalf("Marshal(%s) error = %v", s, err)
+		}
+		var stored bson.M
+		if err := bson.Unmarshal(raw, &stored); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stored["cost"].(primitive.Decimal128); !ok {
+			t.Errorf("%s is stored as %T, want a Decimal128", s, stored["cost"])
+		}
+		var d doc
+		if err := bson.Unmarshal(raw, &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Cost.String() != s {
+			t.Errorf("round trip of %s = %s", s, d.Cost)
+		}
+	}
+}
+
+func mustDecimal128(t *testing.T, s string) primitive.Decimal128 {
+	t.Helper()
+	d, err := primitive.ParseDecimal128(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
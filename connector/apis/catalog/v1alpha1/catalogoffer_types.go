@@ -0,0 +1,77 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatalogOfferSpec is the desired state of an offer managed as a Kubernetes resource.
+type CatalogOfferSpec struct {
+	// OfferID of the managed offer. Defaults to the name of the CatalogOffer.
+	// +optional
+	OfferID     string `json:"offerID,omitempty"`
+	OfferName   string `json:"offerName"`
+	OfferType   string `json:"offerType,omitempty"`
+	Description string `json:"description,omitempty"`
+	Plans       []Plan `json:"plans"`
+	// State is the requested lifecycle status: draft, published or suspended. Defaults to published.
+	// +kubebuilder:validation:Enum=draft;published;suspended
+	// +optional
+	State      OfferStatus `json:"state,omitempty"`
+	ValidFrom  int64       `json:"validFrom,omitempty"`
+	ValidUntil int64       `json:"validUntil,omitempty"`
+	Brokers    []string    `json:"brokers,omitempty"`
+}
+
+// CatalogOfferStatus is the state of the offer in the store and on the brokers.
+type CatalogOfferStatus struct {
+	// ObservedGeneration is the generation of the spec last mirrored into the store.
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	OfferID            string      `json:"offerID,omitempty"`
+	Revision           int64       `json:"revision,omitempty"`
+	Status             OfferStatus `json:"status,omitempty"`
+	// Synced is true if every targeted broker has been updated.
+	Synced bool `json:"synced"`
+	// Message explains why the spec cannot be applied.
+	Message string `json:"message,omitempty"`
+	// BrokerErrors are the errors of the last update of the brokers, keyed by broker ID.
+	BrokerErrors map[string]string `json:"brokerErrors,omitempty"`
+	LastSyncTime *metav1.Time      `json:"lastSyncTime,omitempty"`
+}
+
+// CatalogOffer is an offer of the local cluster managed declaratively.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=coffer
+type CatalogOffer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CatalogOfferSpec   `json:"spec,omitempty"`
+	Status CatalogOfferStatus `json:"status,omitempty"`
+}
+
+// CatalogOfferList contains a list of CatalogOffer.
+// +kubebuilder:object:root=true
+type CatalogOfferList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatalogOffer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatalogOffer{}, &CatalogOfferList{})
+}
@@ -0,0 +1,71 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import "time"
+
+// InWindow reports whether t is inside the validity window of the offer. A missing bound is open.
+func (o *Offer) InWindow(t time.Time) bool {
+	now := t.Unix()
+	if o.ValidFrom != 0 && now < o.ValidFrom {
+		return false
+	}
+	if o.ValidUntil != 0 && now >= o.ValidUntil {
+		return false
+	}
+	return true
+}
+
+// NextWindowChange returns the next bound of the validity window after t, or the zero time if there is none.
+func (o *Offer) NextWindowChange(t time.Time) time.Time {
+	now := t.Unix()
+	switch {
+	case o.ValidFrom != 0 && now < o.ValidFrom:
+		return time.Unix(o.ValidFrom, 0)
+	case o.ValidUntil != 0 && now < o.ValidUntil:
+		return time.Unix(o.ValidUntil, 0)
+	}
+	return time.Time{}
+}
+
+// TargetsBroker reports whether the offer is meant to be sent to the broker with the given ID.
+// Offers without a target list are sent to every broker.
+func (o *Offer) TargetsBroker(brokerID string) bool {
+	if len(o.Brokers) == 0 {
+		return true
+	}
+	for _, id := range o.Brokers {
+		if id == brokerID {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateSoldOut marks the plans without units left as sold out. A published offer whose plans are all sold out
+// becomes sold out, and it is published again as soon as a unit is available.
+func (o *Offer) UpdateSoldOut() {
+	available := false
+	for i := range o.Plans {
+		o.Plans[i].SoldOut = o.Plans[i].PlanQuantity == 0
+		available = available || !o.Plans[i].SoldOut
+	}
+	switch {
+	case !available && o.Status == OfferPublished && len(o.Plans) > 0:
+		o.Status = OfferSoldOut
+	case available && o.Status == OfferSoldOut:
+		o.Status = OfferPublished
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"math/big"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// periodsPerMonth converts a price per period into a price per month (365 days a year)
+var periodsPerMonth = map[string]*big.Rat{
+	"minute": big.NewRat(43800, 1),
+	"hour":   big.NewRat(730, 1),
+	"day":    big.NewRat(365, 12),
+	"week":   big.NewRat(365, 84),
+	"month":  big.NewRat(1, 1),
+	"year":   big.NewRat(1, 12),
+}
+
+// Model returns the pricing model of the plan, flat if it has none.
+func (p *Plan) Model() PricingModel {
+	if p.Pricing == nil || p.Pricing.Model == "" {
+		return PricingFlat
+	}
+	return p.Pricing.Model
+}
+
+// Units returns how many units of the priced resource the plan sells.
+func (p *Plan) Units() (*big.Rat, error) {
+	if p.Pricing == nil {
+		return nil, fmt.Errorf("plan %s has no pricing", p.PlanID)
+	}
+	value, ok := p.PlanResources[p.Pricing.Resource]
+	if !ok {
+		return nil, fmt.Errorf("plan %s does not sell %q", p.PlanID, p.Pricing.Resource)
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity %q of %s: %w", value, p.Pricing.Resource, err)
+	}
+	unit := resource.MustParse("1")
+	if p.Pricing.Unit != "" {
+		if unit, err = resource.ParseQuantity(p.Pricing.Unit); err != nil {
+			return nil, fmt.Errorf("invalid unit %q: %w", p.Pricing.Unit, err)
+		}
+	}
+	if unit.Sign() <= 0 {
+		return nil, fmt.Errorf("unit %q must be positive", p.Pricing.Unit)
+	}
+	return new(big.Rat).SetFrac(big.NewInt(quantity.MilliValue()), big.NewInt(unit.MilliValue())), nil
+}
+
+// Recurring returns the price of the plan charged every PlanCostPeriod.
+func (p *Plan) Recurring() (Amount, error) {
+	switch p.Model() {
+	case PricingFlat:
+		return p.PlanCost, nil
+	case PricingPerUnit:
+		units, err := p.Units()
+		if err != nil {
+			return Amount{}, err
+		}
+		return p.Pricing.UnitPrice.Mul(units), nil
+	case PricingTiered:
+		units, err := p.Units()
+		if err != nil {
+			return Amount{}, err
+		}
+		for _, tier := range p.Pricing.Tiers {
+			if tier.UpTo == 0 || units.Cmp(big.NewRat(tier.UpTo, 1)) <= 0 {
+				return tier.UnitPrice.Mul(units), nil
+			}
+		}
+		return Amount{}, fmt.Errorf("plan %s has no tier for %s units", p.PlanID, units.FloatString(3))
+	}
+	return Amount{}, fmt.Errorf("unknown pricing model %q", p.Pricing.Model)
+}
+
+// SetupFee returns the price of the plan charged once.
+func (p *Plan) SetupFee() Amount {
+	if p.Pricing == nil {
+		return Amount{}
+	}
+	return p.Pricing.SetupFee
+}
+
+// MonthlyRecurring returns the recurring price of the plan over a month, rounded to the cent,
+// so that plans billed over different periods can be compared.
+func (p *Plan) MonthlyRecurring() (Amount, error) {
+	factor, ok := periodsPerMonth[p.PlanCostPeriod]
+	if !ok {
+		return Amount{}, fmt.Errorf("unknown period %q", p.PlanCostPeriod)
+	}
+	recurring, err := p.Recurring()
+	if err != nil {
+		return Amount{}, err
+	}
+	return recurring.Mul(factor).Round(2), nil
+}
+
+// Price returns the price of a contract for the plan.
+func (p *Plan) Price() (*Price, error) {
+	recurring, err := p.Recurring()
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := p.MonthlyRecurring()
+	if err != nil {
+		return nil, err
+	}
+	return &Price{
+		Currency:        p.PlanCostCurrency,
+		Period:          p.PlanCostPeriod,
+		Recurring:       recurring,
+		SetupFee:        p.SetupFee(),
+		MonthlyEstimate: monthly,
+	}, nil
+}
@@ -15,9 +15,37 @@
 package v1alpha1
 
 import (
+	"bytes"
+	"encoding/json"
+
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 )
 
+// OfferStatus is the lifecycle state of an offer. Only published offers are sent to the brokers.
+type OfferStatus string
+
+const (
+	OfferDraft     OfferStatus = "draft"
+	OfferPublished OfferStatus = "published"
+	OfferSuspended OfferStatus = "suspended"
+	OfferSoldOut   OfferStatus = "sold-out"
+	OfferRetired   OfferStatus = "retired"
+)
+
+// UnmarshalJSON accepts the boolean status sent by older clients, which is decoded as an empty status.
+func (s *OfferStatus) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		*s = ""
+		return nil
+	}
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	*s = OfferStatus(status)
+	return nil
+}
+
 type Catalog struct {
 	Offers                  []Offer `json:"offers" bson:"offers"`
 	ClusterContractEndpoint string  `json:"clusterContractEndpoint" bson:"endpoint-store"`
@@ -28,20 +56,150 @@ type Catalog struct {
 type Plan struct {
 	PlanID           string            `json:"planID" bson:"plan-id"`
 	PlanName         string            `json:"planName" bson:"plan-name"`
-	PlanCost         float64           `json:"planCost" bson:"plan-cost"`
+	PlanCost         Amount            `json:"planCost" bson:"plan-cost"` // price of the plan per period with the flat model
 	PlanCostCurrency string            `json:"planCostCurrency" bson:"plan-cost-currency"`
 	PlanCostPeriod   string            `json:"planCostPeriod" bson:"plan-cost-period"`
-	PlanQuantity     int64             `json:"planQuantity" bson:"plan-quantity"`
+	Pricing          *Pricing          `json:"pricing,omitempty" bson:"pricing,omitempty"` // flat PlanCost if nil
+	PlanQuantity     int64             `json:"planQuantity" bson:"plan-quantity"`          // units left to sell
+	SoldOut          bool              `json:"soldOut" bson:"sold-out"`
 	PlanResources    map[string]string `json:"resources" bson:"plan-resources"`
+	// MonthlyEstimate is the recurring price of the plan over a month, computed for the remote catalogs.
+	MonthlyEstimate *Amount `json:"monthlyEstimate,omitempty" bson:"-"`
+}
+
+// PricingModel is how the recurring price of a plan is computed.
+type PricingModel string
+
+const (
+	// PricingFlat charges the PlanCost every period.
+	PricingFlat PricingModel = "flat"
+	// PricingPerUnit charges the UnitPrice for every unit of the priced resource every period.
+	PricingPerUnit PricingModel = "per-unit"
+	// PricingTiered charges every unit of the priced resource at the UnitPrice of the tier
+	// the total number of units falls in (volume pricing).
+	PricingTiered PricingModel = "tiered"
+)
+
+// Pricing is the pricing model of a plan. Prices are in the PlanCostCurrency, per PlanCostPeriod.
+type Pricing struct {
+	Model PricingModel `json:"model" bson:"model"`
+	// Resource is the resource of the plan the per-unit and tiered models are priced on, e.g. cpu.
+	Resource string `json:"resource,omitempty" bson:"resource,omitempty"`
+	// Unit is the quantity of the resource priced as one unit, e.g. 1Gi. Defaults to 1.
+	Unit      string      `json:"unit,omitempty" bson:"unit,omitempty"`
+	UnitPrice Amount      `json:"unitPrice" bson:"unit-price"`
+	Tiers     []PriceTier `json:"tiers,omitempty" bson:"tiers,omitempty"`
+	// SetupFee is charged once, when the contract is stipulated.
+	SetupFee Amount `json:"setupFee" bson:"setup-fee"`
+}
+
+// PriceTier prices the units up to UpTo, starting from the end of the previous tier.
+// The last tier has no upper bound, and its UpTo is 0.
+type PriceTier struct {
+	UpTo      int64  `json:"upTo,omitempty" bson:"up-to,omitempty"`
+	UnitPrice Amount `json:"unitPrice" bson:"unit-price"`
+}
+
+// Price is the price of a contract, computed from the pricing model of its plan when it is stipulated.
+type Price struct {
+	Currency        string `json:"currency" bson:"currency"`
+	Period          string `json:"period" bson:"period"`
+	Recurring       Amount `json:"recurring" bson:"recurring"` // charged every period
+	SetupFee        Amount `json:"setupFee" bson:"setup-fee"`
+	MonthlyEstimate Amount `json:"monthlyEstimate" bson:"monthly-estimate"`
 }
 
 type Offer struct {
-	OfferID           string `json:"offerID" bson:"offer-id"` // this is intentionally NOT the objectid
-	OfferName         string `json:"offerName" bson:"offer-name"`
-	OfferType         string `json:"offerType" bson:"offer-type"`
-	Description       string `json:"description" bson:"description"`
-	Plans             []Plan `json:"plans" bson:"plans"`
-	ClusterPrettyName string `json:"clusterPrettyName" bson:"provider-pretty-name"`
-	Created           int64  `json:"created" bson:"created"`
-	Status            bool   `json:"status" bson:"status"`
+	OfferID           string       `json:"offerID" bson:"offer-id"` // this is intentionally NOT the objectid
+	OfferName         string       `json:"offerName" bson:"offer-name"`
+	OfferType         string       `json:"offerType" bson:"offer-type"`
+	Description       string       `json:"description" bson:"description"`
+	Plans             []Plan       `json:"plans" bson:"plans"`
+	ClusterPrettyName string       `json:"clusterPrettyName" bson:"provider-pretty-name"`
+	Created           int64        `json:"created" bson:"created"`
+	Status            OfferStatus  `json:"status" bson:"status"`
+	ValidFrom         int64        `json:"validFrom,omitempty" bson:"valid-from,omitempty"`   // unix time the offer is listed from, if published
+	ValidUntil        int64        `json:"validUntil,omitempty" bson:"valid-until,omitempty"` // unix time the offer is withdrawn at
+	Brokers           []string     `json:"brokers,omitempty" bson:"brokers,omitempty"`        // IDs of the brokers the offer is sent to, all if empty
+	ManagedBy         string       `json:"managedBy,omitempty" bson:"managed-by,omitempty"`   // namespace/name of the CatalogOffer managing the offer
+	Revision          int64        `json:"revision" bson:"revision"`                          // incremented on every update, returned as ETag
+	Search            *OfferSearch `json:"-" bson:"search,omitempty"`                         // written by the store
+	SchemaVersion     int          `json:"-" bson:"schema-version"`
+}
+
+// OfferSearch holds the values derived from an offer that the store filters and sorts the offers on.
+type OfferSearch struct {
+	Cost  Amount       `bson:"cost"` // lowest monthly estimate of the plans
+	Plans []PlanSearch `bson:"plans"`
+}
+
+// PlanSearch holds the values derived from a plan that the store filters the offers on.
+// Resources are a list rather than a map, since resource names such as nvidia.com/gpu are not valid MongoDB field names.
+type PlanSearch struct {
+	Cost      Amount           `bson:"cost"` // monthly estimate
+	Resources []ResourceSearch `bson:"resources"`
+}
+
+// ResourceSearch is a resource of a plan, with its quantity in milli-units (e.g. 4000 for 4 CPUs).
+type ResourceSearch struct {
+	Name  string `bson:"name"`
+	Milli int64  `bson:"milli"`
+}
+
+// OfferRevision is an immutable copy of an offer, stored every time the offer changes.
+type OfferRevision struct {
+	OfferID  string `json:"offerID" bson:"offer-id"`
+	Revision int64  `json:"revision" bson:"revision"`
+	Created  int64  `json:"created" bson:"created"`
+	Offer    Offer  `json:"offer" bson:"offer"`
+	// Deleted marks the revision recording the deletion of the offer, whose last version is kept as Offer.
+	Deleted bool `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	// Changes are the fields changed since the previous revision, computed when the history is read.
+	Changes []FieldChange `json:"changes,omitempty" bson:"-"`
+}
+
+// FieldChange is a field of an offer whose value changed between two revisions.
+// Field is the JSON path of the value, where plans are addressed by ID, e.g. plans[small].planCost.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// OfferBundle is the document of the offer export and import, with every offer of the cluster.
+type OfferBundle struct {
+	Offers []Offer `json:"offers"`
+}
+
+// OfferImportResult lists the changes made by an offer import, or that would be made in a dry run.
+type OfferImportResult struct {
+	DryRun    bool          `json:"dryRun"`
+	Created   []string      `json:"created"`
+	Updated   []OfferChange `json:"updated"`
+	Deleted   []string      `json:"deleted"` // drafts are deleted, the other offers are retired
+	Unchanged []string      `json:"unchanged"`
+}
+
+// OfferChange is an offer updated by an import, with the fields that changed.
+type OfferChange struct {
+	OfferID string        `json:"offerID"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// OfferSize is a slice of the cluster capacity proposed as a plan by the offer generator.
+type OfferSize struct {
+	Name      string            `json:"name"`
+	Resources map[string]string `json:"resources"`
+	Cost      Amount            `json:"cost"`
+	Currency  string            `json:"currency"`
+	Period    string            `json:"period"`
+}
+
+// OfferGeneratorConfig configures how the available capacity of the cluster is sliced into plans.
+type OfferGeneratorConfig struct {
+	OfferName string `json:"offerName"`
+	OfferType string `json:"offerType"`
+	// ReservePercentage of the available capacity is kept back and never offered. Defaults to 20.
+	ReservePercentage *int64      `json:"reservePercentage,omitempty"`
+	Sizes             []OfferSize `json:"sizes"`
 }
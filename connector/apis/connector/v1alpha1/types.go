@@ -40,6 +40,7 @@ type ConnectorInfo struct {
 	PrettyName        string            `json:"prettyName" bson:"prettyname"`
 	ContractEndpoint  string            `json:"contractEndpoint" bson:"contract-endpoint"`
 	Ready             bool              `json:"ready" bson:"ready"`
+	SchemaVersion     int               `json:"-" bson:"schema-version"`
 }
 
 type ClusterResources struct {
@@ -52,7 +53,6 @@ type ClusterResources struct {
 type CatalogConnector struct {
 	// Parameters
 	ClusterParameters *ClusterParameters
-	ClusterResources  *ClusterResources
 	ClusterPrettyName string
 	ContractEndpoint  string
 	// Other
@@ -15,17 +15,37 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+
 	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 )
 
 type ContractDocument struct {
 	// each contract is uniquely identified by the buyer's and seller's ID
-	ContractID string                     `json:"contractID" bson:"contract-id"`
-	BuyerID    string                     `json:"buyerID" bson:"buyer-cluster-id"`
-	Seller     connectorv1alpha1.Provider `json:"seller" bson:"seller"`
-	Offer      catalogv1alpha1.Offer      `json:"offer" bson:"offer"`
-	PlanID     string                     `json:"planID" bson:"plan-id"` // An array of plan **descriptions**
-	Enabled    bool                       `json:"enabled" bson:"enabled"`
-	Created    int64                      `json:"created" bson:"created"`
+	ContractID    string                     `json:"contractID" bson:"contract-id"`
+	BuyerID       string                     `json:"buyerID" bson:"buyer-cluster-id"`
+	Seller        connectorv1alpha1.Provider `json:"seller" bson:"seller"`
+	Offer         catalogv1alpha1.Offer      `json:"offer" bson:"offer"`
+	PlanID        string                     `json:"planID" bson:"plan-id"`                  // An array of plan **descriptions**
+	Price         *catalogv1alpha1.Price     `json:"price,omitempty" bson:"price,omitempty"` // computed from the plan when the contract is stipulated
+	Enabled       bool                       `json:"enabled" bson:"enabled"`
+	Created       int64                      `json:"created" bson:"created"`
+	Revision      int64                      `json:"revision" bson:"revision"`
+	SchemaVersion int                        `json:"-" bson:"schema-version"`
+}
+
+// CapacityLedger compares the resources committed by the active contracts sold by the local cluster
+// with the allocatable resources of the cluster.
+type CapacityLedger struct {
+	OvercommitRatio float64 `json:"overcommitRatio"`
+	// Allocatable are the allocatable resources of the physical nodes of the cluster.
+	Allocatable corev1.ResourceList `json:"allocatable"`
+	// Limit is Allocatable multiplied by OvercommitRatio: the maximum that can be sold.
+	Limit corev1.ResourceList `json:"limit"`
+	// Committed is the sum of the plan resources of the active seller-side contracts.
+	Committed corev1.ResourceList `json:"committed"`
+	// Remaining is Limit minus Committed, never negative.
+	Remaining corev1.ResourceList `json:"remaining"`
+	Contracts int                 `json:"contracts"`
 }
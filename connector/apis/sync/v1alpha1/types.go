@@ -0,0 +1,77 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+// SyncOperation is what the delivery of an outbox entry does on the broker.
+type SyncOperation string
+
+const (
+	// SyncPost sends the offer to the broker.
+	SyncPost SyncOperation = "post"
+	// SyncDelete withdraws the offer from the broker.
+	SyncDelete SyncOperation = "delete"
+	// SyncClean deletes every offer of the local cluster from the broker, then posts again those targeting it.
+	SyncClean SyncOperation = "clean"
+)
+
+// CleanSyncOfferID is the OfferID of the SyncClean entries, which concern every offer.
+const CleanSyncOfferID = "*"
+
+// OutboxEntry is a change of an offer waiting to be delivered to a broker. There is at most one entry
+// for every offer and broker: a newer change replaces the pending one. The offer is read when the entry is delivered,
+// so that the broker always gets its latest version.
+type OutboxEntry struct {
+	ID        string        `json:"id" bson:"id"` // brokerID/offerID
+	BrokerID  string        `json:"brokerID" bson:"broker-id"`
+	OfferID   string        `json:"offerID" bson:"offer-id"`
+	Operation SyncOperation `json:"operation" bson:"operation"` // as of the last change or attempt
+	// Sequence changes every time the entry is replaced, so that a delivery does not remove a newer change.
+	Sequence    int64  `json:"sequence" bson:"sequence"`
+	Created     int64  `json:"created" bson:"created"`
+	Attempts    int    `json:"attempts" bson:"attempts"`
+	NextAttempt int64  `json:"nextAttempt" bson:"next-attempt"` // unix time
+	LastError   string `json:"lastError,omitempty" bson:"last-error,omitempty"`
+}
+
+// OutboxEntryID returns the ID of the outbox entry of the offer and the broker.
+func OutboxEntryID(brokerID, offerID string) string {
+	return brokerID + "/" + offerID
+}
+
+// SyncStatus is the outcome of the deliveries of an offer to a broker. It is kept after the offer is withdrawn,
+// until the offer is deleted.
+type SyncStatus struct {
+	ID          string        `json:"-" bson:"id"` // brokerID/offerID, see OutboxEntryID
+	BrokerID    string        `json:"brokerID" bson:"broker-id"`
+	OfferID     string        `json:"offerID" bson:"offer-id"`
+	Operation   SyncOperation `json:"operation,omitempty" bson:"operation,omitempty"`      // of the last attempt
+	LastAttempt int64         `json:"lastAttempt,omitempty" bson:"last-attempt,omitempty"` // unix time
+	LastSuccess int64         `json:"lastSuccess,omitempty" bson:"last-success,omitempty"` // unix time
+	// ContentHash is the digest of the version of the offer the broker got with the last success, empty once withdrawn.
+	ContentHash string `json:"contentHash,omitempty" bson:"content-hash,omitempty"`
+	LastError   string `json:"lastError,omitempty" bson:"last-error,omitempty"` // empty if the last attempt succeeded
+	Pending     bool   `json:"pending" bson:"-"`                                // a change waits in the outbox
+	// UpToDate reports whether the broker lists the current version of the offer, or does not list it if it must not.
+	UpToDate bool `json:"upToDate" bson:"-"`
+}
+
+// BrokerSyncStatus sums up the sync status of the offers of a broker.
+type BrokerSyncStatus struct {
+	BrokerID    string       `json:"brokerID"`
+	UpToDate    int          `json:"upToDate"`              // offers the broker is up to date with
+	OutOfDate   int          `json:"outOfDate"`             // offers pending, failed or changed since the last success
+	LastSuccess int64        `json:"lastSuccess,omitempty"` // unix time of the last delivery that succeeded
+	Offers      []SyncStatus `json:"offers"`
+}
@@ -27,15 +27,16 @@ import (
 	"github.com/gorilla/mux"
 	resourcemonitors "github.com/liqotech/liqo/pkg/liqo-controller-manager/resource-request-controller/resource-monitors"
 	"github.com/rs/cors"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	klog "k8s.io/klog/v2"
 
+	admin "connector/pkg/admin"
 	broker "connector/pkg/broker"
 	"connector/pkg/connector"
 	contracts "connector/pkg/contracts"
+	"connector/pkg/fanout"
 	grpcserver "connector/pkg/grpc"
+	"connector/pkg/keyring"
 	liqocontroller "connector/pkg/liqo-controller"
 	offers "connector/pkg/offers"
 	ws "connector/pkg/websocket"
@@ -51,18 +52,28 @@ const (
 	mongoDefaultEndpoint = "localhost" // default endpoint for MongoDB server
 	mongoBaseEndpoint    = "mongodb://"
 	mongoDefaultDatabase = "catalog-connector" // default database name for MongoDB server
+	storeDefaultBackend  = "mongo"             // default storage backend
+	defaultOvercommit    = 1.0                 // default ratio between the sellable and the allocatable resources
+	defaultReconcile     = 10 * time.Minute    // default interval between the reconciliations with the brokers
 )
 
 var (
-	grpcPort      = flag.Int("grpc-port", grpcDefaultPort, "The gRPC server port")
-	httpPort      = flag.Int("http-port", httpDefaultPort, "The HTTP server port")
-	mongoPort     = flag.Int("mongo-port", mongoDefaultPort, "The MongoDB server port")
-	mongoEndpoint = flag.String("mongo-endpoint", mongoDefaultEndpoint, "The MongoDB server endpoint")
-	mongoDatabase = flag.String("mongo-database", mongoDefaultDatabase, "The MongoDB server database name")
-	mongoUsername = flag.String("mongo-username", "", "The MongoDB server username")
-	mongoPassword = flag.String("mongo-password", "", "The MongoDB server password")
-	grpcEndpoint  = flag.String("grpc-endpoint", grpcDefaultEndpoint, "The gRPC server endpoint")
-	httpEndpoint  = flag.String("http-endpoint", httpDefaultEndpoint, "The HTTP server endpoint")
+	grpcPort         = flag.Int("grpc-port", grpcDefaultPort, "The gRPC server port")
+	httpPort         = flag.Int("http-port", httpDefaultPort, "The HTTP server port")
+	mongoPort        = flag.Int("mongo-port", mongoDefaultPort, "The MongoDB server port")
+	mongoEndpoint    = flag.String("mongo-endpoint", mongoDefaultEndpoint, "The MongoDB server endpoint")
+	mongoDatabase    = flag.String("mongo-database", mongoDefaultDatabase, "The MongoDB server database name")
+	mongoUsername    = flag.String("mongo-username", "", "The MongoDB server username")
+	mongoPassword    = flag.String("mongo-password", "", "The MongoDB server password")
+	grpcEndpoint     = flag.String("grpc-endpoint", grpcDefaultEndpoint, "The gRPC server endpoint")
+	httpEndpoint     = flag.String("http-endpoint", httpDefaultEndpoint, "The HTTP server endpoint")
+	storeBackend     = flag.String("store", storeDefaultBackend, "The storage backend: mongo, memory or file:///path/to/connector.db")
+	overcommitRatio  = flag.Float64("overcommit-ratio", defaultOvercommit, "The ratio between the resources that can be sold and the allocatable resources of the cluster")
+	encryptionSecret = flag.String("encryption-secret", "", "The namespace/name of the Secret with the keys that encrypt the stored tokens (disabled if empty)")
+	offerController  = flag.Bool("offer-controller", false, "Manage the offers declared as CatalogOffer resources (requires the CRD)")
+	brokerParallel   = flag.Int("broker-parallelism", fanout.DefaultParallelism, "The number of brokers called at the same time")
+	brokerTimeout    = flag.Duration("broker-timeout", fanout.DefaultTimeout, "The time every broker has to answer a call")
+	reconcileEvery   = flag.Duration("reconcile-interval", defaultReconcile, "The interval between the reconciliations of the offers listed by the brokers (disabled if 0)")
 )
 
 func main() {
@@ -71,11 +82,15 @@ func main() {
 	flag.Parse()
 	ctx := context.Background()
 
+	if *overcommitRatio <= 0 {
+		klog.Fatalf("Invalid overcommit ratio %v: it must be positive", *overcommitRatio)
+	}
+
 	grpcUrl := *grpcEndpoint + ":" + strconv.Itoa(*grpcPort)
 	httpUrl := *httpEndpoint + ":" + strconv.Itoa(*httpPort)
 	mongoUrl := mongoBaseEndpoint + *mongoEndpoint + ":" + strconv.Itoa(*mongoPort)
 
-	log.Printf("Starting Catalog Connector\n\tGRPC Endpoint: %s \n\tHTTP Endpoint: %s \n\tMongoDB URL: %s", grpcUrl, httpUrl, mongoUrl)
+	log.Printf("Starting Catalog Connector\n\tGRPC Endpoint: %s \n\tHTTP Endpoint: %s \n\tStore: %s", grpcUrl, httpUrl, *storeBackend)
 
 	// Create a Kubernetes client (controller-runtime)
 	log.Print("Getting k8s client")
@@ -84,40 +99,61 @@ func main() {
 		klog.Fatalf("Error retrieving clients: %", err)
 	}
 
-	// Connect to a MongoDB client
-	log.Print("Creating and connecting MongoDB client")
-	mongoOpts := options.Client().ApplyURI(mongoUrl)
-	if *mongoUsername != "" && *mongoPassword != "" {
-		mongoOpts.SetAuth(options.Credential{
-			Username: *mongoUsername,
-			Password: *mongoPassword,
-		})
-	}
-
-	mongoClient, err := mongo.Connect(context.Background(), mongoOpts)
+	// Open the storage backend
+	log.Printf("Opening %s store", *storeBackend)
+	connectorStore, err := openStore(ctx, *storeBackend, mongoUrl)
 	if err != nil {
 		klog.Fatal(err)
 	}
+	defer connectorStore.Close(context.Background())
+
+	// Upgrade the stored documents to the current schema
+	log.Print("Running store migrations")
+	if err := connectorStore.Migrate(ctx); err != nil {
+		klog.Fatalf("Error migrating store: %s", err)
+	}
 
-	mongoDatabase := mongoClient.Database(*mongoDatabase)
+	// Encrypt the stored tokens with the keys of the encryption Secret
+	var connectorKeyring *keyring.Keyring
+	if *encryptionSecret != "" {
+		log.Printf("Loading encryption keys from secret %s", *encryptionSecret)
+		connectorKeyring, err = loadKeyring(ctx, KClient, *encryptionSecret)
+		if err != nil {
+			klog.Fatalf("Error loading encryption keys: %s", err)
+		}
+		connectorStore = connectorStore.WithEncryption(connectorKeyring)
+		// tokens stored before encryption was enabled, or with an old key, are rewritten with the primary key
+		count, err := connectorStore.Reencrypt(ctx)
+		if err != nil {
+			klog.Fatalf("Error encrypting stored tokens: %s", err)
+		}
+		log.Printf("\tEncrypted %d documents with key %s", count, connectorKeyring.Primary())
+	} else {
+		log.Print("Encryption secret not set: tokens are stored in plaintext")
+	}
 
 	// Init Catalog Connector (pkg/connector)
 	log.Print("Creating Catalog Connector")
 	catalogConnector := connector.InitCatalogConnector(CRClient, KClient)
 
+	// Calls to the brokers are run concurrently, each with its own deadline
+	brokerExecutor := fanout.NewExecutor(*brokerParallel, *brokerTimeout)
+
 	// Init HTTP Handlers
 	log.Print("\tInitializing Broker Handler")
-	brokerHandler := broker.InitBrokerHandler(mongoDatabase, catalogConnector)
+	brokerHandler := broker.InitBrokerHandler(connectorStore.Brokers, catalogConnector)
 	log.Print("\tInitializing Offer Handler")
-	offersHandler := offers.InitOffersHandler(mongoDatabase, catalogConnector)
+	offersHandler := offers.InitOffersHandler(connectorStore.Offers, connectorStore.OfferRevisions, connectorStore.SyncOutbox, connectorStore.SyncStatus, brokerExecutor, catalogConnector)
 	log.Print("\tInitializing Contract Handler")
-	contractsHandler := contracts.InitContractsHandler(mongoDatabase, catalogConnector)
+	contractsHandler := contracts.InitContractsHandler(connectorStore.Contracts, *overcommitRatio, catalogConnector)
 	log.Print("\tInitializing WebSocket Handler")
 	websocketHandler := ws.InitWebsocketHandler(catalogConnector)
 	log.Print("\tInitializing Connector Handler")
-	connectorHandler := connector.InitConnectorHandler(mongoDatabase, catalogConnector)
+	connectorHandler := connector.InitConnectorHandler(connectorStore.Info, brokerExecutor, catalogConnector)
 	log.Print("\tInitializing Liqo Controller Handler")
 	liqoControllerHandler := liqocontroller.InitLiqoControllerHandler(catalogConnector)
+	log.Print("\tInitializing Admin Handler")
+	adminHandler := admin.InitAdminHandler(connectorStore, connectorKeyring, catalogConnector)
 
 	// Set callback functions to allow interactions between the gRPC Server and the HTTP Server
 	// TODO: to be checked
@@ -132,6 +168,8 @@ func main() {
 	offersHandler.RegisterBrokerHandler(brokerHandler)
 	contractsHandler.RegisterOffersHandler(offersHandler)
 	connectorHandler.RegisterBrokerHandler(brokerHandler)
+	adminHandler.RegisterWebsocketHandler(websocketHandler)
+	adminHandler.RegisterOffersHandler(offersHandler)
 
 	// Init or Retrive a Catalog Connector (pkg/connector)
 	log.Print("Trying to retrieve an existing instance of Catalog Connector")
@@ -140,6 +178,43 @@ func main() {
 		log.Printf("Catalog Connector Ready: information successfully retrieved!")
 	}
 
+	// Publish and withdraw the time-boxed offers
+	log.Print("Starting offer scheduler")
+	if err := offersHandler.StartScheduler(ctx); err != nil {
+		log.Printf("Error starting offer scheduler: %s", err)
+	}
+
+	// Renew the broker tokens before they expire
+	log.Print("Starting broker token renewal")
+	brokerHandler.StartTokenRenewal(ctx)
+
+	// Deliver the changes of the offers to the brokers, including those left pending before a restart
+	log.Print("Starting sync outbox")
+	offersHandler.StartOutbox(ctx)
+
+	// Correct the offers the brokers list for the local cluster
+	if *reconcileEvery > 0 {
+		log.Printf("Reconciling the brokers every %s", *reconcileEvery)
+		offersHandler.StartReconciler(ctx, *reconcileEvery)
+	}
+
+	// Mirror the CatalogOffer resources into the offers
+	if *offerController {
+		log.Print("Starting CatalogOffer controller")
+		mgr, err := liqocontroller.GetManager()
+		if err != nil {
+			klog.Fatalf("Error creating controller manager: %s", err)
+		}
+		if err := offersHandler.SetupOfferController(mgr, CRClient); err != nil {
+			klog.Fatalf("Error creating CatalogOffer controller: %s", err)
+		}
+		go func() {
+			if err := mgr.Start(ctx); err != nil {
+				log.Printf("CatalogOffer controller stopped: %s", err)
+			}
+		}()
+	}
+
 	// gRPC Server
 	log.Print("Creating gRPC Server")
 	externalMonitorServer := grpcserver.GetNewEMServer(catalogConnector)
@@ -161,12 +236,19 @@ func main() {
 	offersHandler.SetRoutes(baseRouter)
 	websocketHandler.SetRoutes(baseRouter)
 	liqoControllerHandler.SetRoutes(baseRouter)
+	adminHandler.SetRoutes(baseRouter)
+
+	// Same as cors.Default, but lets the UI use the revisions and the pages of the offers
+	corsOptions := cors.New(cors.Options{
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "If-Match"},
+		ExposedHeaders: []string{"ETag", "X-Next-Cursor"},
+	})
 
 	// HTTP Server start listener
 	go func(logger *log.Logger) {
 		server := &http.Server{
 			Addr:              httpUrl,
-			Handler:           cors.Default().Handler(r),
+			Handler:           corsOptions.Handler(r),
 			ReadHeaderTimeout: 5 * time.Second,
 		}
 
@@ -0,0 +1,68 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"k8s.io/client-go/kubernetes"
+
+	"connector/pkg/keyring"
+	"connector/pkg/store"
+)
+
+const fileStorePrefix = "file://"
+
+// openStore opens the storage backend selected with the --store flag.
+func openStore(ctx context.Context, backend, mongoUrl string) (*store.Store, error) {
+	switch {
+	case strings.HasPrefix(backend, fileStorePrefix):
+		path := strings.TrimPrefix(backend, fileStorePrefix)
+		if path == "" {
+			return nil, fmt.Errorf("missing file path in store %q", backend)
+		}
+		return store.NewBoltStore(path)
+	case backend == "mongo":
+		mongoOpts := options.Client().ApplyURI(mongoUrl)
+		if *mongoUsername != "" && *mongoPassword != "" {
+			mongoOpts.SetAuth(options.Credential{
+				Username: *mongoUsername,
+				Password: *mongoPassword,
+			})
+		}
+		mongoClient, err := mongo.Connect(ctx, mongoOpts)
+		if err != nil {
+			return nil, err
+		}
+		return store.NewMongoStore(mongoClient.Database(*mongoDatabase)), nil
+	case backend == "memory":
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}
+
+// loadKeyring loads the encryption keys from the Secret selected with the --encryption-secret flag (namespace/name).
+func loadKeyring(ctx context.Context, kclient kubernetes.Interface, secret string) (*keyring.Keyring, error) {
+	namespace, name, ok := strings.Cut(secret, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid encryption secret %q: expected namespace/name", secret)
+	}
+	return keyring.Load(ctx, kclient, namespace, name)
+}
@@ -0,0 +1,215 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"connector/pkg/connector"
+	"connector/pkg/keyring"
+	liqocontroller "connector/pkg/liqo-controller"
+	"connector/pkg/store"
+	"connector/pkg/utils"
+
+	adminv1alpha1 "connector/apis/admin/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+)
+
+const (
+	maxArchiveSize = 64 << 20 // maximum size of an archive accepted by the restore endpoint
+)
+
+type AdminHandler struct {
+	catalogConnector *connectorv1alpha1.CatalogConnector
+	store            *store.Store
+	keyring          *keyring.Keyring
+	websocketHandler connector.WebsocketHandler
+	offersHandler    connector.OffersHandler
+}
+
+// InitAdminHandler creates the handler of the admin API. connectorKeyring is nil if encryption is disabled.
+func InitAdminHandler(connectorStore *store.Store, connectorKeyring *keyring.Keyring,
+	catalogConnector *connectorv1alpha1.CatalogConnector) *AdminHandler {
+	return &AdminHandler{
+		store:            connectorStore,
+		keyring:          connectorKeyring,
+		catalogConnector: catalogConnector,
+	}
+}
+
+func (ah *AdminHandler) RegisterWebsocketHandler(wh connector.WebsocketHandler) {
+	ah.websocketHandler = wh
+}
+
+func (ah *AdminHandler) RegisterOffersHandler(oh connector.OffersHandler) {
+	ah.offersHandler = oh
+}
+
+func (ah *AdminHandler) SetRoutes(router *mux.Router) {
+	sub := router.PathPrefix("/admin").Subrouter()
+	sub.HandleFunc("/backup", ah.backup).Methods("GET")
+	sub.HandleFunc("/restore", ah.restore).Methods("POST")
+	sub.HandleFunc("/reencrypt", ah.reencrypt).Methods("POST")
+}
+
+// backup streams an archive with the whole connector state
+func (ah *AdminHandler) backup(w http.ResponseWriter, req *http.Request) {
+	clusterParameters, err := ah.clusterParameters(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+
+	header := &adminv1alpha1.Archive{
+		Version:       adminv1alpha1.ArchiveVersion,
+		SchemaVersion: store.SchemaVersion,
+		ClusterID:     clusterParameters.ClusterID,
+		Created:       time.Now().Unix(),
+	}
+	// the tokens leave the connector encrypted with the keys of the encryption Secret, or not at all
+	seal := secretFunc(redactSecret)
+	header.Secrets = adminv1alpha1.SecretsRedacted
+	if ah.keyring != nil {
+		seal = ah.keyring.Encrypt
+		header.Secrets = adminv1alpha1.SecretsEncrypted
+	}
+	// the info is read before streaming, so that a failure can still be reported with an error status
+	info, err := ah.store.Info.Get(req.Context())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	header.Info = info
+
+	log.Printf("Streaming backup of cluster %s", header.ClusterID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="connector-backup-%s-%d.json"`, header.ClusterID, header.Created))
+	w.WriteHeader(200)
+	result, err := exportArchive(req.Context(), w, ah.store, header, seal)
+	if err != nil {
+		// the status has already been sent: the client gets a truncated archive, which the restore endpoint rejects
+		log.Printf("Error streaming backup: %s", err)
+		return
+	}
+	log.Printf("\tBackup streamed: %d brokers, %d offers, %d contracts", result.Brokers, result.Offers, result.Contracts)
+}
+
+// restore imports an archive produced by backup, then resubscribes to the restored brokers and synchronizes the offers
+func (ah *AdminHandler) restore(w http.ResponseWriter, req *http.Request) {
+	var archive adminv1alpha1.Archive
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxArchiveSize)).Decode(&archive); err != nil {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"parsing archive: %s"}`, err))
+		return
+	}
+
+	clusterParameters, err := ah.clusterParameters(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	if err := validateArchive(&archive, clusterParameters.ClusterID); err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	var open secretFunc
+	if ah.keyring != nil {
+		open = ah.keyring.Decrypt
+	}
+	if err := openSecrets(&archive, open); err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+
+	// brokers already in the store keep their current subscription
+	known := make(map[string]bool)
+	brokers, err := ah.store.Brokers.List(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	for _, broker := range brokers {
+		known[broker.ID] = true
+	}
+
+	log.Printf("Restoring backup of cluster %s created at %d", archive.ClusterID, archive.Created)
+	result, err := importArchive(req.Context(), ah.store, &archive, clusterParameters)
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+
+	if archive.Info != nil {
+		ah.catalogConnector.ClusterParameters = clusterParameters
+		ah.catalogConnector.ClusterPrettyName = archive.Info.PrettyName
+		ah.catalogConnector.ContractEndpoint = archive.Info.ContractEndpoint
+		ah.catalogConnector.Ready = archive.Info.Ready && archive.Info.PrettyName != "" && archive.Info.ContractEndpoint != ""
+	}
+
+	for _, broker := range archive.Brokers {
+		if broker.Enabled && !known[broker.ID] {
+			log.Printf("\tSubscribing to restored broker %s", broker.ID)
+			go ah.websocketHandler.SubscribeToBroker(broker)
+		}
+	}
+
+	log.Print("\tSynchronizing restored offers")
+	if err := ah.offersHandler.SyncOffers(); err != nil {
+		log.Printf("Failed to synchronize offers: %s", err)
+	}
+
+	utils.WriteResponse(w, result, "restore", "Connector state restored", true)
+}
+
+// reencrypt reloads the encryption keys and rewrites every stored token with the primary key.
+// It must be called after a new primary key has been added to the encryption Secret, before removing the old one.
+func (ah *AdminHandler) reencrypt(w http.ResponseWriter, req *http.Request) {
+	if ah.keyring == nil {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"encryption is not enabled"}`))
+		return
+	}
+	if err := ah.keyring.Reload(req.Context()); err != nil {
+		utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"reloading encryption keys: %s"}`, err))
+		return
+	}
+
+	count, err := ah.store.Reencrypt(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+
+	result := adminv1alpha1.ReencryptResult{PrimaryKey: ah.keyring.Primary(), Documents: count}
+	utils.WriteResponse(w, result, "reencrypt", fmt.Sprintf("Re-encrypted %d documents with key %s", count, result.PrimaryKey), true)
+}
+
+// clusterParameters returns the parameters of the local cluster, reading them from K8s if the catalog is not initialized
+func (ah *AdminHandler) clusterParameters(ctx context.Context) (*connectorv1alpha1.ClusterParameters, error) {
+	if ah.catalogConnector.ClusterParameters != nil {
+		return ah.catalogConnector.ClusterParameters, nil
+	}
+	clusterParameters, err := liqocontroller.GetClusterParameters(ctx, ah.catalogConnector.CRClient)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading peering credentials: %s"}`, err)
+	}
+	return clusterParameters, nil
+}
@@ -0,0 +1,315 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"connector/pkg/store"
+	"connector/pkg/validation"
+
+	adminv1alpha1 "connector/apis/admin/v1alpha1"
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// archiveWriter encodes an Archive one field and one document at a time, so that the backup
+// is streamed to the client instead of being built in memory.
+type archiveWriter struct {
+	w      io.Writer
+	enc    *json.Encoder
+	fields int
+	items  int
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	return &archiveWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (a *archiveWriter) write(s string) error {
+	_, err := io.WriteString(a.w, s)
+	return err
+}
+
+// key opens the next field of the archive object
+func (a *archiveWriter) key(name string) error {
+	sep := ","
+	if a.fields == 0 {
+		sep = "{"
+	}
+	a.fields++
+	return a.write(fmt.Sprintf("%s%q:", sep, name))
+}
+
+func (a *archiveWriter) field(name string, value interface{}) error {
+	if err := a.key(name); err != nil {
+		return err
+	}
+	return a.enc.Encode(value)
+}
+
+// list writes the field name as an array, whose items are encoded by each through the function it is given
+func (a *archiveWriter) list(name string, each func(item func(value interface{}) error) error) (int, error) {
+	if err := a.key(name); err != nil {
+		return 0, err
+	}
+	if err := a.write("["); err != nil {
+		return 0, err
+	}
+	a.items = 0
+	err := each(func(value interface{}) error {
+		if a.items > 0 {
+			if err := a.write(","); err != nil {
+				return err
+			}
+		}
+		a.items++
+		return a.enc.Encode(value)
+	})
+	if err != nil {
+		return a.items, err
+	}
+	if f, ok := a.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return a.items, a.write("]")
+}
+
+func (a *archiveWriter) close() error {
+	return a.write("}\n")
+}
+
+// secretFunc transforms a token written to or read from an archive.
+type secretFunc func(value string) (string, error)
+
+// redactSecret removes the token from the archive.
+func redactSecret(string) (string, error) {
+	return "", nil
+}
+
+// exportArchive streams the archive of the store to w, reading the collections one document at a time.
+// Every token is written through seal, so that no token is ever written in plaintext.
+// It returns the number of brokers, offers and contracts written.
+func exportArchive(ctx context.Context, w io.Writer, s *store.Store, header *adminv1alpha1.Archive, seal secretFunc) (*adminv1alpha1.RestoreResult, error) {
+	result := &adminv1alpha1.RestoreResult{}
+	a := newArchiveWriter(w)
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"version", header.Version},
+		{"schemaVersion", header.SchemaVersion},
+		{"clusterID", header.ClusterID},
+		{"created", header.Created},
+		{"secrets", header.Secrets},
+	} {
+		if err := a.field(field.name, field.value); err != nil {
+			return result, err
+		}
+	}
+	if header.Info != nil {
+		info := *header.Info
+		token, err := seal(info.ClusterParameters.Token)
+		if err != nil {
+			return result, err
+		}
+		info.ClusterParameters.Token = token
+		if err := a.field("info", &info); err != nil {
+			return result, err
+		}
+	}
+
+	var err error
+	result.Brokers, err = a.list("brokers", func(item func(interface{}) error) error {
+		return s.Brokers.Each(ctx, func(broker brokerv1alpha1.BrokerDocument) error {
+			token, err := seal(broker.JWTToken)
+			if err != nil {
+				return err
+			}
+			broker.JWTToken = token
+			return item(broker)
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Offers, err = a.list("offers", func(item func(interface{}) error) error {
+		return s.Offers.Each(ctx, func(offer catalogv1alpha1.Offer) error { return item(offer) })
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Contracts, err = a.list("contracts", func(item func(interface{}) error) error {
+		return s.Contracts.Each(ctx, func(contract contractsv1alpha1.ContractDocument) error {
+			token, err := seal(contract.Seller.Token)
+			if err != nil {
+				return err
+			}
+			contract.Seller.Token = token
+			return item(contract)
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, a.close()
+}
+
+// validateArchive checks that the archive can be restored on the cluster identified by clusterID
+func validateArchive(archive *adminv1alpha1.Archive, clusterID string) error {
+	if archive.Version == 0 || archive.Version > adminv1alpha1.ArchiveVersion {
+		return fmt.Errorf(`{"error":"unsupported archive version %d"}`, archive.Version)
+	}
+	if archive.SchemaVersion > store.SchemaVersion {
+		return fmt.Errorf(`{"error":"archive schema version %d is newer than the supported version %d"}`, archive.SchemaVersion, store.SchemaVersion)
+	}
+	if archive.ClusterID != clusterID {
+		return fmt.Errorf(`{"error":"archive belongs to cluster %s, not to the local cluster %s"}`, archive.ClusterID, clusterID)
+	}
+	if archive.Info != nil && archive.Info.ClusterParameters.ClusterID != "" && archive.Info.ClusterParameters.ClusterID != clusterID {
+		return fmt.Errorf(`{"error":"archive info belongs to cluster %s"}`, archive.Info.ClusterParameters.ClusterID)
+	}
+	for _, broker := range archive.Brokers {
+		if broker.ID == "" || broker.Path == "" {
+			return fmt.Errorf(`{"error":"archive contains a broker without id or path"}`)
+		}
+	}
+	for i := range archive.Offers {
+		if err := validation.ValidateOffer(&archive.Offers[i]); err != nil {
+			return fmt.Errorf(`{"error":"archive contains an invalid offer %s: %s"}`, archive.Offers[i].OfferID, err)
+		}
+	}
+	for _, contract := range archive.Contracts {
+		if contract.ContractID == "" {
+			return fmt.Errorf(`{"error":"archive contains a contract without id"}`)
+		}
+	}
+	return nil
+}
+
+// openSecrets decrypts the tokens of an archive written with encryption enabled. open is nil if encryption is not enabled.
+func openSecrets(archive *adminv1alpha1.Archive, open secretFunc) error {
+	if archive.Secrets != adminv1alpha1.SecretsEncrypted {
+		return nil
+	}
+	if open == nil {
+		return fmt.Errorf(`{"error":"the archive tokens are encrypted, but encryption is not enabled"}`)
+	}
+	decrypt := func(value *string) error {
+		plaintext, err := open(*value)
+		if err != nil {
+			return fmt.Errorf(`{"error":"decrypting archive tokens: %s"}`, err)
+		}
+		*value = plaintext
+		return nil
+	}
+	if archive.Info != nil {
+		if err := decrypt(&archive.Info.ClusterParameters.Token); err != nil {
+			return err
+		}
+	}
+	for i := range archive.Brokers {
+		if err := decrypt(&archive.Brokers[i].JWTToken); err != nil {
+			return err
+		}
+	}
+	for i := range archive.Contracts {
+		if err := decrypt(&archive.Contracts[i].Seller.Token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importArchive merges the archive into the store: documents with the same ID are overwritten, the others are kept.
+// The documents of archives taken with an older schema version are upgraded by the migrations released since then.
+// The info document is restored with the current clusterParameters, since the token may have changed since the backup,
+// and so are the redacted tokens of the contracts sold by the local cluster. Brokers whose token has been redacted
+// are authenticated again as soon as they reject the empty token.
+func importArchive(ctx context.Context, s *store.Store, archive *adminv1alpha1.Archive,
+	clusterParameters *connectorv1alpha1.ClusterParameters) (*adminv1alpha1.RestoreResult, error) {
+	result := &adminv1alpha1.RestoreResult{}
+
+	if archive.Info != nil {
+		if err := s.Info.SetClusterParameters(ctx, clusterParameters); err != nil {
+			return nil, err
+		}
+		if err := s.Info.SetPrettyName(ctx, clusterParameters.ClusterID, archive.Info.PrettyName); err != nil {
+			return nil, err
+		}
+		if err := s.Info.SetContractEndpoint(ctx, clusterParameters.ClusterID, archive.Info.ContractEndpoint); err != nil {
+			return nil, err
+		}
+		if archive.Info.Ready {
+			if err := s.Info.SetReady(ctx, clusterParameters.ClusterID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, broker := range archive.Brokers {
+		if broker.JWTToken == "" {
+			// a broker that is still registered keeps the token it has been issued since the backup
+			current, err := s.Brokers.Get(ctx, broker.ID)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			if current != nil {
+				broker.JWTToken, broker.TokenExpiry = current.JWTToken, current.TokenExpiry
+			}
+		}
+		if err := store.UpgradeDocument(store.BROKER_COLLECTION, archive.SchemaVersion, &broker); err != nil {
+			return nil, fmt.Errorf(`{"error":"upgrading broker %s: %s"}`, broker.ID, err)
+		}
+		if err := s.Brokers.Upsert(ctx, broker); err != nil {
+			return nil, err
+		}
+		result.Brokers++
+	}
+	for _, offer := range archive.Offers {
+		// archives taken before the lifecycle statuses carry a boolean status
+		if offer.Status == "" {
+			offer.Status = catalogv1alpha1.OfferDraft
+		}
+		if err := store.UpgradeDocument(store.OFFER_COLLECTION, archive.SchemaVersion, &offer); err != nil {
+			return nil, fmt.Errorf(`{"error":"upgrading offer %s: %s"}`, offer.OfferID, err)
+		}
+		if err := s.Offers.Upsert(ctx, offer); err != nil {
+			return nil, err
+		}
+		result.Offers++
+	}
+	for i := range archive.Contracts {
+		contract := &archive.Contracts[i]
+		if contract.Seller.Token == "" && contract.Seller.ClusterID == clusterParameters.ClusterID {
+			contract.Seller.Token = clusterParameters.Token
+		}
+		if err := store.UpgradeDocument(store.CONTRACT_COLLECTION, archive.SchemaVersion, contract); err != nil {
+			return nil, fmt.Errorf(`{"error":"upgrading contract %s: %s"}`, contract.ContractID, err)
+		}
+		if err := s.Contracts.Upsert(ctx, contract); err != nil {
+			return nil, err
+		}
+		result.Contracts++
+	}
+	return result, nil
+}
@@ -15,36 +15,39 @@
 package broker
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 
 	brokerv1alpha1 "connector/apis/broker/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 	"connector/pkg/connector"
+	"connector/pkg/store"
 	"connector/pkg/utils"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
-)
-
-const (
-	MONGODB_BROKER_COLLECTION = "brokers"
-	MONGODB_DB                = "catalog-connector"
 )
 
 type BrokerHandler struct {
-	catalogConnector  *connectorv1alpha1.CatalogConnector
-	brokersCollection *mongo.Collection
-	websocketHandler  connector.WebsocketHandler
-	offersHandler     connector.OffersHandler
+	catalogConnector *connectorv1alpha1.CatalogConnector
+	brokers          store.BrokerRepository
+	websocketHandler connector.WebsocketHandler
+	offersHandler    connector.OffersHandler
+
+	// tokenMutex serializes the re-authentications, so that a rejected token is renewed only once
+	tokenMutex sync.Mutex
+	// transports caches the TLS settings of the brokers, by the Secrets they are loaded from
+	tlsMutex   sync.Mutex
+	transports map[brokerv1alpha1.BrokerTLS]*brokerTransport
 }
 
-func InitBrokerHandler(mDatabase *mongo.Database, catalogConnector *connectorv1alpha1.CatalogConnector) *BrokerHandler {
-	brokersCollection := mDatabase.Collection(MONGODB_BROKER_COLLECTION)
+func InitBrokerHandler(brokers store.BrokerRepository, catalogConnector *connectorv1alpha1.CatalogConnector) *BrokerHandler {
 	return &BrokerHandler{
-		brokersCollection: brokersCollection,
-		catalogConnector:  catalogConnector,
+		brokers:          brokers,
+		catalogConnector: catalogConnector,
+		transports:       make(map[brokerv1alpha1.BrokerTLS]*brokerTransport),
 	}
 }
 
@@ -65,7 +68,7 @@ func (bh *BrokerHandler) SetRoutes(router *mux.Router) {
 }
 
 func (bh *BrokerHandler) getBrokers(w http.ResponseWriter, req *http.Request) {
-	brokers, err := getAllBrokers(bh.brokersCollection)
+	brokers, err := bh.brokers.List(req.Context())
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -95,32 +98,45 @@ func (bh *BrokerHandler) registerBroker(w http.ResponseWriter, req *http.Request
 	}
 
 	// check if broker already registered
-	found, err := findBroker(bh.brokersCollection, path)
-	if found {
+	_, err := bh.brokers.GetByPath(req.Context(), path)
+	if err == nil {
 		utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"broker already registered"}`))
 		return
-	} else if err != nil {
+	} else if !errors.Is(err, store.ErrNotFound) {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
 
+	// load the CA bundle and the client certificate to reach the broker with, if any
+	var tlsRef *brokerv1alpha1.BrokerTLS
+	if caSecret, clientSecret := req.FormValue("ca-secret"), req.FormValue("client-secret"); caSecret != "" || clientSecret != "" {
+		tlsRef = &brokerv1alpha1.BrokerTLS{CASecret: caSecret, ClientSecret: clientSecret}
+	}
+	transport, err := bh.brokerTransport(req.Context(), tlsRef)
+	if err != nil {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"loading TLS settings: %s"}`, err))
+		return
+	}
+
 	// connect to broker
-	authStruct, err := connectToBroker(name, path, contractEndpoint, bh.catalogConnector.ClusterParameters)
+	authStruct, err := connectToBroker(req.Context(), transport.client, name, path, contractEndpoint, bh.catalogConnector.ClusterParameters)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
 
 	doc := brokerv1alpha1.BrokerDocument{
-		ID:       authStruct.BrokerID,
-		Name:     name,
-		Path:     path,
-		JWTToken: authStruct.Token,
-		Enabled:  true,
+		ID:          authStruct.BrokerID,
+		Name:        name,
+		Path:        path,
+		JWTToken:    authStruct.Token,
+		TokenExpiry: brokerv1alpha1.TokenExpiry(authStruct.Token),
+		Enabled:     true,
+		TLS:         tlsRef,
 	}
 
 	// save broker to database
-	err = insertBroker(bh.brokersCollection, doc)
+	err = bh.brokers.Upsert(req.Context(), doc)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -137,7 +153,7 @@ func (bh *BrokerHandler) unregisterBroker(w http.ResponseWriter, req *http.Reque
 	id := req.URL.Query().Get("id")
 
 	log.Printf("Clearing offers from broker %s", id)
-	err := bh.ClearBroker(id)
+	err := bh.ClearBroker(req.Context(), id)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
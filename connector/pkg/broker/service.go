@@ -17,6 +17,7 @@ package broker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -25,52 +26,25 @@ import (
 
 	brokerv1alpha1 "connector/apis/broker/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func getAllBrokers(b *mongo.Collection) (*[]brokerv1alpha1.BrokerDocument, error) {
-	cursor, err := b.Find(context.Background(), bson.D{})
-	if err != nil {
-		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
-	}
-	var brokers []brokerv1alpha1.BrokerDocument
-	if err = cursor.All(context.Background(), &brokers); err != nil {
-		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
-	}
-	return &brokers, nil
-}
-
-func getBrokerById(b *mongo.Collection, id string) (*brokerv1alpha1.BrokerDocument, error) {
-	var broker brokerv1alpha1.BrokerDocument
-	err := b.FindOne(context.Background(), bson.D{{Key: "id", Value: id}}).Decode(&broker)
-	if err != nil {
-		return &brokerv1alpha1.BrokerDocument{}, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
-	}
-	return &broker, nil
-}
-
-func findBroker(b *mongo.Collection, id string) (bool, error) {
-	result := b.FindOne(context.Background(), bson.D{{Key: "path", Value: id}})
-	if result.Err() == nil {
-		return true, nil
-	}
-	if result.Err() == mongo.ErrNoDocuments {
-		return false, nil
-	}
-	return false, fmt.Errorf(`{"error":"%s"}`, result.Err())
-}
-
-func connectToBroker(name, path, contractEndpoint string, credentials *connectorv1alpha1.ClusterParameters) (*brokerv1alpha1.AuthenticationResponse, error) {
+func connectToBroker(ctx context.Context, client *http.Client, name, path, contractEndpoint string, credentials *connectorv1alpha1.ClusterParameters) (*brokerv1alpha1.AuthenticationResponse, error) {
 	log.Printf("Connecting to broker %s at %s", name, path)
 	credentialsString := fmt.Sprintf("{\"clusterID\":\"%s\", \"clusterName\":\"%s\", \"token\":\"%s\", \"endpoint\":\"%s\",\"clusterContractEndpoint\":\"%s\"}",
 		credentials.ClusterID, credentials.ClusterName, credentials.Token, credentials.Endpoint, contractEndpoint)
-	resp, err := http.Post(path+"/authenticate", "application/json", strings.NewReader(credentialsString))
+	req, err := http.NewRequestWithContext(ctx, "POST", path+"/authenticate", strings.NewReader(credentialsString))
 	if err != nil {
 		return nil, fmt.Errorf(`{"error":"authentication: %s"}`, err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"authentication: %s"}`, err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf(`{"error":"authentication: unexpected status code %d", "message":"%s"}`, resp.StatusCode, resp.Body)
 	}
@@ -89,44 +63,14 @@ func connectToBroker(name, path, contractEndpoint string, credentials *connector
 	return authStruct, nil
 }
 
-func insertBroker(b *mongo.Collection, broker brokerv1alpha1.BrokerDocument) error {
-	filter := bson.D{{Key: "id", Value: broker.ID}}
-	update := bson.D{{Key: "$set", Value: broker}}
-	opts := options.Update().SetUpsert(true)
-	if _, err := b.UpdateOne(context.Background(), filter, update, opts); err != nil {
-		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
-	}
-	return nil
-}
-
-func deleteBroker(b *mongo.Collection, id string) error {
-	_, err := b.DeleteOne(context.Background(), bson.D{{Key: "id", Value: id}})
-	if err != nil {
-		return fmt.Errorf(`{"error":"deleting from database: %s"}`, err)
-	}
-	return nil
-}
-
-// TODO: REVIEW
-func updateBrokerSub(b *mongo.Collection, id string, enabled bool) error {
-	filter := bson.D{{Key: "id", Value: id}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "enabled", Value: enabled}}}}
-	opts := options.Update().SetUpsert(true)
-	_, err := b.UpdateOne(context.Background(), filter, update, opts)
-	if err != nil {
-		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
-	}
-	return nil
-}
-
-func clearBroker(b *mongo.Collection, brokerID string) error {
-	broker, err := getBrokerById(b, brokerID)
+func (bh *BrokerHandler) clearBroker(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) error {
+	client, err := bh.BrokerClient(broker)
 	if err != nil {
-		return err
+		return fmt.Errorf(`{"error":"Failed to delete all offers from broker ` + broker.ID + `: ` + err.Error() + `"}`)
 	}
-	err = broker.DeleteAllOffers()
-	if err != nil {
-		return fmt.Errorf(`{"error":"Failed to delete all offers from broker ` + brokerID + `: ` + err.Error() + `"}`)
+	err = client.DeleteAllOffers(ctx)
+	if err != nil && !errors.Is(err, brokerv1alpha1.ErrNotFound) {
+		return fmt.Errorf(`{"error":"Failed to delete all offers from broker ` + broker.ID + `: ` + err.Error() + `"}`)
 	}
 	return nil
 }
@@ -0,0 +1,142 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+)
+
+// tlsReloadInterval is how long the TLS material of a broker is reused before its Secrets are read again,
+// so that a rotated certificate is picked up without restarting the connector.
+const tlsReloadInterval = 5 * time.Minute
+
+// brokerTransport holds the TLS settings loaded from the Secrets referenced by a broker, and the client that uses them.
+type brokerTransport struct {
+	config *tls.Config
+	client *http.Client
+	loaded time.Time
+}
+
+// BrokerClient returns the client of the broker, which uses its TLS settings and re-authenticates
+// with the broker if its token is rejected.
+func (bh *BrokerHandler) BrokerClient(broker *brokerv1alpha1.BrokerDocument) (brokerv1alpha1.BrokerClient, error) {
+	transport, err := bh.brokerTransport(context.Background(), broker.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return brokerv1alpha1.NewClient(broker, transport.client, bh.RefreshToken), nil
+}
+
+// BrokerTLSConfig returns the TLS settings used to reach the broker, nil if it uses the system defaults.
+func (bh *BrokerHandler) BrokerTLSConfig(broker *brokerv1alpha1.BrokerDocument) (*tls.Config, error) {
+	transport, err := bh.brokerTransport(context.Background(), broker.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return transport.config, nil
+}
+
+// brokerTransport returns the TLS settings referenced by ref, loading them again from the Secrets
+// once they are older than tlsReloadInterval. A nil ref selects the system defaults and the shared client.
+func (bh *BrokerHandler) brokerTransport(ctx context.Context, ref *brokerv1alpha1.BrokerTLS) (*brokerTransport, error) {
+	if ref == nil || (ref.CASecret == "" && ref.ClientSecret == "") {
+		return &brokerTransport{}, nil
+	}
+
+	bh.tlsMutex.Lock()
+	defer bh.tlsMutex.Unlock()
+	cached, ok := bh.transports[*ref]
+	if ok && time.Since(cached.loaded) < tlsReloadInterval {
+		return cached, nil
+	}
+
+	config, err := bh.loadTLSConfig(ctx, ref)
+	if err != nil {
+		if ok {
+			// keep the settings that work until the Secrets are fixed
+			return cached, nil
+		}
+		return nil, err
+	}
+	if ok {
+		cached.client.CloseIdleConnections()
+	}
+	transport := &brokerTransport{
+		config: config,
+		client: brokerv1alpha1.NewHTTPClient(config),
+		loaded: time.Now(),
+	}
+	bh.transports[*ref] = transport
+	return transport, nil
+}
+
+// loadTLSConfig builds the TLS settings from the CA bundle and the client certificate stored in the Secrets referenced by ref.
+func (bh *BrokerHandler) loadTLSConfig(ctx context.Context, ref *brokerv1alpha1.BrokerTLS) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ref.CASecret != "" {
+		secret, err := bh.readSecret(ctx, ref.CASecret)
+		if err != nil {
+			return nil, err
+		}
+		bundle, ok := secret.Data[corev1.ServiceAccountRootCAKey]
+		if !ok {
+			return nil, fmt.Errorf("secret %s: missing %s entry", ref.CASecret, corev1.ServiceAccountRootCAKey)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("secret %s: no valid certificate in %s", ref.CASecret, corev1.ServiceAccountRootCAKey)
+		}
+		config.RootCAs = pool
+	}
+	if ref.ClientSecret != "" {
+		secret, err := bh.readSecret(ctx, ref.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: invalid client certificate: %w", ref.ClientSecret, err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// readSecret reads the Secret selected by ref (namespace/name).
+func (bh *BrokerHandler) readSecret(ctx context.Context, ref string) (*corev1.Secret, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid secret %q: expected namespace/name", ref)
+	}
+	if bh.catalogConnector.KClient == nil {
+		return nil, fmt.Errorf("reading secret %s: no Kubernetes client", ref)
+	}
+	secret, err := bh.catalogConnector.KClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading secret %s: %w", ref, err)
+	}
+	return secret, nil
+}
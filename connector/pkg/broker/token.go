@@ -0,0 +1,114 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+)
+
+const (
+	// tokenCheckInterval is how often the expiry of the broker tokens is checked.
+	tokenCheckInterval = time.Minute
+	// tokenRenewBefore is how long before its expiry a token is renewed.
+	tokenRenewBefore = 5 * time.Minute
+)
+
+// RefreshToken authenticates again with the broker using the stored cluster parameters, and stores the new token.
+// If the stored token is no longer the rejected one, it has already been renewed and is returned as it is.
+func (bh *BrokerHandler) RefreshToken(ctx context.Context, brokerID, rejected string) (string, error) {
+	bh.tokenMutex.Lock()
+	defer bh.tokenMutex.Unlock()
+
+	broker, err := bh.brokers.Get(ctx, brokerID)
+	if err != nil {
+		return "", err
+	}
+	if broker.JWTToken != rejected {
+		return broker.JWTToken, nil
+	}
+	if bh.catalogConnector.ClusterParameters == nil {
+		return "", fmt.Errorf(`{"error":"renewing token of broker %s: cluster parameters not defined"}`, brokerID)
+	}
+
+	transport, err := bh.brokerTransport(ctx, broker.TLS)
+	if err != nil {
+		return "", err
+	}
+	authStruct, err := connectToBroker(ctx, transport.client, broker.Name, broker.Path, bh.catalogConnector.ContractEndpoint, bh.catalogConnector.ClusterParameters)
+	if err != nil {
+		return "", err
+	}
+	if authStruct.BrokerID != broker.ID {
+		return "", fmt.Errorf(`{"error":"renewing token of broker %s: broker answered as %s"}`, broker.ID, authStruct.BrokerID)
+	}
+
+	expiry := brokerv1alpha1.TokenExpiry(authStruct.Token)
+	if err := bh.brokers.SetToken(ctx, broker.ID, authStruct.Token, expiry); err != nil {
+		return "", err
+	}
+	if expiry > 0 {
+		log.Printf("Renewed token of broker %s, expiring at %s", broker.ID, time.Unix(expiry, 0).Format(time.RFC3339))
+	} else {
+		log.Printf("Renewed token of broker %s", broker.ID)
+	}
+	return authStruct.Token, nil
+}
+
+// StartTokenRenewal renews the tokens of the enabled brokers before they expire, until ctx is done.
+func (bh *BrokerHandler) StartTokenRenewal(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(tokenCheckInterval)
+		defer ticker.Stop()
+		for {
+			bh.renewExpiringTokens(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (bh *BrokerHandler) renewExpiringTokens(ctx context.Context) {
+	brokers, err := bh.brokers.List(ctx)
+	if err != nil {
+		log.Printf("Token renewal: listing brokers: %s", err)
+		return
+	}
+	deadline := time.Now().Add(tokenRenewBefore).Unix()
+	for i := range brokers {
+		broker := &brokers[i]
+		if !broker.Enabled {
+			continue
+		}
+		expiry := broker.TokenExpiry
+		if expiry == 0 {
+			expiry = brokerv1alpha1.TokenExpiry(broker.JWTToken)
+		}
+		if expiry == 0 || expiry > deadline {
+			continue
+		}
+		log.Printf("Token of broker %s expires at %s, renewing it", broker.ID, time.Unix(expiry, 0).Format(time.RFC3339))
+		if _, err := bh.RefreshToken(ctx, broker.ID, broker.JWTToken); err != nil {
+			log.Printf("\tRenewing token of broker %s: %s", broker.ID, err)
+		}
+	}
+}
@@ -15,25 +15,35 @@
 package broker
 
 import (
+	"context"
+
 	brokerv1alpha1 "connector/apis/broker/v1alpha1"
 )
 
 func (bh *BrokerHandler) RemoveBrokerFromDB(id string) error {
-	return deleteBroker(bh.brokersCollection, id)
+	return bh.brokers.Delete(context.Background(), id)
 }
 
 func (bh *BrokerHandler) SetBrokerSubscription(id string, enabled bool) error {
-	return updateBrokerSub(bh.brokersCollection, id, enabled)
+	return bh.brokers.SetEnabled(context.Background(), id, enabled)
 }
 
 func (bh *BrokerHandler) GetBrokerList() (*[]brokerv1alpha1.BrokerDocument, error) {
-	return getAllBrokers(bh.brokersCollection)
+	brokers, err := bh.brokers.List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &brokers, nil
 }
 
 func (bh *BrokerHandler) GetBroker(id string) (*brokerv1alpha1.BrokerDocument, error) {
-	return getBrokerById(bh.brokersCollection, id)
+	return bh.brokers.Get(context.Background(), id)
 }
 
-func (bh *BrokerHandler) ClearBroker(id string) error {
-	return clearBroker(bh.brokersCollection, id)
+func (bh *BrokerHandler) ClearBroker(ctx context.Context, id string) error {
+	broker, err := bh.GetBroker(id)
+	if err != nil {
+		return err
+	}
+	return bh.clearBroker(ctx, broker)
 }
@@ -15,37 +15,37 @@
 package connector
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
 	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	"connector/pkg/fanout"
+	"connector/pkg/store"
 	"connector/pkg/utils"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-	liqoNamespace               = "liqo"
-	MONGODB_BROKER_COLLECTION   = "brokers"
-	MONGODB_OFFER_COLLECTION    = "offers"
-	MONGODB_CONTRACT_COLLECTION = "contracts"
-	MONGODB_INFO_COLLECTION     = "info"
+	liqoNamespace = "liqo"
 )
 
 type ConnectorHandler struct {
 	catalogConnector *connectorv1alpha1.CatalogConnector
-	infoCollection   *mongo.Collection
+	info             store.InfoRepository
 	brokerHandler    BrokerHandler
+	executor         *fanout.Executor
 }
 
-func InitConnectorHandler(mDatabase *mongo.Database, catalogConnector *connectorv1alpha1.CatalogConnector) *ConnectorHandler {
-	infoCollection := mDatabase.Collection(MONGODB_INFO_COLLECTION)
+func InitConnectorHandler(info store.InfoRepository, executor *fanout.Executor, catalogConnector *connectorv1alpha1.CatalogConnector) *ConnectorHandler {
 	return &ConnectorHandler{
-		infoCollection:   infoCollection,
+		info:             info,
+		executor:         executor,
 		catalogConnector: catalogConnector,
 	}
 }
@@ -86,7 +86,7 @@ func (ch *ConnectorHandler) InitCatalog(w http.ResponseWriter, req *http.Request
 	}
 
 	log.Printf("Setting Provider PrettyName...")
-	err = setClusterPrettyName(ch.infoCollection, cp.ClusterID, prettyName)
+	err = ch.info.SetPrettyName(req.Context(), cp.ClusterID, prettyName)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -95,7 +95,7 @@ func (ch *ConnectorHandler) InitCatalog(w http.ResponseWriter, req *http.Request
 	log.Printf("Provider PrettyName successfully set: %s", prettyName)
 
 	log.Printf("Setting Contract Endpoint...")
-	err = setContractEndpoint(ch.infoCollection, cp.ClusterID, contractEndpoint)
+	err = ch.info.SetContractEndpoint(req.Context(), cp.ClusterID, contractEndpoint)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -104,7 +104,7 @@ func (ch *ConnectorHandler) InitCatalog(w http.ResponseWriter, req *http.Request
 	log.Printf("Contract Endpoint successfully set: %s", contractEndpoint)
 
 	log.Printf("Setting Catalog as Ready...")
-	err = setReadyCatalog(ch.infoCollection, cp.ClusterID)
+	err = ch.info.SetReady(req.Context(), cp.ClusterID)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -121,15 +121,25 @@ func (ch *ConnectorHandler) GetRemoteCatalogs(w http.ResponseWriter, req *http.R
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
-	var catalogs []catalogv1alpha1.Catalog
-	for _, broker := range *brokers {
-		newCatalog, err := broker.GetCatalog()
+	// the brokers are queried concurrently, and those that fail or time out are skipped
+	results := ch.executor.Run(req.Context(), *brokers, func(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+		client, err := ch.brokerHandler.BrokerClient(broker)
 		if err != nil {
-			log.Printf("error while getting offers from broker %s: %s", broker.ID, err)
+			return nil, err
+		}
+		return client.GetCatalog(ctx)
+	})
+	var catalogs []catalogv1alpha1.Catalog
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("error while getting offers from broker %s: %s", result.BrokerID, result.Err)
 			continue
 		}
 		// TODO: check if catalog is already in catalogs
-		catalogs = append(catalogs, newCatalog...)
+		catalogs = append(catalogs, result.Value.([]catalogv1alpha1.Catalog)...)
+	}
+	for i := range catalogs {
+		estimateMonthlyPrices(catalogs[i].Offers)
 	}
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -192,7 +202,7 @@ func (ch *ConnectorHandler) GetReadyCatalog(w http.ResponseWriter, req *http.Req
 
 // NOT USED for the moment
 func (ch *ConnectorHandler) GetReadyCatalogFromDB(w http.ResponseWriter, req *http.Request) {
-	ci, err := getReadyCatalog(ch.infoCollection)
+	ci, err := ch.info.Get(req.Context())
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -208,7 +218,7 @@ func (ch *ConnectorHandler) SetClusterPrettyName(w http.ResponseWriter, req *htt
 		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"prettyName is empty"}`))
 		return
 	}
-	err := setClusterPrettyName(ch.infoCollection, clusterID, prettyName)
+	err := ch.info.SetPrettyName(req.Context(), clusterID, prettyName)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -237,7 +247,7 @@ func (ch *ConnectorHandler) SetContractEndpoint(w http.ResponseWriter, req *http
 		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"contractEndpoint is empty"}`))
 		return
 	}
-	err := setContractEndpoint(ch.infoCollection, clusterID, contractEndpoint)
+	err := ch.info.SetContractEndpoint(req.Context(), clusterID, contractEndpoint)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
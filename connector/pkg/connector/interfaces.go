@@ -15,6 +15,10 @@
 package connector
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+
 	corev1 "k8s.io/api/core/v1"
 
 	brokerv1alpha1 "connector/apis/broker/v1alpha1"
@@ -32,14 +36,26 @@ type OffersHandler interface {
 	CleanSyncOffers() error
 	SelectiveSyncOffers(brokerID string) error
 	SelectiveCleanSyncOffers(brokerID string) error
+	ReconcileOffers(brokerID string) error
 	GetOfferByID(offerID string) (*catalogv1alpha1.Offer, error)
+	ReservePlan(offerID, planID string) (*catalogv1alpha1.Offer, error)
+	ReleasePlan(offerID, planID string) error
 }
 
+// ErrSoldOut is returned (wrapped) by OffersHandler.ReservePlan when the plan has no units left.
+var ErrSoldOut = errors.New("plan sold out")
+
 type BrokerHandler interface {
 	RemoveBrokerFromDB(id string) error
 	SetBrokerSubscription(id string, enabled bool) error
 	GetBrokerList() (*[]brokerv1alpha1.BrokerDocument, error)
 	GetBroker(id string) (*brokerv1alpha1.BrokerDocument, error)
+	// BrokerClient returns the client of the broker, which uses its TLS settings and re-authenticates if the token is rejected.
+	BrokerClient(broker *brokerv1alpha1.BrokerDocument) (brokerv1alpha1.BrokerClient, error)
+	// BrokerTLSConfig returns the TLS settings used to reach the broker, nil if it uses the system defaults.
+	BrokerTLSConfig(broker *brokerv1alpha1.BrokerDocument) (*tls.Config, error)
+	// RefreshToken authenticates again with the broker after it has rejected the given token, and returns the new one.
+	RefreshToken(ctx context.Context, brokerID, rejected string) (string, error)
 }
 
 type ContractHandler interface {
@@ -16,12 +16,13 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
-	"go.mongodb.org/mongo-driver/mongo"
-
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	"connector/pkg/store"
 )
 
 // getAndSetClusterParameters reads the cluster parameters from the K8s API and sets them in the info collection
@@ -31,7 +32,7 @@ func (ch *ConnectorHandler) getAndSetClusterParameters() (*connectorv1alpha1.Clu
 	if err != nil {
 		return &connectorv1alpha1.ClusterParameters{}, fmt.Errorf(`{"error":"reading peering credentials: %s"}`, err.Error())
 	}
-	err = setClusterParameters(ch.infoCollection, clusterParameters)
+	err = ch.info.SetClusterParameters(context.Background(), clusterParameters)
 	if err != nil {
 		return &connectorv1alpha1.ClusterParameters{}, err
 	}
@@ -92,9 +93,9 @@ func (ch *ConnectorHandler) getAndSetClusterParameters() (*connectorv1alpha1.Clu
 } */
 
 func (ch *ConnectorHandler) RetrieveAndCheckConnectorConfig() bool {
-	ci, err := retrieveConnectorInfo(ch.infoCollection)
+	ci, err := ch.info.Get(context.Background())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if errors.Is(err, store.ErrNotFound) {
 			log.Print("\tConnector instance not found on DB: Catalog not ready")
 			return false
 		}
@@ -152,3 +153,19 @@ func (ch *ConnectorHandler) RetrieveAndCheckConnectorConfig() bool {
 	}
 	return nil
 } */
+
+// estimateMonthlyPrices sets the monthly estimate of the plans, so that plans billed
+// with different models and periods can be compared. Plans that cannot be priced have none.
+func estimateMonthlyPrices(offers []catalogv1alpha1.Offer) {
+	for i := range offers {
+		for j := range offers[i].Plans {
+			plan := &offers[i].Plans[j]
+			monthly, err := plan.MonthlyRecurring()
+			if err != nil {
+				log.Printf("\tCannot estimate the monthly price of plan %s of offer %s: %s", plan.PlanID, offers[i].OfferID, err)
+				continue
+			}
+			plan.MonthlyEstimate = &monthly
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	liqocontroller "connector/pkg/liqo-controller"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// ErrCapacityExceeded is returned (wrapped) when selling a plan would commit more than the cluster can honour.
+var ErrCapacityExceeded = errors.New("capacity exceeded")
+
+// clusterResources reads the resources of the cluster. It lists every node and pod, so it is called before
+// taking sellMutex rather than while holding it.
+func (ch *ContractsHandler) clusterResources(ctx context.Context) (*connectorv1alpha1.ClusterResources, error) {
+	resources, err := liqocontroller.GetClusterResources(ctx, ch.catalogConnector.CRClient)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading cluster resources: %s"}`, err)
+	}
+	return resources, nil
+}
+
+// capacityLedger sums the resources of the enabled contracts sold by the local cluster and compares them with
+// the allocatable resources of the cluster, multiplied by the overcommit ratio.
+// Resources that the nodes do not report as allocatable (e.g. storage) are committed but never limited.
+func (ch *ContractsHandler) capacityLedger(ctx context.Context, resources *connectorv1alpha1.ClusterResources) (*contractsv1alpha1.CapacityLedger, error) {
+	if ch.catalogConnector.ClusterParameters == nil {
+		return nil, fmt.Errorf(`{"error":"catalog not initialized"}`)
+	}
+	sellerID := ch.catalogConnector.ClusterParameters.ClusterID
+
+	contracts, err := ch.contracts.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &contractsv1alpha1.CapacityLedger{
+		OvercommitRatio: ch.overcommitRatio,
+		Allocatable:     *resources.TotalResources,
+		Limit:           corev1.ResourceList{},
+		Committed:       corev1.ResourceList{},
+		Remaining:       corev1.ResourceList{},
+	}
+	for name, quantity := range ledger.Allocatable {
+		ledger.Limit[name] = scaleQuantity(quantity, ch.overcommitRatio)
+	}
+	for i := range contracts {
+		contract := &contracts[i]
+		if !contract.Enabled || contract.Seller.ClusterID != sellerID {
+			continue
+		}
+		plan := findPlan(&contract.Offer, contract.PlanID)
+		if plan == nil {
+			return nil, fmt.Errorf(`{"error":"contract %s refers to the missing plan %s"}`, contract.ContractID, contract.PlanID)
+		}
+		planResources, err := mapQuantityToResourceList(plan.PlanResources)
+		if err != nil {
+			return nil, err
+		}
+		liqocontroller.AddResourceList(ledger.Committed, *planResources)
+		ledger.Contracts++
+	}
+	for name, limit := range ledger.Limit {
+		remaining := limit.DeepCopy()
+		if committed, ok := ledger.Committed[name]; ok {
+			remaining.Sub(committed)
+		}
+		if remaining.Sign() < 0 {
+			remaining = *resource.NewQuantity(0, limit.Format)
+		}
+		ledger.Remaining[name] = remaining
+	}
+	return ledger, nil
+}
+
+// checkCapacity fails with ErrCapacityExceeded if the ledger cannot take the resources of plan
+func checkCapacity(ledger *contractsv1alpha1.CapacityLedger, plan *catalogv1alpha1.Plan) error {
+	planResources, err := mapQuantityToResourceList(plan.PlanResources)
+	if err != nil {
+		return err
+	}
+	var exceeded []string
+	for name, request := range *planResources {
+		remaining, limited := ledger.Remaining[name]
+		if !limited || request.Cmp(remaining) <= 0 {
+			continue
+		}
+		committed := ledger.Committed[name]
+		limit := ledger.Limit[name]
+		exceeded = append(exceeded, fmt.Sprintf("%s (requested %s, committed %s, limit %s)",
+			name, request.String(), committed.String(), limit.String()))
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	sort.Strings(exceeded)
+	return fmt.Errorf(`{"error":"plan %s exceeds the capacity of the cluster: %s: %w"}`, plan.PlanID, strings.Join(exceeded, ", "), ErrCapacityExceeded)
+}
+
+func findPlan(offer *catalogv1alpha1.Offer, planID string) *catalogv1alpha1.Plan {
+	for i := range offer.Plans {
+		if offer.Plans[i].PlanID == planID {
+			return &offer.Plans[i]
+		}
+	}
+	return nil
+}
+
+func scaleQuantity(quantity resource.Quantity, ratio float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(float64(quantity.MilliValue())*ratio), quantity.Format)
+}
@@ -17,39 +17,41 @@ package contracts
 import (
 	//"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
 
 	"connector/pkg/connector"
+	"connector/pkg/store"
 	"connector/pkg/utils"
 
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
 )
 
-const (
-	//TODO: move to config
-	MONGODB_DB                  = "catalog-connector"
-	MONGODB_CONTRACT_COLLECTION = "contracts"
-)
-
 type ContractsHandler struct {
-	catalogConnector    *connectorv1alpha1.CatalogConnector
-	contractsCollection *mongo.Collection
-	offersHandler       connector.OffersHandler
+	catalogConnector *connectorv1alpha1.CatalogConnector
+	contracts        store.ContractRepository
+	offersHandler    connector.OffersHandler
+	overcommitRatio  float64
+	// sellMutex serializes the capacity check and the storage of the sold contracts
+	sellMutex sync.Mutex
 }
 
-func InitContractsHandler(mDatabase *mongo.Database, catalogConnector *connectorv1alpha1.CatalogConnector) *ContractsHandler {
-	contractsCollection := mDatabase.Collection(MONGODB_CONTRACT_COLLECTION)
+func InitContractsHandler(contracts store.ContractRepository, overcommitRatio float64,
+	catalogConnector *connectorv1alpha1.CatalogConnector) *ContractsHandler {
 	return &ContractsHandler{
-		contractsCollection: contractsCollection,
-		catalogConnector:    catalogConnector,
+		contracts:        contracts,
+		overcommitRatio:  overcommitRatio,
+		catalogConnector: catalogConnector,
 	}
 }
 
@@ -62,17 +64,53 @@ func (ch *ContractsHandler) SetRoutes(router *mux.Router) {
 	router.HandleFunc("/contracts", ch.getContracts).Methods("GET")
 	sub.HandleFunc("/buy", ch.buyContract).Methods("POST")
 	sub.HandleFunc("/sell", ch.sellContract).Methods("POST")
+	sub.HandleFunc("/{id}", ch.getContract).Methods("GET")
+	sub.HandleFunc("/{id}/terminate", ch.terminateContract).Methods("POST")
+	router.HandleFunc("/capacity", ch.getCapacity).Methods("GET")
+}
+
+func (ch *ContractsHandler) getCapacity(w http.ResponseWriter, req *http.Request) {
+	resources, err := ch.clusterResources(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	ledger, err := ch.capacityLedger(req.Context(), resources)
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	utils.WriteResponse(w, ledger, "capacity", "", false)
 }
 
 func (ch *ContractsHandler) getContracts(w http.ResponseWriter, req *http.Request) {
-	contracts, err := getAllContracts(ch.contractsCollection)
+	contracts, err := ch.contracts.List(req.Context())
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
+	keys := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		keys = append(keys, contract.ContractID+":"+strconv.FormatInt(contract.Revision, 10))
+	}
+	w.Header().Set("ETag", utils.ListETag(keys))
 	utils.WriteResponse(w, contracts, "contracts", "", false)
 }
 
+func (ch *ContractsHandler) getContract(w http.ResponseWriter, req *http.Request) {
+	contract, err := ch.contracts.Get(req.Context(), mux.Vars(req)["id"])
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteResponseError(w, 404, err)
+		return
+	}
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(contract.Revision))
+	utils.WriteResponse(w, contract, "contract", "", false)
+}
+
 // addContract adds a plan to the contract between the buyer and the seller (who is presumed to be the current cluster)
 func (ch *ContractsHandler) buyContract(w http.ResponseWriter, req *http.Request) {
 	buyerID := ch.catalogConnector.ClusterParameters.ClusterID
@@ -98,14 +136,14 @@ func (ch *ContractsHandler) buyContract(w http.ResponseWriter, req *http.Request
 
 	// check if a contract already exists
 	log.Print("Checking if exists a contract for this Offer Plan")
-	contracts, err := getContractsByBuyerID(ch.contractsCollection, buyerID)
+	contracts, err := ch.contracts.ListByBuyerID(req.Context(), buyerID)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
-	if len(*contracts) > 0 {
-		for _, contract := range *contracts {
-			if contract.Offer.OfferID == offerID && contract.PlanID == planID {
+	if len(contracts) > 0 {
+		for _, contract := range contracts {
+			if contract.Enabled && contract.Offer.OfferID == offerID && contract.PlanID == planID {
 				log.Print("Contract for this Offer Plan already exists")
 				utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"contract for this Offer Plan already exists"}`))
 				return
@@ -127,8 +165,15 @@ func (ch *ContractsHandler) buyContract(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	// sellers running an older version do not price their contracts
+	if contract.Price == nil {
+		if contract.Price, err = contractPrice(&contract); err != nil {
+			log.Printf("Cannot price contract %s: %s", contract.ContractID, err)
+		}
+	}
+
 	log.Printf("Storing contract %v", contract)
-	err = storeContract(ch.contractsCollection, &contract)
+	err = ch.contracts.Insert(req.Context(), &contract)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
@@ -163,32 +208,34 @@ func (ch *ContractsHandler) sellContract(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	found := false
-	//planIndex := 0
-	for _, candidatePlan := range offer.Plans {
-		if candidatePlan.PlanID == planID {
-			//planIndex = id
-			found = true
-			break
-		}
+	if offer.Status != catalogv1alpha1.OfferPublished {
+		log.Printf("\tOffer %s is %s", offerID, offer.Status)
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"offer %s is %s"}`, offerID, offer.Status))
+		return
+	}
+	if !offer.InWindow(time.Now()) {
+		log.Printf("\tOffer %s is outside its validity window", offerID)
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"offer %s is not valid at this time"}`, offerID))
+		return
 	}
 
-	if !found {
+	plan := findPlan(offer, planID)
+	if plan == nil {
 		log.Printf("\tNo such plan %s in offer %s", planID, offerID)
 		utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"No such plan %s in offer %s"}`, planID, offerID))
 		return
 	}
 
 	log.Print("\tChecking if exists a contract for this Offer Plan")
-	contracts, err := getContractsByBuyerID(ch.contractsCollection, buyerID)
+	contracts, err := ch.contracts.ListByBuyerID(req.Context(), buyerID)
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
 
-	if len(*contracts) > 0 {
-		for _, contract := range *contracts {
-			if contract.Offer.OfferID == offerID && contract.PlanID == planID {
+	if len(contracts) > 0 {
+		for _, contract := range contracts {
+			if contract.Enabled && contract.Offer.OfferID == offerID && contract.PlanID == planID {
 				log.Print("\tContract for this Offer Plan already exists")
 				utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"contract for this Offer Plan already exists"}`))
 				return
@@ -196,6 +243,37 @@ func (ch *ContractsHandler) sellContract(w http.ResponseWriter, req *http.Reques
 		}
 	}
 
+	log.Print("\tChecking the capacity of the cluster")
+	resources, err := ch.clusterResources(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	ch.sellMutex.Lock()
+	defer ch.sellMutex.Unlock()
+	ledger, err := ch.capacityLedger(req.Context(), resources)
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	if err := checkCapacity(ledger, plan); err != nil {
+		log.Printf("\tRejecting contract: %s", err)
+		utils.WriteResponseError(w, 409, err)
+		return
+	}
+
+	log.Print("\tReserving a unit of the plan")
+	offer, err = ch.offersHandler.ReservePlan(offerID, planID)
+	if errors.Is(err, connector.ErrSoldOut) {
+		log.Printf("\tRejecting contract: %s", err)
+		utils.WriteResponseError(w, 409, err)
+		return
+	}
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+
 	log.Print("\tStipulating a new contract")
 	contractID := uuid.New().String()
 	contract := &contractsv1alpha1.ContractDocument{
@@ -211,13 +289,55 @@ func (ch *ContractsHandler) sellContract(w http.ResponseWriter, req *http.Reques
 		Enabled: true,
 		Created: time.Now().Unix(),
 	}
-
-	log.Printf("\tStoring contract %v", contract)
-	err = storeContract(ch.contractsCollection, contract)
+	if contract.Price, err = contractPrice(contract); err == nil {
+		log.Printf("\tStoring contract %v", contract)
+		err = ch.contracts.Insert(req.Context(), contract)
+	}
 	if err != nil {
+		if err := ch.offersHandler.ReleasePlan(offerID, planID); err != nil {
+			log.Printf("\tFailed to release the reserved unit: %s", err)
+		}
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
 	log.Printf("Stipulated a new contract %s with buyer %s", contractID, contract.BuyerID)
 	utils.WriteResponse(w, contract, "contract", `Stipulated a new contract with buyer "`+contract.BuyerID+`"`, true)
 }
+
+// terminateContract disables a contract. If the contract has been sold by the local cluster,
+// the unit of the plan is given back to the offer.
+func (ch *ContractsHandler) terminateContract(w http.ResponseWriter, req *http.Request) {
+	ch.sellMutex.Lock()
+	defer ch.sellMutex.Unlock()
+
+	contractID := mux.Vars(req)["id"]
+	contract, err := ch.contracts.Get(req.Context(), contractID)
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteResponseError(w, 404, err)
+		return
+	}
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	if !contract.Enabled {
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"contract %s is already terminated"}`, contractID))
+		return
+	}
+
+	contract.Enabled = false
+	contract.Revision++
+	if err := ch.contracts.Upsert(req.Context(), contract); err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	log.Printf("Terminated contract %s with buyer %s", contractID, contract.BuyerID)
+
+	if contract.Seller.ClusterID == ch.catalogConnector.ClusterParameters.ClusterID {
+		if err := ch.offersHandler.ReleasePlan(contract.Offer.OfferID, contract.PlanID); err != nil {
+			log.Printf("\tFailed to release the unit of plan %s: %s", contract.PlanID, err)
+		}
+	}
+	w.Header().Set("ETag", utils.ETag(contract.Revision))
+	utils.WriteResponse(w, contract, "contract", "", false)
+}
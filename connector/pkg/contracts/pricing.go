@@ -0,0 +1,36 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"fmt"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// contractPrice computes the price of the contract from the pricing model of its plan,
+// as it is in the copy of the offer stored with the contract.
+func contractPrice(contract *contractsv1alpha1.ContractDocument) (*catalogv1alpha1.Price, error) {
+	plan := findPlan(&contract.Offer, contract.PlanID)
+	if plan == nil {
+		return nil, fmt.Errorf(`{"error":"No such plan %s in offer %s"}`, contract.PlanID, contract.Offer.OfferID)
+	}
+	price, err := plan.Price()
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"computing the price of plan %s: %s"}`, contract.PlanID, err)
+	}
+	return price, nil
+}
@@ -15,44 +15,14 @@
 package contracts
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
-	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func getAllContracts(c *mongo.Collection) ([]contractsv1alpha1.ContractDocument, error) {
-	contractsCursor, err := c.Find(context.Background(), bson.D{})
-	if err != nil {
-		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
-	}
-	var contracts []contractsv1alpha1.ContractDocument
-	if err = contractsCursor.All(context.Background(), &contracts); err != nil {
-		return nil, fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
-	}
-	return contracts, nil
-}
-
-func getContractsByBuyerID(c *mongo.Collection, buyerID string) (*[]contractsv1alpha1.ContractDocument, error) {
-	var contracts []contractsv1alpha1.ContractDocument
-	filter := bson.D{{Key: "buyer-cluster-id", Value: buyerID}}
-	contractsCursor, err := c.Find(context.Background(), filter)
-	if err != nil {
-		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
-	}
-	if err = contractsCursor.All(context.Background(), &contracts); err != nil {
-		return nil, fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
-	}
-	return &contracts, nil
-}
-
 func makeRequest(seller connectorv1alpha1.Provider, offerID, buyerID, planID string) (*http.Response, error) {
 	// clean extra / at the end of the endpoint
 	buyReq, err := http.NewRequest("POST", fmt.Sprintf(seller.ClusterContractEndpoint+"/api/contracts/sell?offer-id=%s&buyer-id=%s&plan-id=%s", offerID, buyerID, planID), nil)
@@ -76,11 +46,3 @@ func makeRequest(seller connectorv1alpha1.Provider, offerID, buyerID, planID str
 	}
 	return res, nil
 }
-
-func storeContract(c *mongo.Collection, contract *contractsv1alpha1.ContractDocument) error {
-	_, err := c.InsertOne(context.Background(), contract)
-	if err != nil {
-		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
-	}
-	return nil
-}
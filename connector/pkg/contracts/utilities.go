@@ -16,6 +16,7 @@ package contracts
 
 import (
 	//"bytes"
+	"context"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
@@ -27,22 +28,28 @@ import (
 
 // TODO: to be implemented and to understand if it is necessary to manager here some errors of deeper in calling stack
 func (ch *ContractsHandler) GetContractResources(ClusterID string) (*corev1.ResourceList, error) {
-	var resources *corev1.ResourceList
-	contracts, err := getContractsByBuyerID(ch.contractsCollection, ClusterID)
+	documents, err := ch.contracts.ListByBuyerID(context.Background(), ClusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(*contracts) == 0 {
+	// terminated contracts gave their units back to the plans, their resources are no longer the buyer's
+	contracts := make([]contractsv1alpha1.ContractDocument, 0, len(documents))
+	for _, contract := range documents {
+		if contract.Enabled {
+			contracts = append(contracts, contract)
+		}
+	}
+
+	if len(contracts) == 0 {
 		return nil, fmt.Errorf(`{"error":"No contracts found for cluster %s"}`, ClusterID)
 	}
 
-	if len(*contracts) > 1 {
-		resources = multipleContractLogic(*contracts)
-		return resources, nil
+	if len(contracts) > 1 {
+		return multipleContractLogic(contracts)
 	}
 
-	contract := (*contracts)[0]
+	contract := contracts[0]
 	var plan catalogv1alpha1.Plan
 	for _, candidatePlan := range contract.Offer.Plans {
 		if candidatePlan.PlanID == contract.PlanID {
@@ -50,12 +57,13 @@ func (ch *ContractsHandler) GetContractResources(ClusterID string) (*corev1.Reso
 			break
 		}
 	}
-	resources = mapQuantityToResourceList(plan.PlanResources)
-
-	return resources, nil
+	return mapQuantityToResourceList(plan.PlanResources)
 }
 
-func multipleContractLogic(contracts []contractsv1alpha1.ContractDocument) *corev1.ResourceList {
+// multipleContractLogic sums the resources of the plans bought with the contracts.
+// Offers are validated before storage, but contracts stipulated earlier may still hold invalid quantities:
+// they are reported as errors instead of panicking in the gRPC server.
+func multipleContractLogic(contracts []contractsv1alpha1.ContractDocument) (*corev1.ResourceList, error) {
 	resources := corev1.ResourceList{}
 	for _, contract := range contracts {
 		var plan catalogv1alpha1.Plan
@@ -66,23 +74,31 @@ func multipleContractLogic(contracts []contractsv1alpha1.ContractDocument) *core
 			}
 		}
 		for key, value := range plan.PlanResources {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				return nil, fmt.Errorf(`{"error":"invalid %s quantity %q in contract %s: %s"}`, key, value, contract.ContractID, err)
+			}
 			if prevRes, ok := resources[corev1.ResourceName(key)]; !ok {
 
-				resources[corev1.ResourceName(key)] = resource.MustParse(value)
+				resources[corev1.ResourceName(key)] = quantity
 
 			} else {
-				prevRes.Add(resource.MustParse(value))
+				prevRes.Add(quantity)
 				resources[corev1.ResourceName(key)] = prevRes
 			}
 		}
 	}
-	return &resources
+	return &resources, nil
 }
 
-func mapQuantityToResourceList(res map[string]string) *corev1.ResourceList {
+func mapQuantityToResourceList(res map[string]string) (*corev1.ResourceList, error) {
 	resources := corev1.ResourceList{}
 	for key, value := range res {
-		resources[corev1.ResourceName(key)] = resource.MustParse(value)
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf(`{"error":"invalid %s quantity %q: %s"}`, key, value, err)
+		}
+		resources[corev1.ResourceName(key)] = quantity
 	}
-	return &resources
+	return &resources, nil
 }
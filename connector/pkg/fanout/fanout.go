@@ -0,0 +1,143 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fanout runs the same call against many brokers concurrently, so that a slow or hung broker
+// does not hold up the others.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+)
+
+const (
+	// DefaultParallelism is the number of brokers called at the same time by default
+	DefaultParallelism = 8
+	// DefaultTimeout is the time every broker has to complete a call by default
+	DefaultTimeout = 30 * time.Second
+)
+
+// Call is run once for every broker, with a context that expires at the deadline of the broker.
+// The value it returns is reported in the Result of the broker.
+type Call func(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error)
+
+// Result is the outcome of the call on a broker.
+type Result struct {
+	BrokerID string
+	Value    interface{}
+	Err      error
+	Elapsed  time.Duration
+}
+
+// Results holds the result of every broker, in the order the brokers were given.
+type Results []Result
+
+// Succeeded returns the IDs of the brokers whose call succeeded.
+func (r Results) Succeeded() []string {
+	ids := []string{}
+	for _, result := range r {
+		if result.Err == nil {
+			ids = append(ids, result.BrokerID)
+		}
+	}
+	return ids
+}
+
+// Failed returns the errors of the brokers whose call failed, keyed by broker ID.
+func (r Results) Failed() map[string]error {
+	failures := make(map[string]error)
+	for _, result := range r {
+		if result.Err != nil {
+			failures[result.BrokerID] = result.Err
+		}
+	}
+	return failures
+}
+
+// Err returns an error listing every failed broker, or nil if every call succeeded.
+func (r Results) Err() error {
+	messages := []string{}
+	for brokerID, err := range r.Failed() {
+		messages = append(messages, fmt.Sprintf("broker %s: %s", brokerID, err))
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	sort.Strings(messages)
+	return fmt.Errorf("%d of %d brokers failed: %s", len(messages), len(r), strings.Join(messages, "; "))
+}
+
+// Executor calls many brokers concurrently, a bounded number at a time, giving each one its own deadline.
+type Executor struct {
+	parallelism int
+	timeout     time.Duration
+}
+
+// NewExecutor returns an Executor calling at most parallelism brokers at a time, each for at most timeout.
+// Non-positive values select the defaults.
+func NewExecutor(parallelism int, timeout time.Duration) *Executor {
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Executor{parallelism: parallelism, timeout: timeout}
+}
+
+// WithTimeout returns a context that expires at the deadline given to a single broker call.
+func (e *Executor) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+// Run calls fn on every broker and waits for every call to return. A call that has not started
+// when ctx is done fails with the error of ctx.
+func (e *Executor) Run(ctx context.Context, brokers []brokerv1alpha1.BrokerDocument, fn Call) Results {
+	results := make(Results, len(brokers))
+	slots := make(chan struct{}, e.parallelism)
+	var wg sync.WaitGroup
+	for i := range brokers {
+		results[i].BrokerID = brokers[i].ID
+		select {
+		case slots <- struct{}{}:
+			// select picks at random when a slot frees up as ctx is done: never start a call after that
+			if err := ctx.Err(); err != nil {
+				<-slots
+				results[i].Err = err
+				continue
+			}
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			callCtx, cancel := e.WithTimeout(ctx)
+			defer cancel()
+			start := time.Now()
+			results[i].Value, results[i].Err = fn(callCtx, &brokers[i])
+			results[i].Elapsed = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
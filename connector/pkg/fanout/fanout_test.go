@@ -0,0 +1,163 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+)
+
+func testBrokers(n int) []brokerv1alpha1.BrokerDocument {
+	brokers := make([]brokerv1alpha1.BrokerDocument, n)
+	for i := range brokers {
+		brokers[i].ID = fmt.Sprintf("b%d", i)
+	}
+	return brokers
+}
+
+func TestRunBoundsParallelism(t *testing.T) {
+	tests := []struct {
+		parallelism int
+		brokers     int
+	}{
+		{parallelism: 1, brokers: 4},
+		{parallelism: 3, brokers: 10},
+		{parallelism: 8, brokers: 5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d of %d", tt.parallelism, tt.brokers), func(t *testing.T) {
+			var running, peak int32
+			results := NewExecutor(tt.parallelism, time.Second).Run(context.Background(), testBrokers(tt.brokers),
+				func(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+					now := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					for {
+						max := atomic.LoadInt32(&peak)
+						if now <= max || atomic.CompareAndSwapInt32(&peak, max, now) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					return broker.ID, nil
+				})
+			if peak > int32(tt.parallelism) {
+				t.Errorf("%d calls ran at the same time, want at most %d", peak, tt.parallelism)
+			}
+			if len(results.Succeeded()) != tt.brokers {
+				t.Errorf("%d calls succeeded, want %d", len(results.Succeeded()), tt.brokers)
+			}
+			for i, result := range results {
+				if result.BrokerID != fmt.Sprintf("b%d", i) || result.Value != result.BrokerID {
+					t.Errorf("result %d = %+v, want the result of b%d", i, result, i)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTimesOutHungCalls(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	start := time.Now()
+	results := NewExecutor(2, timeout).Run(context.Background(), testBrokers(6),
+		func(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+			if broker.ID == "b0" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return nil, nil
+		})
+	if elapsed := time.Since(start); elapsed > 10*timeout {
+		t.Errorf("Run() took %s with a timeout of %s", elapsed, timeout)
+	}
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) || results[0].Elapsed < timeout {
+		t.Errorf("hung call = %+v, want it timed out after %s", results[0], timeout)
+	}
+	for _, result := range results[1:] {
+		if result.Err != nil || result.Elapsed >= timeout {
+			t.Errorf("call on %s = %+v, want it not held up by the hung call", result.BrokerID, result)
+		}
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int32
+	results := NewExecutor(1, time.Second).Run(ctx, testBrokers(4),
+		func(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			cancel()
+			return nil, nil
+		})
+	if calls != 1 {
+		t.Errorf("%d calls started, want 1", calls)
+	}
+	if results[0].Err != nil {
+		t.Errorf("the call started before the cancellation failed: %v", results[0].Err)
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("call on %s = %v, want %v", result.BrokerID, result.Err, context.Canceled)
+		}
+	}
+}
+
+func TestResults(t *testing.T) {
+	errDown := errors.New("down")
+	errSlow := errors.New("slow")
+	tests := []struct {
+		name      string
+		results   Results
+		succeeded []string
+		failed    map[string]error
+		err       string
+	}{
+		{name: "empty", results: Results{}, succeeded: []string{}, failed: map[string]error{}},
+		{
+			name:      "every call succeeded",
+			results:   Results{{BrokerID: "b1"}, {BrokerID: "b2"}},
+			succeeded: []string{"b1", "b2"},
+			failed:    map[string]error{},
+		},
+		{
+			name:      "some calls failed",
+			results:   Results{{BrokerID: "b3", Err: errSlow}, {BrokerID: "b1"}, {BrokerID: "b2", Err: errDown}},
+			succeeded: []string{"b1"},
+			failed:    map[string]error{"b2": errDown, "b3": errSlow},
+			err:       "2 of 3 brokers failed: broker b2: down; broker b3: slow",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.results.Succeeded(); !reflect.DeepEqual(got, tt.succeeded) {
+				t.Errorf("Succeeded() = %v, want %v", got, tt.succeeded)
+			}
+			if got := tt.results.Failed(); !reflect.DeepEqual(got, tt.failed) {
+				t.Errorf("Failed() = %v, want %v", got, tt.failed)
+			}
+			err := tt.results.Err()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Errorf("Err() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keyring implements the envelope encryption of the credentials stored by the connector.
+//
+// Every value is encrypted with a fresh AES-256-GCM data key, which is in turn encrypted (wrapped)
+// with a key encryption key read from a Kubernetes Secret. The Secret holds one entry of exactly 32 bytes
+// per key encryption key, plus an optional "primary" entry naming the key used to encrypt new values:
+// old keys can be kept in the Secret until every value has been re-encrypted with the primary one.
+package keyring
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	primaryKey = "primary" // Secret entry naming the key used for encryption
+	keySize    = 32        // size of the key encryption keys and of the data keys (AES-256)
+	prefix     = "enc:v1:" // prefix of the encrypted values
+)
+
+// ErrUnknownKey is returned when a value has been encrypted with a key that is no longer in the Secret.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds the key encryption keys loaded from a Kubernetes Secret.
+type Keyring struct {
+	kclient   kubernetes.Interface
+	namespace string
+	name      string
+
+	mu      sync.RWMutex
+	primary string
+	keys    map[string][]byte
+}
+
+// Load reads the keys from the Secret namespace/name.
+func Load(ctx context.Context, kclient kubernetes.Interface, namespace, name string) (*Keyring, error) {
+	k := &Keyring{kclient: kclient, namespace: namespace, name: name}
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads again the keys from the Secret, so that a rotated key is used for the next encryptions.
+func (k *Keyring) Reload(ctx context.Context) error {
+	secret, err := k.kclient.CoreV1().Secrets(k.namespace).Get(ctx, k.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading secret %s/%s: %w", k.namespace, k.name, err)
+	}
+
+	keys := make(map[string][]byte)
+	for id, value := range secret.Data {
+		if id == primaryKey {
+			continue
+		}
+		if len(value) != keySize {
+			return fmt.Errorf("secret %s/%s: key %s must be %d bytes long, got %d", k.namespace, k.name, id, keySize, len(value))
+		}
+		keys[id] = value
+	}
+
+	primary := strings.TrimSpace(string(secret.Data[primaryKey]))
+	switch {
+	case primary != "":
+		if _, ok := keys[primary]; !ok {
+			return fmt.Errorf("secret %s/%s: primary key %s not found", k.namespace, k.name, primary)
+		}
+	case len(keys) == 1:
+		for id := range keys {
+			primary = id
+		}
+	default:
+		ids := make([]string, 0, len(keys))
+		for id := range keys {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return fmt.Errorf("secret %s/%s: a %q entry is required to choose among keys %v", k.namespace, k.name, primaryKey, ids)
+	}
+
+	k.mu.Lock()
+	k.primary = primary
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Primary returns the ID of the key used to encrypt new values.
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// Encrypt returns the envelope of plaintext, in the form enc:v1:<key id>:<wrapped data key>:<ciphertext>.
+// Empty values are left empty.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	k.mu.RLock()
+	id, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(kek, dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens a value returned by Encrypt. Values without the envelope prefix have been written
+// before encryption was enabled and are returned unchanged.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	k.mu.RLock()
+	kek, ok := k.keys[parts[0]]
+	k.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, parts[0])
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	dek, err := open(kek, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("unwrapping data key: %w", err)
+	}
+	plaintext, err := open(dek, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value has been produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// seal encrypts data with AES-GCM, prepending the random nonce to the result
+func seal(key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts the output of seal
+func open(key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
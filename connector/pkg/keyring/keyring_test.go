@@ -0,0 +1,241 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "fluidos"
+	testSecret    = "connector-keys"
+)
+
+func testKey(b byte) []byte {
+	return []byte(strings.Repeat(string(rune(b)), keySize))
+}
+
+func loadKeyring(t *testing.T, data map[string][]byte) (*Keyring, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecret},
+		Data:       data,
+	})
+	k, err := Load(context.Background(), client, testNamespace, testSecret)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return k, client
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		primary string
+		wantErr string
+	}{
+		{name: "single key is primary", data: map[string][]byte{"k1": testKey('a')}, primary: "k1"},
+		{name: "primary entry", data: map[string][]byte{"k1": testKey('a'), "k2": testKey('b'), primaryKey: []byte("k2\n")}, primary: "k2"},
+		{name: "several keys without primary", data: map[string][]byte{"k1": testKey('a'), "k2": testKey('b')}, wantErr: `"primary" entry is required`},
+		{name: "unknown primary", data: map[string][]byte{"k1": testKey('a'), primaryKey: []byte("k3")}, wantErr: "primary key k3 not found"},
+		{name: "short key", data: map[string][]byte{"k1": []byte("short")}, wantErr: "must be 32 bytes long"},
+		{name: "no keys", data: map[string][]byte{}, wantErr: `"primary" entry is required`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecret},
+				Data:       tt.data,
+			})
+			k, err := Load(context.Background(), client, testNamespace, testSecret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := k.Primary(); got != tt.primary {
+				t.Errorf("Primary() = %q, want %q", got, tt.primary)
+			}
+		})
+	}
+}
+
+func TestLoadMissingSecret(t *testing.T) {
+	if _, err := Load(context.Background(), fake.NewSimpleClientset(), testNamespace, testSecret); err == nil {
+		t.Fatal("Load() of a missing secret succeeded")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k, _ := loadKeyring(t, map[string][]byte{"k1": testKey('a')})
+	for _, plaintext := range []string{"", "token", "eyJhbGciOiJIUzI1NiJ9.payload.signature", "ünïcödé:with:colons"} {
+		encrypted, err := k.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q) error = %v", plaintext, err)
+		}
+		if plaintext == "" {
+			if encrypted != "" {
+				t.Errorf("Encrypt(\"\") = %q, want empty", encrypted)
+			}
+			continue
+		}
+		if !IsEncrypted(encrypted) || !strings.HasPrefix(encrypted, prefix+"k1:") {
+			t.Errorf("Encrypt(%q) = %q, want the envelope of key k1", plaintext, encrypted)
+		}
+		if strings.Contains(encrypted, plaintext) {
+			t.Errorf("Encrypt(%q) = %q contains the plaintext", plaintext, encrypted)
+		}
+		decrypted, err := k.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decrypt(%q) error = %v", encrypted, err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q", plaintext, decrypted)
+		}
+	}
+}
+
+func TestEncryptUsesFreshDataKeys(t *testing.T) {
+	k, _ := loadKeyring(t, map[string][]byte{"k1": testKey('a')})
+	first, _ := k.Encrypt("token")
+	second, _ := k.Encrypt("token")
+	if first == second {
+		t.Errorf("Encrypt() returned the same envelope twice: %q", first)
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	k, _ := loadKeyring(t, map[string][]byte{"k1": testKey('a')})
+	valid, err := k.Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(valid, prefix), ":")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "plaintext is returned unchanged", value: "legacy-token", want: "legacy-token"},
+		{name: "empty", value: "", want: ""},
+		{name: "valid", value: valid, want: "token"},
+		{name: "unknown key", value: prefix + "k9:" + parts[1] + ":" + parts[2], wantErr: ErrUnknownKey.Error()},
+		{name: "missing part", value: prefix + "k1:" + parts[1], wantErr: "malformed encrypted value"},
+		{name: "bad data key encoding", value: prefix + "k1:!!!:" + parts[2], wantErr: "malformed data key"},
+		{name: "bad ciphertext encoding", value: prefix + "k1:" + parts[1] + ":!!!", wantErr: "malformed ciphertext"},
+		{name: "swapped parts", value: prefix + "k1:" + parts[2] + ":" + parts[1], wantErr: "unwrapping data key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := k.Decrypt(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decrypt() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	k, client := loadKeyring(t, map[string][]byte{"k1": testKey('a')})
+	old, err := k.Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new primary key is added, the old one is kept to read the values not re-encrypted yet
+	secrets := client.CoreV1().Secrets(testNamespace)
+	secret, err := secrets.Get(ctx, testSecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data["k2"] = testKey('b')
+	secret.Data[primaryKey] = []byte("k2")
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := k.Primary(); got != "k2" {
+		t.Fatalf("Primary() = %q after rotation, want k2", got)
+	}
+
+	if got, err := k.Decrypt(old); err != nil || got != "token" {
+		t.Errorf("Decrypt() of a value of the old key = %q, %v", got, err)
+	}
+	rotated, err := k.Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rotated, prefix+"k2:") {
+		t.Errorf("Encrypt() after rotation = %q, want the envelope of key k2", rotated)
+	}
+
+	// once the old key is removed, its values cannot be read anymore
+	delete(secret.Data, "k1")
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := k.Decrypt(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt() of a value of a removed key error = %v, want ErrUnknownKey", err)
+	}
+	if got, err := k.Decrypt(rotated); err != nil || got != "token" {
+		t.Errorf("Decrypt() of a value of the new key = %q, %v", got, err)
+	}
+}
+
+func TestReloadKeepsKeysOnError(t *testing.T) {
+	ctx := context.Background()
+	k, client := loadKeyring(t, map[string][]byte{"k1": testKey('a')})
+	secrets := client.CoreV1().Secrets(testNamespace)
+	secret, _ := secrets.Get(ctx, testSecret, metav1.GetOptions{})
+	secret.Data[primaryKey] = []byte("missing")
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reload(ctx); err == nil {
+		t.Fatal("Reload() with an unknown primary succeeded")
+	}
+	if got := k.Primary(); got != "k1" {
+		t.Errorf("Primary() = %q after a failed reload, want k1", got)
+	}
+}
@@ -28,6 +28,8 @@ import (
 	discoveryv1alpha1 "github.com/liqotech/liqo/apis/discovery/v1alpha1"
 	sharingv1alpha1 "github.com/liqotech/liqo/apis/sharing/v1alpha1"
 	liqorestcfg "github.com/liqotech/liqo/pkg/utils/restcfg"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 )
 
 var (
@@ -39,6 +41,7 @@ func init() {
 	_ = sharingv1alpha1.AddToScheme(scheme)
 	_ = metricsv1beta1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = catalogv1alpha1.AddToScheme(scheme)
 }
 
 // GetKClient creates a kubernetes API client and returns it.
@@ -59,3 +62,14 @@ func GetClient(ctx context.Context) (CRC client.Client, KC kubernetes.Interface,
 
 	return cl, kcl, nil
 }
+
+// GetManager creates a controller-runtime manager sharing the scheme of the clients, to run the controllers of the connector.
+// The metrics and health probe endpoints are disabled, and there is no leader election: a single connector runs per cluster.
+func GetManager() (ctrl.Manager, error) {
+	config := liqorestcfg.SetRateLimiter(ctrl.GetConfigOrDie())
+	return ctrl.NewManager(config, ctrl.Options{
+		Scheme:                 scheme,
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: "0",
+	})
+}
@@ -17,9 +17,9 @@ package liqocontroller
 import (
 	"context"
 	"fmt"
-	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
@@ -27,8 +27,6 @@ import (
 	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	discoveryv1alpha1 "github.com/liqotech/liqo/apis/discovery/v1alpha1"
-	sharingv1alpha1 "github.com/liqotech/liqo/apis/sharing/v1alpha1"
 	liqoconsts "github.com/liqotech/liqo/pkg/consts"
 	liqogetters "github.com/liqotech/liqo/pkg/utils/getters"
 	liqolabels "github.com/liqotech/liqo/pkg/utils/labels"
@@ -37,48 +35,32 @@ import (
 	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 )
 
+// GetClusterResources computes the resources of the physical nodes of the local cluster:
+//   - Total is the allocatable capacity of the schedulable nodes;
+//   - Allocated is the sum of the requests of the pods running on them;
+//   - Used is the actual usage of those pods, empty if the metrics server is not available;
+//   - Available is Total minus Allocated.
+//
+// Virtual nodes are skipped, since their resources belong to remote clusters.
 func GetClusterResources(ctx context.Context, cl client.Client) (*connectorv1alpha1.ClusterResources, error) {
-	nodeList := &corev1.NodeList{}
-	resourceOfferList := &sharingv1alpha1.ResourceOfferList{}
-
-	selector := metav1.LabelSelector{
-		MatchExpressions: []metav1.LabelSelectorRequirement{
-			{
-				Key:      liqoconsts.NodeFinalizer,
-				Operator: metav1.LabelSelectorOperator(selection.DoesNotExist),
-				Values:   []string{"virtual-node"},
-			},
-		},
-	}
-
-	listOptions := []client.ListOption{
-		client.MatchingLabelsSelector{
-			Selector: labels.SelectorFromSet(selector.MatchLabels),
-		},
-	}
-
-	if err := cl.List(ctx, nodeList, listOptions...); err != nil {
+	virtualNode, err := labels.NewRequirement(liqoconsts.TypeLabel, selection.NotEquals, []string{liqoconsts.TypeNode})
+	if err != nil {
 		return nil, err
 	}
-
-	selector = metav1.LabelSelector{
-		MatchExpressions: []metav1.LabelSelectorRequirement{
-			{
-				Key:      liqoconsts.ReplicationRequestedLabel,
-				Operator: metav1.LabelSelectorOperator(selection.Equals),
-				Values:   []string{strconv.FormatBool(true)},
-			},
-		},
-	}
-
-	listOptions = []client.ListOption{
-		client.MatchingLabelsSelector{
-			Selector: labels.SelectorFromSet(selector.MatchLabels),
-		},
+	nodeList := &corev1.NodeList{}
+	if err := cl.List(ctx, nodeList, client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*virtualNode)}); err != nil {
+		return nil, err
 	}
 
-	if err := cl.List(ctx, resourceOfferList, listOptions...); err != nil {
-		return nil, err
+	total := corev1.ResourceList{}
+	nodes := make(map[string]bool)
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if node.Spec.Unschedulable {
+			continue
+		}
+		nodes[node.Name] = true
+		AddResourceList(total, node.Status.Allocatable)
 	}
 
 	podList := &corev1.PodList{}
@@ -86,49 +68,51 @@ func GetClusterResources(ctx context.Context, cl client.Client) (*connectorv1alp
 		return nil, err
 	}
 
-	foreignClusterList := &discoveryv1alpha1.ForeignClusterList{}
-	err := cl.List(ctx, foreignClusterList)
-	if err != nil {
-		klog.Errorf("error retrieving foreign clusters: %s", err)
-		return nil, err
+	allocated := corev1.ResourceList{}
+	pods := make(map[string]bool)
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !nodes[pod.Spec.NodeName] || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pods[pod.Namespace+"/"+pod.Name] = true
+		AddResourceList(allocated, podRequests(pod))
 	}
 
+	used := corev1.ResourceList{}
 	podMetricsList := &metricsv1beta1.PodMetricsList{}
-
-	err = cl.List(ctx, podMetricsList, client.MatchingLabels{
-		liqoconsts.LocalPodLabelKey: "true",
-	})
-	if err != nil {
-		klog.Warningf("error retrieving pod metrics: %s", err)
-		return nil, err
+	if err := cl.List(ctx, podMetricsList); err != nil {
+		klog.Warningf("error retrieving pod metrics, used resources not available: %s", err)
+	} else {
+		for i := range podMetricsList.Items {
+			podMetrics := &podMetricsList.Items[i]
+			if !pods[podMetrics.Namespace+"/"+podMetrics.Name] {
+				continue
+			}
+			for _, container := range podMetrics.Containers {
+				AddResourceList(used, container.Usage)
+			}
+		}
 	}
 
-	podMetricsMap := podMetricListToMap(podMetricsList.Items)
-
-	var clusters []ClusterDto
-	for i := range foreignClusterList.Items {
-		clusterDto := fromForeignCluster(&foreignClusterList.Items[i])
-
-		if isPeeringEstablished(clusterDto.OutgoingPeering) {
-			klog.V(5).Infof("Calculating outgoing resources for cluster %s", clusterDto.clusterID)
-			outgoingResources, err := calculateOutgoingResources(ctx, cl, clusterDto.clusterID, podMetricsMap)
-			if err == nil {
-				clusterDto.OutgoingResources = outgoingResources
-			} // otherwise, the outgoing resources are not calculated so they are nil
+	available := corev1.ResourceList{}
+	for name, quantity := range total {
+		free := quantity.DeepCopy()
+		if request, ok := allocated[name]; ok {
+			free.Sub(request)
 		}
-
-		if isPeeringEstablished(clusterDto.IncomingPeering) {
-			incomingResources, err := calculateIncomingResources(ctx, cl, clusterDto.clusterID)
-			if err == nil {
-				clusterDto.IncomingResources = incomingResources
-			} // otherwise, the incoming resources are not calculated so they are nil
+		if free.Sign() < 0 {
+			free = *resource.NewQuantity(0, quantity.Format)
 		}
-
-		// in this moment clusters without any resource are also added to the list but we can decide to filter them
-		clusters = append(clusters, *clusterDto)
+		available[name] = free
 	}
 
-	return &connectorv1alpha1.ClusterResources{}, nil
+	return &connectorv1alpha1.ClusterResources{
+		TotalResources:     &total,
+		AllocatedResources: &allocated,
+		UsedResources:      &used,
+		AvailableResources: &available,
+	}, nil
 }
 
 func calculateOutgoingResources(ctx context.Context, cl client.Client, clusterID string,
@@ -16,6 +16,7 @@ package liqocontroller
 
 import (
 	discoveryv1alpha1 "github.com/liqotech/liqo/apis/discovery/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
@@ -69,4 +70,34 @@ func statusOrDefault(
 		return "None"
 	}
 	return value.Status
-}
\ No newline at end of file
+}
+
+// AddResourceList adds every quantity of add to the corresponding one of list
+func AddResourceList(list, add corev1.ResourceList) {
+	for name, quantity := range add {
+		if current, ok := list[name]; ok {
+			current.Add(quantity)
+			list[name] = current
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// podRequests returns the resources requested by a pod, as computed by the scheduler:
+// the greater between the sum of the containers and the largest init container, plus the overhead
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for i := range pod.Spec.Containers {
+		AddResourceList(requests, pod.Spec.Containers[i].Resources.Requests)
+	}
+	for i := range pod.Spec.InitContainers {
+		for name, quantity := range pod.Spec.InitContainers[i].Resources.Requests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	AddResourceList(requests, pod.Spec.Overhead)
+	return requests
+}
@@ -0,0 +1,380 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	"connector/pkg/utils"
+	"connector/pkg/validation"
+)
+
+// maxImportSize bounds the size of an imported document
+const maxImportSize = 8 << 20
+
+// offerImport is an offer of an import, with the stored version it replaces (nil if it is new)
+type offerImport struct {
+	current *catalogv1alpha1.Offer
+	offer   catalogv1alpha1.Offer
+	changes []catalogv1alpha1.FieldChange
+}
+
+// getExport returns every offer as a JSON or YAML document, which can be imported again
+func (oh *OffersHandler) getExport(w http.ResponseWriter, req *http.Request) {
+	offers, err := oh.offers.List(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	bundle := catalogv1alpha1.OfferBundle{Offers: offers}
+	if bundle.Offers == nil {
+		bundle.Offers = []catalogv1alpha1.Offer{}
+	}
+
+	var body []byte
+	format := req.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		format = "json"
+		body, err = json.MarshalIndent(bundle, "", "  ")
+		w.Header().Set("Content-Type", "application/json")
+	case "yaml":
+		if body, err = json.Marshal(bundle); err == nil {
+			body, err = jsonToYAML(body)
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+	default:
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"unknown format %q, expected yaml or json"}`, format))
+		return
+	}
+	if err != nil {
+		utils.WriteResponseError(w, 500, fmt.Errorf(`{"error":"encoding offers: %s"}`, err))
+		return
+	}
+	log.Printf("Exported %d offers as %s", len(bundle.Offers), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="offers.`+format+`"`)
+	w.Write(body)
+}
+
+// postImport creates and updates the offers of a JSON or YAML document and, with prune, removes the offers missing
+// from it. Every offer is checked before anything is written, and the brokers are updated once at the end.
+// The units left of the stored plans are kept, unless reset-inventory is set.
+func (oh *OffersHandler) postImport(w http.ResponseWriter, req *http.Request) {
+	dryRun, err := boolParam(req, "dry-run")
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	prune, err := boolParam(req, "prune")
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	resetInventory, err := boolParam(req, "reset-inventory")
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(req.Body, maxImportSize+1))
+	if err != nil {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"reading offers: %s"}`, err))
+		return
+	}
+	if len(raw) > maxImportSize {
+		utils.WriteResponseError(w, 413, fmt.Errorf(`{"error":"the document exceeds %d bytes"}`, maxImportSize))
+		return
+	}
+	bundle, err := parseBundle(raw)
+	if err != nil {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"parsing offers: %s"}`, err))
+		return
+	}
+
+	imports, deletes, err := oh.planImport(req.Context(), bundle.Offers, prune, resetInventory)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			utils.WriteResponseError(w, 400, err)
+		} else {
+			utils.WriteResponseError(w, 500, err)
+		}
+		return
+	}
+
+	result := catalogv1alpha1.OfferImportResult{
+		DryRun:    dryRun,
+		Created:   []string{},
+		Updated:   []catalogv1alpha1.OfferChange{},
+		Deleted:   []string{},
+		Unchanged: []string{},
+	}
+	for _, imp := range imports {
+		switch {
+		case imp.current == nil:
+			result.Created = append(result.Created, imp.offer.OfferID)
+		case len(imp.changes) > 0:
+			result.Updated = append(result.Updated, catalogv1alpha1.OfferChange{OfferID: imp.offer.OfferID, Changes: imp.changes})
+		default:
+			result.Unchanged = append(result.Unchanged, imp.offer.OfferID)
+		}
+	}
+	for _, offer := range deletes {
+		result.Deleted = append(result.Deleted, offer.OfferID)
+	}
+	if dryRun {
+		utils.WriteResponse(w, result, "offer import", "", false)
+		return
+	}
+
+	if failed, err := oh.applyImport(req.Context(), imports, deletes); err != nil {
+		log.Printf("Failed to import %d offers: %s", failed, err)
+		utils.WriteResponseError(w, revisionErrorCode(err, false), err)
+		return
+	}
+	log.Printf("Imported offers: %d created, %d updated, %d deleted, %d unchanged",
+		len(result.Created), len(result.Updated), len(result.Deleted), len(result.Unchanged))
+	utils.WriteResponse(w, result, "offer import", "", false)
+}
+
+// parseBundle decodes a JSON document, or a YAML one converted to JSON, rejecting the unknown fields.
+// The amounts are decoded from their text, so that they keep every digit.
+func parseBundle(raw []byte) (*catalogv1alpha1.OfferBundle, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(trimmed, "{") {
+		converted, err := yamlToJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = converted
+	}
+	var bundle catalogv1alpha1.OfferBundle
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// planImport checks the imported offers against the stored ones and returns the offers to write and,
+// with prune, the stored offers to delete. It fails with validation.Errors listing every invalid offer.
+// The stored plans keep their units left, unless resetInventory is set.
+func (oh *OffersHandler) planImport(ctx context.Context, offers []catalogv1alpha1.Offer, prune, resetInventory bool) ([]offerImport, []catalogv1alpha1.Offer, error) {
+	stored, err := oh.offers.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]*catalogv1alpha1.Offer, len(stored))
+	for i := range stored {
+		byID[stored[i].OfferID] = &stored[i]
+	}
+
+	var errs validation.Errors
+	invalid := func(path, format string, args ...interface{}) {
+		errs = append(errs, validation.FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+	seen := make(map[string]int)
+	imports := make([]offerImport, 0, len(offers))
+	for i := range offers {
+		path := "offers[" + strconv.Itoa(i) + "]"
+		offer := offers[i]
+		if err := validation.ValidateOffer(&offer); err != nil {
+			for _, field := range err.(validation.Errors) {
+				invalid(path+"."+field.Field, "%s", field.Message)
+			}
+			continue
+		}
+		if prev, ok := seen[offer.OfferID]; ok {
+			invalid(path+".offerID", "duplicate of offers[%d].offerID %q", prev, offer.OfferID)
+			continue
+		}
+		seen[offer.OfferID] = i
+
+		current := byID[offer.OfferID]
+		// the fields owned by the connector are not imported
+		offer.Revision = 0
+		offer.ManagedBy = ""
+		for j := range offer.Plans {
+			offer.Plans[j].MonthlyEstimate = nil
+		}
+		if current != nil {
+			offer.Revision = current.Revision
+			offer.ManagedBy = current.ManagedBy
+			if !resetInventory {
+				keepInventory(&offer, current)
+			}
+			if offer.Created == 0 {
+				offer.Created = current.Created
+			}
+		} else if offer.Created == 0 {
+			offer.Created = time.Now().Unix()
+		}
+		if message := importStatus(&offer, current); message != "" {
+			invalid(path+".status", "%s", message)
+			continue
+		}
+		offer.UpdateSoldOut()
+
+		imp := offerImport{current: current, offer: offer}
+		if current != nil {
+			if imp.changes, err = diffOffers(current, &offer); err != nil {
+				return nil, nil, err
+			}
+			if len(imp.changes) > 0 && current.ManagedBy != "" {
+				invalid(path, "offer %s is managed by CatalogOffer %s", offer.OfferID, current.ManagedBy)
+				continue
+			}
+			if len(imp.changes) > 0 && current.Status == catalogv1alpha1.OfferRetired {
+				invalid(path, "offer %s is retired and cannot be modified", offer.OfferID)
+				continue
+			}
+		}
+		imports = append(imports, imp)
+	}
+
+	var deletes []catalogv1alpha1.Offer
+	if prune {
+		for i := range stored {
+			offer := &stored[i]
+			if _, ok := seen[offer.OfferID]; ok || offer.ManagedBy != "" || offer.Status == catalogv1alpha1.OfferRetired {
+				continue
+			}
+			deletes = append(deletes, *offer)
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].OfferID < deletes[j].OfferID })
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return imports, deletes, nil
+}
+
+// importStatus sets the status of an imported offer, keeping the stored one if the document has none,
+// and explains why the offer cannot move to it, if it cannot
+func importStatus(offer, current *catalogv1alpha1.Offer) string {
+	from := catalogv1alpha1.OfferDraft
+	if current != nil {
+		from = current.Status
+	}
+	if offer.Status == "" {
+		offer.Status = from
+	}
+	switch {
+	case offer.Status == from:
+	case offer.Status == catalogv1alpha1.OfferPublished && from == catalogv1alpha1.OfferSoldOut:
+		// UpdateSoldOut publishes it again if the document adds a plan with units left
+	case offer.Status == catalogv1alpha1.OfferSoldOut:
+		return "sold-out is set by the connector"
+	case !canTransition(from, offer.Status):
+		return fmt.Sprintf("cannot move from %s to %s", from, offer.Status)
+	}
+	if offer.Status == catalogv1alpha1.OfferPublished && len(offer.Plans) == 0 {
+		return "an offer without plans cannot be published"
+	}
+	return ""
+}
+
+// applyImport writes the imported offers, deletes the pruned ones, then updates the brokers once.
+// A failed write does not stop the others, and the brokers are updated with the offers written anyway:
+// the number of failed offers is returned with the first error.
+// Only the offers that left the brokers are withdrawn one by one, since SyncOffers only posts the listed offers.
+func (oh *OffersHandler) applyImport(ctx context.Context, imports []offerImport, deletes []catalogv1alpha1.Offer) (int, error) {
+	now := time.Now()
+	var withdrawn []string
+	failed := 0
+	var firstErr error
+	fail := func(offerID string, err error) {
+		log.Printf("\tFailed to import offer %s: %s", offerID, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed++
+	}
+
+	for _, imp := range imports {
+		if imp.current != nil && len(imp.changes) == 0 {
+			continue
+		}
+		revision := int64(0)
+		if imp.current != nil {
+			revision = imp.current.Revision
+		}
+		saved, err := oh.offers.Save(ctx, imp.offer, revision)
+		if err != nil {
+			fail(imp.offer.OfferID, err)
+			continue
+		}
+		oh.schedule(saved)
+		if imp.current != nil {
+			if listed(imp.current, now) && !listed(saved, now) {
+				withdrawn = append(withdrawn, saved.OfferID)
+			} else if err := oh.withdrawFromRemovedBrokers(imp.current, saved); err != nil {
+				log.Printf("Failed to withdraw offer: %s", err)
+			}
+		}
+	}
+
+	for i := range deletes {
+		offer := &deletes[i]
+		if offer.Status == catalogv1alpha1.OfferDraft {
+			if err := oh.offers.Delete(ctx, offer.OfferID, offer.Revision); err != nil {
+				fail(offer.OfferID, err)
+			}
+			continue
+		}
+		if _, err := oh.transition(ctx, offer.OfferID, catalogv1alpha1.OfferRetired, offer.Revision); err != nil {
+			fail(offer.OfferID, err)
+			continue
+		}
+		if listed(offer, now) {
+			withdrawn = append(withdrawn, offer.OfferID)
+		}
+	}
+
+	for _, offerID := range withdrawn {
+		if err := oh.synchronizeSingleOffer(offerID, true); err != nil {
+			log.Printf("Failed to withdraw offer: %s", err)
+		}
+	}
+	if err := oh.SyncOffers(); err != nil {
+		log.Printf("Failed to synchronize offers: %s", err)
+	}
+	return failed, firstErr
+}
+
+func boolParam(req *http.Request, name string) (bool, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf(`{"error":"invalid %s %q, expected true or false"}`, name, value)
+	}
+	return b, nil
+}
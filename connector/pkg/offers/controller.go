@@ -0,0 +1,240 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"connector/pkg/store"
+	"connector/pkg/validation"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+const (
+	// offerFinalizer keeps a CatalogOffer until its offer has been withdrawn from the brokers
+	offerFinalizer = "catalog.connector.io/withdraw-offer"
+	// brokerRetryInterval is the delay before checking again the changes not delivered to the brokers yet
+	brokerRetryInterval = time.Minute
+)
+
+// offerReconciler mirrors the CatalogOffer resources into the offers store and the brokers
+type offerReconciler struct {
+	client        client.Client
+	offersHandler *OffersHandler
+}
+
+// SetupOfferController registers with mgr the controller of the CatalogOffer resources, which reads and writes them with cl.
+func (oh *OffersHandler) SetupOfferController(mgr ctrl.Manager, cl client.Client) error {
+	r := &offerReconciler{client: cl, offersHandler: oh}
+	// status updates do not change the generation, so they do not trigger a new reconciliation
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&catalogv1alpha1.CatalogOffer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+func (r *offerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var cr catalogv1alpha1.CatalogOffer
+	if err := r.client.Get(ctx, req.NamespacedName, &cr); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	owner := req.NamespacedName.String()
+	offerID := cr.Spec.OfferID
+	if offerID == "" {
+		offerID = cr.Name
+	}
+
+	if !cr.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&cr, offerFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.offersHandler.withdrawManagedOffer(ctx, offerID, owner); err != nil {
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(&cr, offerFinalizer)
+		return ctrl.Result{}, r.client.Update(ctx, &cr)
+	}
+	if !controllerutil.ContainsFinalizer(&cr, offerFinalizer) {
+		controllerutil.AddFinalizer(&cr, offerFinalizer)
+		if err := r.client.Update(ctx, &cr); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	offer, message, err := r.offersHandler.applyCatalogOffer(ctx, &cr, offerID, owner)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	status := catalogv1alpha1.CatalogOfferStatus{
+		ObservedGeneration: cr.Generation,
+		OfferID:            offerID,
+		Message:            message,
+	}
+	if message != "" {
+		// the spec is not retried until it changes
+		log.Printf("CatalogOffer %s not applied: %s", owner, message)
+		return ctrl.Result{}, r.updateStatus(ctx, &cr, status)
+	}
+
+	status.Revision = offer.Revision
+	status.Status = offer.Status
+	// the changes are queued once per revision, the outbox retries them until they are delivered
+	if offer.Revision != cr.Status.Revision {
+		if err := r.offersHandler.synchronizeSingleOffer(offerID, false); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	pending, err := r.offersHandler.pendingSync(ctx, offerID)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	now := metav1.Now()
+	status.LastSyncTime = &now
+	status.Synced = len(pending) == 0
+	for _, entry := range pending {
+		if entry.LastError == "" {
+			continue
+		}
+		if status.BrokerErrors == nil {
+			status.BrokerErrors = make(map[string]string)
+		}
+		status.BrokerErrors[entry.BrokerID] = entry.LastError
+	}
+	if err := r.updateStatus(ctx, &cr, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !status.Synced {
+		return ctrl.Result{RequeueAfter: brokerRetryInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *offerReconciler) updateStatus(ctx context.Context, cr *catalogv1alpha1.CatalogOffer, status catalogv1alpha1.CatalogOfferStatus) error {
+	cr.Status = status
+	return r.client.Status().Update(ctx, cr)
+}
+
+// applyCatalogOffer stores the offer described by the spec of cr, unless this generation of the spec has already been stored.
+// It returns a message, and no offer, if the spec cannot be applied.
+func (oh *OffersHandler) applyCatalogOffer(ctx context.Context, cr *catalogv1alpha1.CatalogOffer,
+	offerID, owner string) (*catalogv1alpha1.Offer, string, error) {
+	current, err := oh.offers.Get(ctx, offerID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, "", err
+	}
+	if current != nil && current.ManagedBy != "" && current.ManagedBy != owner {
+		return nil, fmt.Sprintf("offer %s is managed by CatalogOffer %s", offerID, current.ManagedBy), nil
+	}
+	if current != nil && current.Status == catalogv1alpha1.OfferRetired {
+		return nil, fmt.Sprintf("offer %s is retired and cannot be modified", offerID), nil
+	}
+	// the sales change the stored quantities: the spec is stored again only when it changes
+	if current != nil && current.ManagedBy == owner && cr.Status.ObservedGeneration == cr.Generation && cr.Status.Message == "" {
+		return current, "", nil
+	}
+
+	spec := cr.Spec.DeepCopy()
+	offer := catalogv1alpha1.Offer{
+		OfferID:           offerID,
+		OfferName:         spec.OfferName,
+		OfferType:         spec.OfferType,
+		Description:       spec.Description,
+		Plans:             spec.Plans,
+		ClusterPrettyName: oh.catalogConnector.ClusterPrettyName,
+		Created:           time.Now().Unix(),
+		Status:            spec.State,
+		ValidFrom:         spec.ValidFrom,
+		ValidUntil:        spec.ValidUntil,
+		Brokers:           spec.Brokers,
+		ManagedBy:         owner,
+	}
+	if offer.Status == "" {
+		offer.Status = catalogv1alpha1.OfferPublished
+	}
+	if err := validation.ValidateOffer(&offer); err != nil {
+		return nil, err.Error(), nil
+	}
+	if offer.Status == catalogv1alpha1.OfferPublished && len(offer.Plans) == 0 {
+		return nil, fmt.Sprintf("offer %s has no plans to publish", offerID), nil
+	}
+
+	revision := int64(0)
+	if current != nil {
+		revision = current.Revision
+		offer.Created = current.Created
+		// the quantities of the spec are the initial units: the stored ones count the sales since
+		keepInventory(&offer, current)
+		switch {
+		case offer.Status == current.Status:
+		case offer.Status == catalogv1alpha1.OfferPublished && current.Status == catalogv1alpha1.OfferSoldOut:
+			// UpdateSoldOut publishes it again if the spec adds a plan with units left
+		case !canTransition(current.Status, offer.Status):
+			return nil, fmt.Sprintf("offer %s cannot move from %s to %s", offerID, current.Status, offer.Status), nil
+		}
+	}
+	offer.UpdateSoldOut()
+
+	saved, err := oh.offers.Save(ctx, offer, revision)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Printf("Offer %s updated from CatalogOffer %s", offerID, owner)
+	if current != nil {
+		if err := oh.withdrawFromRemovedBrokers(current, saved); err != nil {
+			log.Printf("Failed to withdraw offer: %s", err)
+		}
+	}
+	return saved, "", nil
+}
+
+// withdrawManagedOffer deletes the offer of a deleted CatalogOffer if it is a draft, otherwise it retires it
+// and withdraws it from the brokers. Offers not managed by owner are left untouched.
+func (oh *OffersHandler) withdrawManagedOffer(ctx context.Context, offerID, owner string) error {
+	offer, err := oh.offers.Get(ctx, offerID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if offer.ManagedBy != owner || offer.Status == catalogv1alpha1.OfferRetired {
+		return nil
+	}
+	if offer.Status == catalogv1alpha1.OfferDraft {
+		log.Printf("Deleting draft offer %s of CatalogOffer %s", offerID, owner)
+		return oh.offers.Delete(ctx, offerID, offer.Revision)
+	}
+
+	log.Printf("Retiring offer %s of CatalogOffer %s", offerID, owner)
+	if _, err := oh.transition(ctx, offerID, catalogv1alpha1.OfferRetired, offer.Revision); err != nil {
+		return err
+	}
+	if err := oh.synchronizeSingleOffer(offerID, true); err != nil {
+		// the offer is retired anyway: the brokers that failed drop it with the next clean sync
+		log.Printf("Failed to synchronize offers: %s", err)
+	}
+	return nil
+}
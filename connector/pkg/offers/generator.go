@@ -0,0 +1,198 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	liqocontroller "connector/pkg/liqo-controller"
+	"connector/pkg/validation"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+const (
+	defaultReservePercentage = 20
+	defaultOfferType         = "computational"
+	defaultCurrency          = "EUR"
+	defaultPeriod            = "month"
+)
+
+// ErrInvalidGeneratorConfig is returned (wrapped) when the offer cannot be generated because of the configuration
+// in the request, rather than because of a failure reading the cluster or writing the offer.
+var ErrInvalidGeneratorConfig = errors.New("invalid generator configuration")
+
+// defaultSizes are proposed when the request does not specify any size
+var defaultSizes = []catalogv1alpha1.OfferSize{
+	{Name: "small", Resources: map[string]string{"cpu": "1", "memory": "2Gi"}},
+	{Name: "medium", Resources: map[string]string{"cpu": "2", "memory": "4Gi"}},
+	{Name: "large", Resources: map[string]string{"cpu": "4", "memory": "8Gi"}},
+}
+
+// generateOffer reads the available capacity of the cluster and stores a draft offer with a plan for every size
+// that fits in it. The capacity left after the reserve is shared by the plans, so that selling every plan never takes
+// more than it: each size gets an equal share of every resource, and its quantity is the number of slices fitting there.
+func (oh *OffersHandler) generateOffer(ctx context.Context, config catalogv1alpha1.OfferGeneratorConfig) (*catalogv1alpha1.Offer, error) {
+	setGeneratorDefaults(&config)
+	reserve := *config.ReservePercentage
+	if reserve < 0 || reserve >= 100 {
+		return nil, fmt.Errorf(`{"error":"reservePercentage must be between 0 and 99, got %d: %w"}`, reserve, ErrInvalidGeneratorConfig)
+	}
+
+	resources, err := liqocontroller.GetClusterResources(ctx, oh.catalogConnector.CRClient)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading cluster resources: %s"}`, err)
+	}
+
+	offerable := corev1.ResourceList{}
+	for name, quantity := range *resources.AvailableResources {
+		kept := float64(quantity.MilliValue()) * float64(100-reserve) / 100
+		offerable[name] = *resource.NewMilliQuantity(int64(kept), quantity.Format)
+	}
+
+	offerID := uuid.New().String()
+	offer := catalogv1alpha1.Offer{
+		OfferID:           offerID,
+		OfferName:         config.OfferName,
+		OfferType:         config.OfferType,
+		Description:       fmt.Sprintf("Generated from the available capacity of the cluster, keeping back %d%%", reserve),
+		ClusterPrettyName: oh.catalogConnector.ClusterPrettyName,
+		Created:           time.Now().Unix(),
+		Status:            catalogv1alpha1.OfferDraft,
+	}
+	quantities, err := shareCapacity(offerable, config.Sizes)
+	if err != nil {
+		return nil, err
+	}
+	for i, size := range config.Sizes {
+		if quantities[i] == 0 {
+			continue
+		}
+		offer.Plans = append(offer.Plans, catalogv1alpha1.Plan{
+			PlanID:           offerID + "_" + strconv.Itoa(len(offer.Plans)+1),
+			PlanName:         size.Name,
+			PlanCost:         size.Cost,
+			PlanCostCurrency: size.Currency,
+			PlanCostPeriod:   size.Period,
+			PlanQuantity:     quantities[i],
+			PlanResources:    size.Resources,
+		})
+	}
+	if len(offer.Plans) == 0 {
+		return nil, fmt.Errorf(`{"error":"no size fits in the available capacity of the cluster: %w"}`, ErrInvalidGeneratorConfig)
+	}
+
+	if err := validation.ValidateOffer(&offer); err != nil {
+		return nil, err
+	}
+	return oh.offers.Save(ctx, offer, 0)
+}
+
+// shareCapacity returns the quantity of every size, splitting capacity in equal shares among the sizes that fit.
+// A size that does not fit in its share gets no plan, and its share goes back to the others.
+func shareCapacity(capacity corev1.ResourceList, sizes []catalogv1alpha1.OfferSize) ([]int64, error) {
+	quantities := make([]int64, len(sizes))
+	fitting := 0
+	for i, size := range sizes {
+		quantity, err := slices(capacity, size.Resources)
+		if err != nil {
+			return nil, fmt.Errorf(`{"error":"size %s: %s: %w"}`, size.Name, err, ErrInvalidGeneratorConfig)
+		}
+		quantities[i] = quantity
+		if quantity > 0 {
+			fitting++
+		}
+	}
+	for fitting > 0 {
+		share := corev1.ResourceList{}
+		for name, quantity := range capacity {
+			share[name] = *resource.NewMilliQuantity(quantity.MilliValue()/int64(fitting), quantity.Format)
+		}
+		dropped := 0
+		for i, size := range sizes {
+			if quantities[i] == 0 {
+				continue
+			}
+			// the sizes were already parsed above
+			quantities[i], _ = slices(share, size.Resources)
+			if quantities[i] == 0 {
+				dropped++
+			}
+		}
+		if dropped == 0 {
+			break
+		}
+		fitting -= dropped
+	}
+	return quantities, nil
+}
+
+// slices returns how many times size fits in capacity
+func slices(capacity corev1.ResourceList, size map[string]string) (int64, error) {
+	if len(size) == 0 {
+		return 0, fmt.Errorf("no resources")
+	}
+	count := int64(math.MaxInt64)
+	for name, value := range size {
+		request, err := resource.ParseQuantity(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s quantity %q: %s", name, value, err)
+		}
+		if request.Sign() <= 0 {
+			return 0, fmt.Errorf("%s quantity must be positive", name)
+		}
+		available, ok := capacity[corev1.ResourceName(name)]
+		if !ok {
+			return 0, nil
+		}
+		if n := available.MilliValue() / request.MilliValue(); n < count {
+			count = n
+		}
+	}
+	return count, nil
+}
+
+func setGeneratorDefaults(config *catalogv1alpha1.OfferGeneratorConfig) {
+	if config.OfferName == "" {
+		config.OfferName = "Generated offer " + time.Now().Format("2006-01-02")
+	}
+	if config.OfferType == "" {
+		config.OfferType = defaultOfferType
+	}
+	if config.ReservePercentage == nil {
+		reserve := int64(defaultReservePercentage)
+		config.ReservePercentage = &reserve
+	}
+	if len(config.Sizes) == 0 {
+		config.Sizes = append([]catalogv1alpha1.OfferSize(nil), defaultSizes...)
+	}
+	for i := range config.Sizes {
+		if config.Sizes[i].Currency == "" {
+			config.Sizes[i].Currency = defaultCurrency
+		}
+		if config.Sizes[i].Period == "" {
+			config.Sizes[i].Period = defaultPeriod
+		}
+	}
+}
@@ -15,39 +15,58 @@
 package offers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	//"reflect"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
 
 	"connector/pkg/connector"
+	"connector/pkg/fanout"
+	"connector/pkg/store"
 	"connector/pkg/utils"
+	"connector/pkg/validation"
 
-	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
-)
-
-const (
-	MONGODB_DB               = "catalog-connector"
-	MONGODB_OFFER_COLLECTION = "offers"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
 )
 
 type OffersHandler struct {
-	catalogConnector   *connectorv1alpha1.CatalogConnector
-	offersCollection *mongo.Collection
+	catalogConnector *connectorv1alpha1.CatalogConnector
+	offers           store.OfferRepository
+	revisions        store.OfferRevisionRepository
+	outbox           store.SyncOutboxRepository
+	statuses         store.SyncStatusRepository
 	brokerHandler    connector.BrokerHandler
+	executor         *fanout.Executor
+
+	// outboxWake wakes up the outbox worker as soon as an entry is enqueued
+	outboxWake chan struct{}
+
+	// timers publish or withdraw the time-boxed offers, keyed by offer ID
+	timersMutex sync.Mutex
+	timers      map[string]*time.Timer
 }
 
-func InitOffersHandler(mDatabase *mongo.Database, catalogConnector *connectorv1alpha1.CatalogConnector) *OffersHandler {
-	offersCollection := mDatabase.Collection(MONGODB_OFFER_COLLECTION)
+func InitOffersHandler(offers store.OfferRepository, revisions store.OfferRevisionRepository, outbox store.SyncOutboxRepository,
+	statuses store.SyncStatusRepository, executor *fanout.Executor, catalogConnector *connectorv1alpha1.CatalogConnector) *OffersHandler {
 	return &OffersHandler{
-		offersCollection: offersCollection,
-		catalogConnector:   catalogConnector,
+		offers:           offers,
+		revisions:        revisions,
+		outbox:           outbox,
+		statuses:         statuses,
+		executor:         executor,
+		outboxWake:       make(chan struct{}, 1),
+		catalogConnector: catalogConnector,
+		timers:           make(map[string]*time.Timer),
 	}
 }
 
@@ -59,33 +78,132 @@ func (oh *OffersHandler) SetRoutes(router *mux.Router) {
 	router.HandleFunc("/offers", oh.postOffer).Methods("POST")
 	router.HandleFunc("/offers", oh.getOffers).Methods("GET")
 	router.HandleFunc("/offers", oh.deleteOffer).Methods("DELETE")
+	router.HandleFunc("/offers/generate", oh.postGenerateOffer).Methods("POST")
+	router.HandleFunc("/offers/export", oh.getExport).Methods("GET")
+	router.HandleFunc("/offers/import", oh.postImport).Methods("POST")
+	router.HandleFunc("/offers/{id}", oh.getOffer).Methods("GET")
+	router.HandleFunc("/offers/{id}/revisions", oh.getRevisions).Methods("GET")
+	router.HandleFunc("/offers/{id}/rollback", oh.postRollback).Methods("POST")
+	router.HandleFunc("/offers/{id}/sync", oh.getOfferSync).Methods("GET")
+	router.HandleFunc("/offers/{id}/{action:publish|suspend|retire}", oh.postTransition).Methods("POST")
+	router.HandleFunc("/sync/pending", oh.getPendingSync).Methods("GET")
+	router.HandleFunc("/sync/status", oh.getSyncStatus).Methods("GET")
 }
 
 func (oh *OffersHandler) getOffers(w http.ResponseWriter, req *http.Request) {
-	offers, err := getMyOffers(oh.offersCollection)
+	query, err := parseOfferQuery(req)
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	page, err := oh.offers.Find(req.Context(), *query)
+	if errors.Is(err, store.ErrInvalidQuery) {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
 	if err != nil {
 		utils.WriteResponseError(w, 500, err)
 		return
 	}
+	offers := page.Offers
+	if offers == nil {
+		offers = []catalogv1alpha1.Offer{}
+	}
+	keys := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		keys = append(keys, offer.OfferID+":"+strconv.FormatInt(offer.Revision, 10))
+	}
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("ETag", utils.ListETag(keys))
+	if page.Next != "" {
+		w.Header().Set(nextCursorHeader, page.Next)
+	}
 	utils.WriteResponse(w, offers, "offers", "", false)
 }
 
+func (oh *OffersHandler) getOffer(w http.ResponseWriter, req *http.Request) {
+	offer, err := oh.offers.Get(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, false), err)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("ETag", utils.ETag(offer.Revision))
+	utils.WriteResponse(w, offer, "offer", "", false)
+}
+
 func (oh *OffersHandler) postOffer(w http.ResponseWriter, req *http.Request) {
 	var offer catalogv1alpha1.Offer
 	if err := json.NewDecoder(req.Body).Decode(&offer); err != nil {
 		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"parsing offers: %s"}`, err.Error()))
 		return
 	}
-	err := insertMyOffer(oh.offersCollection, offer)
+	if err := validation.ValidateOffer(&offer); err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+
+	revision, conditional, err := requestRevision(req)
 	if err != nil {
-		utils.WriteResponseError(w, 500, err)
+		utils.WriteResponseError(w, 400, err)
 		return
 	}
+	if !conditional {
+		// the revision read by the client comes back in the body. Clients that send neither If-Match nor a revision
+		// keep the upsert semantics: the offer is created if it does not exist, overwritten otherwise
+		revision = offer.Revision
+		if revision == 0 {
+			revision, err = oh.upsertRevision(req.Context(), offer.OfferID)
+			if err != nil {
+				utils.WriteResponseError(w, 500, err)
+				return
+			}
+		}
+	}
+
+	// the status only changes through the transition API: new offers start as drafts
+	offer.Status = catalogv1alpha1.OfferDraft
+	offer.ManagedBy = ""
+	var current *catalogv1alpha1.Offer
+	if revision != 0 {
+		current, err = oh.offers.Get(req.Context(), offer.OfferID)
+		if err != nil {
+			utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+			return
+		}
+		if revision == store.AnyRevision {
+			revision = current.Revision
+		}
+		if current.Status == catalogv1alpha1.OfferRetired {
+			utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"offer %s is retired and cannot be modified"}`, offer.OfferID))
+			return
+		}
+		if err := managedError(current); err != nil {
+			utils.WriteResponseError(w, 409, err)
+			return
+		}
+		offer.Status = current.Status
+	}
+
+	offer.UpdateSoldOut()
+	saved, err := oh.offers.Save(req.Context(), offer, revision)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(saved.Revision))
 
 	log.Printf("Updating offer with ID %s", offer.OfferID)
-	if err := oh.synchronizeSingleOffer(offer.OfferID, false); err != nil {
-		log.Printf("Failed to synchronize offer: %s", err)
+	if current != nil {
+		if err := oh.withdrawFromRemovedBrokers(current, saved); err != nil {
+			log.Printf("Failed to withdraw offer: %s", err)
+		}
+	}
+	// a published offer whose plans have all been sold out is withdrawn
+	if saved.Status == catalogv1alpha1.OfferPublished || (current != nil && current.Status == catalogv1alpha1.OfferPublished) {
+		if err := oh.synchronizeSingleOffer(offer.OfferID, false); err != nil {
+			log.Printf("Failed to synchronize offer: %s", err)
+		}
 	}
 	//TODO: Remove or reformat everywhere status-message response
 	utils.WriteResponse(w, `{"status":"OK", "message": "Offer updated"}`, "offer updated", "", false)
@@ -97,16 +215,157 @@ func (oh *OffersHandler) deleteOffer(w http.ResponseWriter, req *http.Request) {
 		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"missing id parameter"}`))
 		return
 	}
-	err := deleteMyOffer(oh.offersCollection, id)
+
+	revision, conditional, err := requestRevision(req)
 	if err != nil {
-		utils.WriteResponseError(w, 500, err)
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	if !conditional {
+		revision = store.AnyRevision
+	}
+	offer, err := oh.offers.Get(req.Context(), id)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	if err := managedError(offer); err != nil {
+		utils.WriteResponseError(w, 409, err)
 		return
 	}
 
-	log.Printf("Deleting offer with ID %s from all brokers", id)
+	// drafts have never been sold nor sent to the brokers
+	if offer.Status == catalogv1alpha1.OfferDraft {
+		if err := oh.offers.Delete(req.Context(), id, revision); err != nil {
+			utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+			return
+		}
+		log.Printf("Deleted draft offer with ID %s", id)
+		utils.WriteResponse(w, `{"status":"OK", "message": "Offer deleted"}`, "offer deleted", "", false)
+		return
+	}
+
+	// the other offers are retired, to keep the history of their contracts
+	retired, err := oh.transition(req.Context(), id, catalogv1alpha1.OfferRetired, revision)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(retired.Revision))
+
+	log.Printf("Retiring offer with ID %s from all brokers", id)
 	if err := oh.synchronizeSingleOffer(id, true); err != nil {
 		log.Printf("Failed to synchronize offers: %s", err)
 	}
 
-	utils.WriteResponse(w, `{"status":"OK", "message": "Offer deleted"}`, "offer deleted", "", false)
+	utils.WriteResponse(w, `{"status":"OK", "message": "Offer retired"}`, "offer retired", "", false)
+}
+
+// postTransition moves an offer to another lifecycle status, then publishes it to or withdraws it from the brokers
+func (oh *OffersHandler) postTransition(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	revision, conditional, err := requestRevision(req)
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	if !conditional {
+		revision = store.AnyRevision
+	}
+	current, err := oh.offers.Get(req.Context(), vars["id"])
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	if err := managedError(current); err != nil {
+		utils.WriteResponseError(w, 409, err)
+		return
+	}
+
+	offer, err := oh.transition(req.Context(), vars["id"], actions[vars["action"]], revision)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(offer.Revision))
+
+	log.Printf("Offer with ID %s is now %s", offer.OfferID, offer.Status)
+	if err := oh.synchronizeSingleOffer(offer.OfferID, false); err != nil {
+		log.Printf("Failed to synchronize offer: %s", err)
+	}
+	utils.WriteResponse(w, offer, "offer", "", false)
+}
+
+// postGenerateOffer creates a draft offer slicing the available capacity of the cluster into the requested sizes
+func (oh *OffersHandler) postGenerateOffer(w http.ResponseWriter, req *http.Request) {
+	var config catalogv1alpha1.OfferGeneratorConfig
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+			utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"parsing generator configuration: %s"}`, err))
+			return
+		}
+	}
+
+	offer, err := oh.generateOffer(req.Context(), config)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.Is(err, ErrInvalidGeneratorConfig) || errors.As(err, &invalid) {
+			utils.WriteResponseError(w, 400, err)
+		} else {
+			utils.WriteResponseError(w, 500, err)
+		}
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(offer.Revision))
+	utils.WriteResponse(w, offer, "offer", fmt.Sprintf("Generated draft offer %s with %d plans", offer.OfferID, len(offer.Plans)), false)
+}
+
+// managedError rejects the changes made through the REST API to the offers managed by a CatalogOffer,
+// since they would be overwritten by the next change of the resource
+func managedError(offer *catalogv1alpha1.Offer) error {
+	if offer.ManagedBy == "" {
+		return nil
+	}
+	return fmt.Errorf(`{"error":"offer %s is managed by CatalogOffer %s"}`, offer.OfferID, offer.ManagedBy)
+}
+
+// upsertRevision returns the revision to write an offer with when the client does not tell which one it has read:
+// AnyRevision if the offer exists, 0 to create it otherwise
+func (oh *OffersHandler) upsertRevision(ctx context.Context, offerID string) (int64, error) {
+	_, err := oh.offers.Get(ctx, offerID)
+	switch {
+	case err == nil:
+		return store.AnyRevision, nil
+	case errors.Is(err, store.ErrNotFound):
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// requestRevision returns the revision in the If-Match header of req, or AnyRevision for "*".
+// conditional is false if the header is missing.
+func requestRevision(req *http.Request) (revision int64, conditional bool, err error) {
+	tag, revision, conditional, err := utils.IfMatch(req)
+	if tag == utils.AnyETag {
+		revision = store.AnyRevision
+	}
+	return revision, conditional, err
+}
+
+// revisionErrorCode returns the HTTP status of a failed read or write: a failed If-Match precondition is 412,
+// a stale revision in the body or a forbidden status transition is 409
+func revisionErrorCode(err error, conditional bool) int {
+	switch {
+	case errors.Is(err, ErrInvalidTransition):
+		return 409
+	case conditional && (errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound)):
+		return 412
+	case errors.Is(err, store.ErrConflict):
+		return 409
+	case errors.Is(err, store.ErrNotFound):
+		return 404
+	default:
+		return 500
+	}
 }
@@ -0,0 +1,105 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"connector/pkg/connector"
+	"connector/pkg/store"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// ReservePlan takes a unit of the plan and returns the updated offer. It fails with connector.ErrSoldOut
+// if no unit is left. The offer is saved at the revision it has been read at, so that two concurrent
+// reservations cannot both take the last unit, even from different connector instances.
+func (oh *OffersHandler) ReservePlan(offerID, planID string) (*catalogv1alpha1.Offer, error) {
+	return oh.updateInventory(context.Background(), offerID, planID, -1)
+}
+
+// ReleasePlan gives back the unit of the plan taken by a terminated contract.
+func (oh *OffersHandler) ReleasePlan(offerID, planID string) error {
+	_, err := oh.updateInventory(context.Background(), offerID, planID, 1)
+	return err
+}
+
+func (oh *OffersHandler) updateInventory(ctx context.Context, offerID, planID string, delta int64) (*catalogv1alpha1.Offer, error) {
+	for {
+		offer, err := oh.offers.Get(ctx, offerID)
+		if err != nil {
+			return nil, err
+		}
+		if offer.Status == catalogv1alpha1.OfferRetired {
+			// the units of retired offers are not sold anymore
+			if delta > 0 {
+				return offer, nil
+			}
+			return nil, fmt.Errorf(`{"error":"offer %s is retired: %w"}`, offerID, ErrInvalidTransition)
+		}
+		var plan *catalogv1alpha1.Plan
+		for i := range offer.Plans {
+			if offer.Plans[i].PlanID == planID {
+				plan = &offer.Plans[i]
+			}
+		}
+		if plan == nil {
+			return nil, fmt.Errorf(`{"error":"no such plan %s in offer %s: %w"}`, planID, offerID, store.ErrNotFound)
+		}
+		if plan.PlanQuantity+delta < 0 {
+			return nil, fmt.Errorf(`{"error":"plan %s of offer %s: %w"}`, planID, offerID, connector.ErrSoldOut)
+		}
+
+		plan.PlanQuantity += delta
+		previous := offer.Status
+		offer.UpdateSoldOut()
+		saved, err := oh.offers.Save(ctx, *offer, offer.Revision)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Plan %s of offer %s has %d units left", planID, offerID, plan.PlanQuantity)
+		if previous == catalogv1alpha1.OfferPublished || saved.Status == catalogv1alpha1.OfferPublished {
+			// the brokers are updated in the background, not to hold the caller
+			go func() {
+				if err := oh.synchronizeSingleOffer(offerID, false); err != nil {
+					log.Printf("Failed to synchronize offer: %s", err)
+				}
+			}()
+		}
+		return saved, nil
+	}
+}
+
+// keepInventory copies the units left of the plans of current to the same plans of offer, so that rewriting
+// an offer from a document that does not track the sales (an old revision, a CatalogOffer, an import) does not
+// give back the units already sold. Plans added by offer keep their quantity.
+func keepInventory(offer, current *catalogv1alpha1.Offer) {
+	left := make(map[string]int64, len(current.Plans))
+	for _, plan := range current.Plans {
+		left[plan.PlanID] = plan.PlanQuantity
+	}
+	for i := range offer.Plans {
+		if quantity, ok := left[offer.Plans[i].PlanID]; ok {
+			offer.Plans[i].PlanQuantity = quantity
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"connector/pkg/store"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// ErrInvalidTransition is returned (wrapped) when an offer cannot move from its status to the requested one.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists, for every status, the statuses an offer can move to.
+// Retired offers are only kept for the history of their contracts and cannot change anymore.
+var transitions = map[catalogv1alpha1.OfferStatus][]catalogv1alpha1.OfferStatus{
+	catalogv1alpha1.OfferDraft:     {catalogv1alpha1.OfferPublished, catalogv1alpha1.OfferRetired},
+	catalogv1alpha1.OfferPublished: {catalogv1alpha1.OfferSuspended, catalogv1alpha1.OfferSoldOut, catalogv1alpha1.OfferRetired},
+	catalogv1alpha1.OfferSuspended: {catalogv1alpha1.OfferPublished, catalogv1alpha1.OfferRetired},
+	catalogv1alpha1.OfferSoldOut:   {catalogv1alpha1.OfferPublished, catalogv1alpha1.OfferSuspended, catalogv1alpha1.OfferRetired},
+	catalogv1alpha1.OfferRetired:   {},
+}
+
+// actions maps the transition API (POST /api/offers/{id}/{action}) to the target status
+var actions = map[string]catalogv1alpha1.OfferStatus{
+	"publish": catalogv1alpha1.OfferPublished,
+	"suspend": catalogv1alpha1.OfferSuspended,
+	"retire":  catalogv1alpha1.OfferRetired,
+}
+
+func canTransition(from, to catalogv1alpha1.OfferStatus) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves the offer to the given status, if the stored offer has the given revision (or any, with AnyRevision).
+// The brokers are not updated: see synchronizeSingleOffer.
+func (oh *OffersHandler) transition(ctx context.Context, offerID string, to catalogv1alpha1.OfferStatus, revision int64) (*catalogv1alpha1.Offer, error) {
+	offer, err := oh.offers.Get(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	if revision == store.AnyRevision {
+		revision = offer.Revision
+	}
+	if !canTransition(offer.Status, to) {
+		return nil, fmt.Errorf(`{"error":"offer %s cannot move from %s to %s: %w"}`, offerID, offer.Status, to, ErrInvalidTransition)
+	}
+	if to == catalogv1alpha1.OfferPublished && len(offer.Plans) == 0 {
+		return nil, fmt.Errorf(`{"error":"offer %s has no plans to publish: %w"}`, offerID, ErrInvalidTransition)
+	}
+
+	offer.Status = to
+	return oh.offers.Save(ctx, *offer, revision)
+}
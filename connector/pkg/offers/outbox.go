@@ -0,0 +1,291 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+	"connector/pkg/store"
+	"connector/pkg/utils"
+)
+
+const (
+	// outboxPollInterval is how often the outbox is checked for the entries due to be retried
+	outboxPollInterval = 5 * time.Second
+	// outboxMinBackoff and outboxMaxBackoff bound the delay before a failed entry is attempted again
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// enqueue records in the outbox that the offer must be brought up to date on the broker, and wakes up the worker
+func (oh *OffersHandler) enqueue(ctx context.Context, brokerID, offerID string, operation syncv1alpha1.SyncOperation) error {
+	now := time.Now()
+	entry := syncv1alpha1.OutboxEntry{
+		ID:          syncv1alpha1.OutboxEntryID(brokerID, offerID),
+		BrokerID:    brokerID,
+		OfferID:     offerID,
+		Operation:   operation,
+		Sequence:    now.UnixNano(),
+		Created:     now.Unix(),
+		NextAttempt: now.Unix(),
+	}
+	if err := oh.outbox.Enqueue(ctx, entry); err != nil {
+		return err
+	}
+	select {
+	case oh.outboxWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StartOutbox delivers the outbox entries in the background until ctx is done,
+// starting with the entries left pending by the previous run.
+func (oh *OffersHandler) StartOutbox(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		for {
+			oh.deliverOutbox(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-oh.outboxWake:
+			}
+		}
+	}()
+}
+
+// deliverOutbox attempts every entry whose next attempt is due. The brokers are called concurrently,
+// and the entries of each broker one after another until its deadline expires.
+func (oh *OffersHandler) deliverOutbox(ctx context.Context) {
+	entries, err := oh.outbox.List(ctx)
+	if err != nil {
+		log.Printf("Error reading sync outbox: %s", err)
+		return
+	}
+	now := time.Now().Unix()
+	var brokers []brokerv1alpha1.BrokerDocument
+	due := make(map[string][]syncv1alpha1.OutboxEntry)
+	skipped := make(map[string]bool)
+	for _, entry := range entries {
+		// entries are sorted by next attempt
+		if entry.NextAttempt > now {
+			break
+		}
+		if skipped[entry.BrokerID] {
+			continue
+		}
+		if _, ok := due[entry.BrokerID]; !ok {
+			broker, err := oh.brokerHandler.GetBroker(entry.BrokerID)
+			if err != nil {
+				skipped[entry.BrokerID] = true
+				if !errors.Is(err, store.ErrNotFound) {
+					log.Printf("Error reading broker %q: %s", entry.BrokerID, err)
+					continue
+				}
+				log.Printf("Dropping sync outbox of broker %q: broker removed", entry.BrokerID)
+				if err := oh.outbox.DeleteBroker(ctx, entry.BrokerID); err != nil {
+					log.Printf("Error updating sync outbox: %s", err)
+				}
+				if err := oh.statuses.DeleteBroker(ctx, entry.BrokerID); err != nil {
+					log.Printf("Error updating sync status: %s", err)
+				}
+				continue
+			}
+			brokers = append(brokers, *broker)
+		}
+		due[entry.BrokerID] = append(due[entry.BrokerID], entry)
+	}
+	if len(brokers) == 0 {
+		return
+	}
+
+	results := oh.executor.Run(ctx, brokers, func(brokerCtx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+		for _, entry := range due[broker.ID] {
+			// the entries left are attempted at the next round
+			if err := brokerCtx.Err(); err != nil {
+				return nil, err
+			}
+			oh.deliver(ctx, brokerCtx, broker, entry)
+		}
+		return nil, nil
+	})
+	for brokerID, err := range results.Failed() {
+		log.Printf("Delivery of the sync outbox to broker %q interrupted: %s", brokerID, err)
+	}
+}
+
+// deliver brings the offer of the entry up to date on its broker, calling the broker with brokerCtx. The entry is removed
+// if it succeeds, otherwise it is attempted again after a delay that doubles at every failure.
+func (oh *OffersHandler) deliver(ctx, brokerCtx context.Context, broker *brokerv1alpha1.BrokerDocument, entry syncv1alpha1.OutboxEntry) {
+	if !broker.Enabled {
+		// the brokers get every offer again when they subscribe
+		log.Printf("Dropping sync of offer %s: broker %q is not subscribed", entry.OfferID, entry.BrokerID)
+		if err := oh.outbox.Complete(ctx, entry); err != nil {
+			log.Printf("Error updating sync outbox: %s", err)
+		}
+		return
+	}
+	var err error
+	if entry.Operation == syncv1alpha1.SyncClean {
+		err = oh.cleanBroker(ctx, broker)
+	} else {
+		err = oh.deliverOffer(ctx, brokerCtx, broker, &entry)
+	}
+	if err == nil {
+		log.Printf("Offer %s synchronized with broker %q (%s)", entry.OfferID, entry.BrokerID, entry.Operation)
+		if err := oh.outbox.Complete(ctx, entry); err != nil {
+			log.Printf("Error updating sync outbox: %s", err)
+		}
+		return
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	delay := outboxBackoff(entry.Attempts)
+	entry.NextAttempt = time.Now().Add(delay).Unix()
+	log.Printf("Failed to synchronize offer %s with broker %q (attempt %d, retrying in %s): %s",
+		entry.OfferID, entry.BrokerID, entry.Attempts, delay, err)
+	if err := oh.outbox.Retry(ctx, entry); err != nil {
+		log.Printf("Error updating sync outbox: %s", err)
+	}
+}
+
+// deliverOffer posts the current version of the offer of the entry to the broker, or withdraws it from the broker
+func (oh *OffersHandler) deliverOffer(ctx, brokerCtx context.Context, broker *brokerv1alpha1.BrokerDocument, entry *syncv1alpha1.OutboxEntry) error {
+	offer, err := oh.offerToDeliver(ctx, broker, entry)
+	if err != nil {
+		return err
+	}
+	client, err := oh.brokerHandler.BrokerClient(broker)
+	if err != nil {
+		return err
+	}
+	attempted := time.Now()
+	if offer != nil {
+		err = client.PostOffer(brokerCtx, *offer)
+	} else {
+		err = client.DeleteOffer(brokerCtx, entry.OfferID)
+		// the broker does not list the offer already
+		if errors.Is(err, brokerv1alpha1.ErrNotFound) {
+			err = nil
+		}
+	}
+	oh.recordSync(ctx, broker.ID, entry.OfferID, offer, attempted, err)
+	return err
+}
+
+// cleanBroker deletes every offer of the local cluster from the broker, then posts the offers targeting it
+// with a single request. Both requests get their own deadline.
+func (oh *OffersHandler) cleanBroker(ctx context.Context, broker *brokerv1alpha1.BrokerDocument) error {
+	offers, err := oh.publishedOffers(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := oh.brokerHandler.BrokerClient(broker)
+	if err != nil {
+		return err
+	}
+
+	deleteCtx, cancel := oh.executor.WithTimeout(ctx)
+	err = client.DeleteAllOffers(deleteCtx)
+	cancel()
+	// the broker does not list the local cluster yet
+	if err != nil && !errors.Is(err, brokerv1alpha1.ErrNotFound) {
+		return err
+	}
+
+	targeted := offersForBroker(offers, broker.ID)
+	if len(targeted) == 0 {
+		return nil
+	}
+	postCtx, cancel := oh.executor.WithTimeout(ctx)
+	defer cancel()
+	attempted := time.Now()
+	err = client.BulkPostOffer(postCtx, targeted)
+	for i := range targeted {
+		oh.recordSync(ctx, broker.ID, targeted[i].OfferID, &targeted[i], attempted, err)
+	}
+	return err
+}
+
+// offerToDeliver returns the current version of the offer to post to the broker, or nil if it must be withdrawn from it
+func (oh *OffersHandler) offerToDeliver(ctx context.Context, broker *brokerv1alpha1.BrokerDocument,
+	entry *syncv1alpha1.OutboxEntry) (*catalogv1alpha1.Offer, error) {
+	offer, err := oh.offers.Get(ctx, entry.OfferID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if offer != nil && listed(offer, time.Now()) && offer.TargetsBroker(broker.ID) {
+		entry.Operation = syncv1alpha1.SyncPost
+		return offer, nil
+	}
+	entry.Operation = syncv1alpha1.SyncDelete
+	return nil, nil
+}
+
+// outboxBackoff returns the delay before the next attempt of an entry that failed the given number of times
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxMinBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return delay
+}
+
+// pendingSync returns the outbox entries of the offer, and the pending clean syncs, which send it again
+func (oh *OffersHandler) pendingSync(ctx context.Context, offerID string) ([]syncv1alpha1.OutboxEntry, error) {
+	entries, err := oh.outbox.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := []syncv1alpha1.OutboxEntry{}
+	for _, entry := range entries {
+		if entry.OfferID == offerID || entry.Operation == syncv1alpha1.SyncClean {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// getPendingSync returns the changes of the offers not delivered to the brokers yet, optionally only those of a broker
+func (oh *OffersHandler) getPendingSync(w http.ResponseWriter, req *http.Request) {
+	entries, err := oh.outbox.List(req.Context())
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	brokerID := req.URL.Query().Get("broker-id")
+	pending := []syncv1alpha1.OutboxEntry{}
+	for _, entry := range entries {
+		if brokerID == "" || entry.BrokerID == brokerID {
+			pending = append(pending, entry)
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	utils.WriteResponse(w, pending, "pending sync", "", false)
+}
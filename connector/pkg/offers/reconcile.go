@@ -0,0 +1,186 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+)
+
+// drift lists the IDs of the offers the broker is not up to date with
+type drift struct {
+	missing []string // listed locally but not on the broker
+	changed []string // listed on the broker with a different content
+	stale   []string // listed on the broker but not locally
+	pending int      // already waiting in the outbox, not checked
+}
+
+func (d *drift) size() int {
+	return len(d.missing) + len(d.changed) + len(d.stale)
+}
+
+// StartReconciler reconciles every subscribed broker with the local offers at every interval, until ctx is done
+func (oh *OffersHandler) StartReconciler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			brokers, err := oh.brokerHandler.GetBrokerList()
+			if err != nil {
+				log.Printf("Error reading brokers to reconcile: %s", err)
+				continue
+			}
+			enabled := make([]brokerv1alpha1.BrokerDocument, 0, len(*brokers))
+			for _, broker := range *brokers {
+				if broker.Enabled {
+					enabled = append(enabled, broker)
+				}
+			}
+			results := oh.executor.Run(ctx, enabled, func(brokerCtx context.Context, broker *brokerv1alpha1.BrokerDocument) (interface{}, error) {
+				return nil, oh.reconcileBroker(ctx, brokerCtx, broker)
+			})
+			for brokerID, err := range results.Failed() {
+				log.Printf("Failed to reconcile broker %q: %s", brokerID, err)
+			}
+		}
+	}()
+}
+
+// ReconcileOffers compares the offers listed by the broker for the local cluster with the local ones,
+// and brings the broker up to date sending only the offers that are missing or changed and withdrawing the stale ones
+func (oh *OffersHandler) ReconcileOffers(brokerID string) error {
+	broker, err := oh.brokerHandler.GetBroker(brokerID)
+	if err != nil {
+		return err
+	}
+	if !broker.Enabled {
+		return nil
+	}
+	brokerCtx, cancel := oh.executor.WithTimeout(context.Background())
+	defer cancel()
+	return oh.reconcileBroker(context.Background(), brokerCtx, broker)
+}
+
+// reconcileBroker reads the offers the broker lists for the local cluster with brokerCtx, and queues the differences
+// in the outbox
+func (oh *OffersHandler) reconcileBroker(ctx, brokerCtx context.Context, broker *brokerv1alpha1.BrokerDocument) error {
+	client, err := oh.brokerHandler.BrokerClient(broker)
+	if err != nil {
+		return err
+	}
+	remote, err := client.ListOffers(brokerCtx)
+	if err != nil {
+		return fmt.Errorf("listing the offers: %w", err)
+	}
+	offers, err := oh.publishedOffers(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := oh.outbox.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := pendingOffers(entries, broker.ID)
+	if pending[syncv1alpha1.CleanSyncOfferID] {
+		// the pending clean sync sends every offer again anyway
+		log.Printf("Broker %q not reconciled: clean sync pending", broker.ID)
+		return nil
+	}
+	d := diffBroker(offersForBroker(offers, broker.ID), remote, pending)
+	for _, offerID := range append(d.missing, d.changed...) {
+		if err := oh.enqueue(ctx, broker.ID, offerID, syncv1alpha1.SyncPost); err != nil {
+			return err
+		}
+	}
+	for _, offerID := range d.stale {
+		if err := oh.enqueue(ctx, broker.ID, offerID, syncv1alpha1.SyncDelete); err != nil {
+			return err
+		}
+	}
+	log.Printf("Broker %q reconciled: %d offers listed, drift %d (missing %d, changed %d, stale %d), %d pending",
+		broker.ID, len(remote), d.size(), len(d.missing), len(d.changed), len(d.stale), d.pending)
+	return nil
+}
+
+// diffBroker compares the offers that must be on the broker with those it lists, skipping the offers with a pending outbox entry
+func diffBroker(local, remote []catalogv1alpha1.Offer, pending map[string]bool) *drift {
+	d := &drift{}
+	listed := make(map[string]string, len(remote))
+	for i := range remote {
+		listed[remote[i].OfferID] = contentHash(&remote[i])
+	}
+	for i := range local {
+		offerID := local[i].OfferID
+		hash, ok := listed[offerID]
+		delete(listed, offerID)
+		switch {
+		case pending[offerID]:
+			d.pending++
+		case !ok:
+			d.missing = append(d.missing, offerID)
+		case hash != contentHash(&local[i]):
+			d.changed = append(d.changed, offerID)
+		}
+	}
+	for i := range remote {
+		offerID := remote[i].OfferID
+		if _, ok := listed[offerID]; !ok {
+			continue
+		}
+		delete(listed, offerID)
+		if pending[offerID] {
+			d.pending++
+			continue
+		}
+		d.stale = append(d.stale, offerID)
+	}
+	return d
+}
+
+// pendingOffers returns the IDs of the offers with an outbox entry for the broker
+func pendingOffers(entries []syncv1alpha1.OutboxEntry, brokerID string) map[string]bool {
+	pending := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.BrokerID == brokerID {
+			pending[entry.OfferID] = true
+		}
+	}
+	return pending
+}
+
+// contentHash returns the digest of the offer as it is sent to the brokers
+func contentHash(offer *catalogv1alpha1.Offer) string {
+	content, err := json.Marshal(offer)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
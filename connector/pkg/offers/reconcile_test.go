@@ -0,0 +1,79 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"reflect"
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+)
+
+func TestDiffBroker(t *testing.T) {
+	offer := func(id, name string) catalogv1alpha1.Offer {
+		return catalogv1alpha1.Offer{OfferID: id, OfferName: name}
+	}
+	tests := []struct {
+		name    string
+		local   []catalogv1alpha1.Offer
+		remote  []catalogv1alpha1.Offer
+		pending map[string]bool
+		want    drift
+	}{
+		{name: "in sync", local: []catalogv1alpha1.Offer{offer("a", "A")}, remote: []catalogv1alpha1.Offer{offer("a", "A")}},
+		{name: "empty"},
+		{name: "missing", local: []catalogv1alpha1.Offer{offer("a", "A"), offer("b", "B")}, remote: []catalogv1alpha1.Offer{offer("a", "A")}, want: drift{missing: []string{"b"}}},
+		{name: "changed", local: []catalogv1alpha1.Offer{offer("a", "A")}, remote: []catalogv1alpha1.Offer{offer("a", "old")}, want: drift{changed: []string{"a"}}},
+		{name: "stale", remote: []catalogv1alpha1.Offer{offer("a", "A"), offer("b", "B")}, want: drift{stale: []string{"a", "b"}}},
+		{
+			name:    "pending",
+			local:   []catalogv1alpha1.Offer{offer("a", "A"), offer("b", "B")},
+			remote:  []catalogv1alpha1.Offer{offer("b", "old"), offer("c", "C")},
+			pending: map[string]bool{"a": true, "b": true, "c": true},
+			want:    drift{pending: 3},
+		},
+		{
+			name:    "mixed",
+			local:   []catalogv1alpha1.Offer{offer("a", "A"), offer("b", "B"), offer("c", "C")},
+			remote:  []catalogv1alpha1.Offer{offer("b", "old"), offer("c", "C"), offer("d", "D"), offer("e", "E")},
+			pending: map[string]bool{"e": true},
+			want:    drift{missing: []string{"a"}, changed: []string{"b"}, stale: []string{"d"}, pending: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffBroker(tt.local, tt.remote, tt.pending)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("diffBroker() = %+v, want %+v", *got, tt.want)
+			}
+			if got.size() != len(tt.want.missing)+len(tt.want.changed)+len(tt.want.stale) {
+				t.Errorf("size() = %d", got.size())
+			}
+		})
+	}
+}
+
+func TestPendingOffers(t *testing.T) {
+	entries := []syncv1alpha1.OutboxEntry{
+		{BrokerID: "b1", OfferID: "o1"},
+		{BrokerID: "b2", OfferID: "o2"},
+		{BrokerID: "b1", OfferID: "o3"},
+	}
+	want := map[string]bool{"o1": true, "o3": true}
+	if got := pendingOffers(entries, "b1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("pendingOffers() = %v, want %v", got, want)
+	}
+}
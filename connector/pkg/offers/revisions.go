@@ -0,0 +1,228 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"connector/pkg/store"
+	"connector/pkg/utils"
+	"connector/pkg/validation"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// ignoredFields change on every revision, so they are left out of the diffs
+var ignoredFields = []string{"revision"}
+
+// getRevisions returns the history of an offer, oldest first, with the fields changed by every revision.
+// The history of a deleted offer ends with its tombstone.
+func (oh *OffersHandler) getRevisions(w http.ResponseWriter, req *http.Request) {
+	offerID := mux.Vars(req)["id"]
+	current, err := oh.offers.Get(req.Context(), offerID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	revisions, err := oh.revisions.List(req.Context(), offerID)
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	if current == nil && len(revisions) == 0 {
+		utils.WriteResponseError(w, 404, fmt.Errorf(`{"error":"offer %s not found: %w"}`, offerID, store.ErrNotFound))
+		return
+	}
+	// offers not modified since the history was introduced have no revision yet
+	if current != nil && (len(revisions) == 0 || revisions[len(revisions)-1].Revision != current.Revision) {
+		revisions = append(revisions, catalogv1alpha1.OfferRevision{
+			OfferID:  offerID,
+			Revision: current.Revision,
+			Offer:    *current,
+		})
+	}
+	for i := 1; i < len(revisions); i++ {
+		revisions[i].Changes, err = diffOffers(&revisions[i-1].Offer, &revisions[i].Offer)
+		if err != nil {
+			utils.WriteResponseError(w, 500, err)
+			return
+		}
+	}
+	if current != nil {
+		w.Header().Set("ETag", utils.ETag(current.Revision))
+	}
+	utils.WriteResponse(w, revisions, "offer revisions", "", false)
+}
+
+// postRollback stores a copy of an old revision as the latest one, then re-synchronizes the offer with the brokers.
+// The lifecycle status is not rolled back: it only changes through the transition API. Neither are the units left
+// of the plans, which only change with the sales.
+func (oh *OffersHandler) postRollback(w http.ResponseWriter, req *http.Request) {
+	offerID := mux.Vars(req)["id"]
+	target, err := strconv.ParseInt(req.URL.Query().Get("rev"), 10, 64)
+	if err != nil || target <= 0 {
+		utils.WriteResponseError(w, 400, fmt.Errorf(`{"error":"invalid rev parameter %q"}`, req.URL.Query().Get("rev")))
+		return
+	}
+	revision, conditional, err := requestRevision(req)
+	if err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+
+	current, err := oh.offers.Get(req.Context(), offerID)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	if !conditional || revision == store.AnyRevision {
+		revision = current.Revision
+	}
+	if current.Status == catalogv1alpha1.OfferRetired {
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"offer %s is retired and cannot be modified"}`, offerID))
+		return
+	}
+	if err := managedError(current); err != nil {
+		utils.WriteResponseError(w, 409, err)
+		return
+	}
+
+	old, err := oh.revisions.Get(req.Context(), offerID, target)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, false), err)
+		return
+	}
+	if old.Deleted {
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"revision %d of offer %s records the deletion of a previous offer"}`, target, offerID))
+		return
+	}
+	restored := old.Offer
+	restored.Status = current.Status
+	keepInventory(&restored, current)
+	// the offer must still be acceptable with the current validation rules
+	if err := validation.ValidateOffer(&restored); err != nil {
+		utils.WriteResponseError(w, 400, err)
+		return
+	}
+	if restored.Status == catalogv1alpha1.OfferPublished && len(restored.Plans) == 0 {
+		utils.WriteResponseError(w, 409, fmt.Errorf(`{"error":"revision %d of offer %s has no plans and the offer is published"}`, target, offerID))
+		return
+	}
+
+	restored.UpdateSoldOut()
+	saved, err := oh.offers.Save(req.Context(), restored, revision)
+	if err != nil {
+		utils.WriteResponseError(w, revisionErrorCode(err, conditional), err)
+		return
+	}
+	w.Header().Set("ETag", utils.ETag(saved.Revision))
+
+	log.Printf("Rolled back offer with ID %s to revision %d as revision %d", offerID, target, saved.Revision)
+	if err := oh.withdrawFromRemovedBrokers(current, saved); err != nil {
+		log.Printf("Failed to withdraw offer: %s", err)
+	}
+	if saved.Status == catalogv1alpha1.OfferPublished || current.Status == catalogv1alpha1.OfferPublished {
+		if err := oh.synchronizeSingleOffer(offerID, false); err != nil {
+			log.Printf("Failed to synchronize offer: %s", err)
+		}
+	}
+	utils.WriteResponse(w, saved, "offer", "", false)
+}
+
+// diffOffers returns the fields changed from old to new, comparing their JSON representation.
+// Plans are matched by ID, so that reordering them is not a change.
+func diffOffers(old, new *catalogv1alpha1.Offer) ([]catalogv1alpha1.FieldChange, error) {
+	oldFields, err := offerFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := offerFields(new)
+	if err != nil {
+		return nil, err
+	}
+	changes := []catalogv1alpha1.FieldChange{}
+	diffValues("", oldFields, newFields, &changes)
+	return changes, nil
+}
+
+// offerFields converts the offer to generic JSON values, with the plans keyed by "[planID]"
+func offerFields(offer *catalogv1alpha1.Offer) (map[string]interface{}, error) {
+	raw, err := json.Marshal(offer)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"encoding offer %s: %s"}`, offer.OfferID, err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf(`{"error":"decoding offer %s: %s"}`, offer.OfferID, err)
+	}
+	for _, field := range ignoredFields {
+		delete(fields, field)
+	}
+	if plans, ok := fields["plans"].([]interface{}); ok {
+		byID := make(map[string]interface{}, len(plans))
+		for i, plan := range plans {
+			id, _ := plan.(map[string]interface{})["planID"].(string)
+			if id == "" {
+				id = strconv.Itoa(i)
+			}
+			byID["["+id+"]"] = plan
+		}
+		fields["plans"] = byID
+	}
+	return fields, nil
+}
+
+func diffValues(path string, old, new interface{}, changes *[]catalogv1alpha1.FieldChange) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(old, new) {
+			*changes = append(*changes, catalogv1alpha1.FieldChange{Field: path, Old: old, New: new})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := key
+		switch {
+		case path == "":
+		case strings.HasPrefix(key, "["):
+			child = path + key
+		default:
+			child = path + "." + key
+		}
+		diffValues(child, oldMap[key], newMap[key], changes)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// listed reports whether the offer must be on the brokers at the given time
+func listed(offer *catalogv1alpha1.Offer, now time.Time) bool {
+	return offer.Status == catalogv1alpha1.OfferPublished && offer.InWindow(now)
+}
+
+// StartScheduler brings the brokers up to date with the offers whose validity window started or ended
+// while the connector was down, then schedules the next publish or withdrawal of every published offer.
+// The schedule is rebuilt from the stored offers, so it needs no storage of its own.
+func (oh *OffersHandler) StartScheduler(ctx context.Context) error {
+	offers, err := oh.offers.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range offers {
+		offer := &offers[i]
+		if offer.Status != catalogv1alpha1.OfferPublished || (offer.ValidFrom == 0 && offer.ValidUntil == 0) {
+			continue
+		}
+		// synchronizeSingleOffer schedules the next change of the window
+		if err := oh.synchronizeSingleOffer(offer.OfferID, false); err != nil {
+			log.Printf("Failed to synchronize time-boxed offer %s: %s", offer.OfferID, err)
+			oh.schedule(offer)
+		}
+	}
+	log.Printf("Scheduled %d time-boxed offers", oh.scheduled())
+	return nil
+}
+
+// schedule replaces the timer of the offer with one firing at the next bound of its validity window, if it is published
+func (oh *OffersHandler) schedule(offer *catalogv1alpha1.Offer) {
+	oh.timersMutex.Lock()
+	defer oh.timersMutex.Unlock()
+	if timer, ok := oh.timers[offer.OfferID]; ok {
+		timer.Stop()
+		delete(oh.timers, offer.OfferID)
+	}
+	if offer.Status != catalogv1alpha1.OfferPublished {
+		return
+	}
+	next := offer.NextWindowChange(time.Now())
+	if next.IsZero() {
+		return
+	}
+
+	offerID := offer.OfferID
+	oh.timers[offerID] = time.AfterFunc(time.Until(next), func() {
+		log.Printf("Validity window of offer %s changed: synchronizing brokers", offerID)
+		// the stored offer is read again, so a timer firing after an update acts on the updated window
+		if err := oh.synchronizeSingleOffer(offerID, false); err != nil {
+			log.Printf("Failed to synchronize offer %s: %s", offerID, err)
+		}
+	})
+	log.Printf("Offer %s scheduled for synchronization at %s", offerID, next.Format(time.RFC3339))
+}
+
+func (oh *OffersHandler) unschedule(offerID string) {
+	oh.timersMutex.Lock()
+	defer oh.timersMutex.Unlock()
+	if timer, ok := oh.timers[offerID]; ok {
+		timer.Stop()
+		delete(oh.timers, offerID)
+	}
+}
+
+func (oh *OffersHandler) scheduled() int {
+	oh.timersMutex.Lock()
+	defer oh.timersMutex.Unlock()
+	return len(oh.timers)
+}
@@ -0,0 +1,106 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	"connector/pkg/store"
+)
+
+// nextCursorHeader carries the cursor of the next page of offers, if any
+const nextCursorHeader = "X-Next-Cursor"
+
+// parseOfferQuery reads the filters, the sort order and the page of GET /offers from the query parameters:
+//
+//	type=<offer type>&status=<status>[,<status>...]&name=<substring>
+//	resource=<name><op><quantity> (repeatable, op one of >=, <=, >, <, =)
+//	min-price=<amount>&max-price=<amount> (monthly estimate of a plan)
+//	sort=[-]created|[-]cost&limit=<n>&cursor=<cursor>
+func parseOfferQuery(req *http.Request) (*store.OfferQuery, error) {
+	params := req.URL.Query()
+	query := &store.OfferQuery{
+		Type:   params.Get("type"),
+		Name:   params.Get("name"),
+		Cursor: params.Get("cursor"),
+	}
+
+	if status := params.Get("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			query.Statuses = append(query.Statuses, catalogv1alpha1.OfferStatus(strings.TrimSpace(s)))
+		}
+	}
+
+	for _, expr := range params["resource"] {
+		filter, err := parseResourceFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		query.Resources = append(query.Resources, *filter)
+	}
+
+	for name, bound := range map[string]**catalogv1alpha1.Amount{"min-price": &query.MinCost, "max-price": &query.MaxCost} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		amount, err := catalogv1alpha1.ParseAmount(value)
+		if err != nil {
+			return nil, fmt.Errorf(`{"error":"invalid %s: %s"}`, name, err)
+		}
+		*bound = &amount
+	}
+
+	if sort := params.Get("sort"); sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.Sort = store.OfferSort(strings.TrimPrefix(sort, "-"))
+		if query.Sort != store.SortByCreated && query.Sort != store.SortByCost {
+			return nil, fmt.Errorf(`{"error":"invalid sort %q, expected created or cost, optionally prefixed by -"}`, sort)
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf(`{"error":"invalid limit %q, expected a positive integer"}`, limit)
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+// parseResourceFilter parses a resource range, e.g. cpu>=4 or memory<16Gi
+func parseResourceFilter(expr string) (*store.ResourceFilter, error) {
+	i := strings.IndexAny(expr, "<>=")
+	if i <= 0 {
+		return nil, fmt.Errorf(`{"error":"invalid resource filter %q, expected e.g. cpu>=4"}`, expr)
+	}
+	op := expr[i : i+1]
+	if i+1 < len(expr) && expr[i+1] == '=' && op != "=" {
+		op += "="
+	}
+	value := expr[i+len(op):]
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"invalid resource filter %q: %s"}`, expr, err)
+	}
+	return &store.ResourceFilter{Resource: expr[:i], Op: op, Milli: quantity.MilliValue()}, nil
+}
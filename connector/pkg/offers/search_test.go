@@ -0,0 +1,128 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	"connector/pkg/store"
+)
+
+func TestParseOfferQuery(t *testing.T) {
+	amount := func(s string) *catalogv1alpha1.Amount {
+		a := catalogv1alpha1.MustParseAmount(s)
+		return &a
+	}
+	tests := []struct {
+		name    string
+		query   string
+		want    *store.OfferQuery
+		wantErr bool
+	}{
+		{name: "empty", query: "", want: &store.OfferQuery{}},
+		{
+			name:  "filters",
+			query: "type=compute&name=Small&status=published,%20sold-out&cursor=abc",
+			want: &store.OfferQuery{
+				Type:     "compute",
+				Name:     "Small",
+				Statuses: []catalogv1alpha1.OfferStatus{catalogv1alpha1.OfferPublished, catalogv1alpha1.OfferSoldOut},
+				Cursor:   "abc",
+			},
+		},
+		{
+			name:  "resources",
+			query: "resource=cpu%3E%3D4&resource=memory%3C16Gi",
+			want: &store.OfferQuery{Resources: []store.ResourceFilter{
+				{Resource: "cpu", Op: ">=", Milli: 4000},
+				{Resource: "memory", Op: "<", Milli: 16 << 30 * 1000},
+			}},
+		},
+		{
+			name:  "price range",
+			query: "min-price=10&max-price=99.90",
+			want:  &store.OfferQuery{MinCost: amount("10"), MaxCost: amount("99.9")},
+		},
+		{
+			name:  "sort and limit",
+			query: "sort=-cost&limit=20",
+			want:  &store.OfferQuery{Sort: store.SortByCost, Descending: true, Limit: 20},
+		},
+		{name: "ascending sort", query: "sort=created", want: &store.OfferQuery{Sort: store.SortByCreated}},
+		{name: "unknown sort", query: "sort=name", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "negative limit", query: "limit=-1", wantErr: true},
+		{name: "limit not a number", query: "limit=ten", wantErr: true},
+		{name: "invalid price", query: "min-price=cheap", wantErr: true},
+		{name: "invalid resource", query: "resource=cpu", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/offers?"+tt.query, nil)
+			got, err := parseOfferQuery(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseOfferQuery(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOfferQuery(%q) error = %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOfferQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResourceFilter(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    store.ResourceFilter
+		wantErr bool
+	}{
+		{expr: "cpu>=4", want: store.ResourceFilter{Resource: "cpu", Op: ">=", Milli: 4000}},
+		{expr: "cpu<=500m", want: store.ResourceFilter{Resource: "cpu", Op: "<=", Milli: 500}},
+		{expr: "cpu>2", want: store.ResourceFilter{Resource: "cpu", Op: ">", Milli: 2000}},
+		{expr: "memory<1Gi", want: store.ResourceFilter{Resource: "memory", Op: "<", Milli: 1 << 30 * 1000}},
+		{expr: "nvidia.com/gpu=1", want: store.ResourceFilter{Resource: "nvidia.com/gpu", Op: "=", Milli: 1000}},
+		{expr: ">=4", wantErr: true},
+		{expr: "cpu", wantErr: true},
+		{expr: "cpu>=", wantErr: true},
+		{expr: "cpu>=four", wantErr: true},
+		{expr: "cpu=>4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseResourceFilter(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseResourceFilter(%q) = %+v, want an error", tt.expr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseResourceFilter(%q) error = %v", tt.expr, err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseResourceFilter(%q) = %+v, want %+v", tt.expr, *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+	"connector/pkg/store"
+	"connector/pkg/utils"
+)
+
+// recordSync stores the outcome of an attempt, started at the given time, to post the offer to the broker
+// or to withdraw it (offer is nil). The status of an offer that does not exist anymore is dropped once it is withdrawn.
+func (oh *OffersHandler) recordSync(ctx context.Context, brokerID, offerID string, offer *catalogv1alpha1.Offer, attempted time.Time, syncErr error) {
+	id := syncv1alpha1.OutboxEntryID(brokerID, offerID)
+	statuses, err := oh.statuses.ListByOffer(ctx, offerID)
+	if err != nil {
+		log.Printf("Error reading sync status: %s", err)
+		return
+	}
+	status := syncv1alpha1.SyncStatus{ID: id, BrokerID: brokerID, OfferID: offerID}
+	for _, stored := range statuses {
+		if stored.ID == id {
+			status = stored
+		}
+	}
+
+	status.Operation = syncv1alpha1.SyncDelete
+	if offer != nil {
+		status.Operation = syncv1alpha1.SyncPost
+	}
+	status.LastAttempt = attempted.Unix()
+	if syncErr != nil {
+		status.LastError = syncErr.Error()
+	} else {
+		status.LastError = ""
+		status.LastSuccess = time.Now().Unix()
+		status.ContentHash = ""
+		if offer != nil {
+			status.ContentHash = contentHash(offer)
+		}
+	}
+
+	if syncErr == nil && offer == nil {
+		if _, err := oh.offers.Get(ctx, offerID); errors.Is(err, store.ErrNotFound) {
+			err = oh.statuses.Delete(ctx, id)
+			if err != nil {
+				log.Printf("Error updating sync status: %s", err)
+			}
+			return
+		}
+	}
+	if err := oh.statuses.Save(ctx, status); err != nil {
+		log.Printf("Error updating sync status: %s", err)
+	}
+}
+
+// syncStatuses returns the sync status of the offer with every broker it has been sent to or has a pending change for,
+// or of every offer if offerID is empty
+func (oh *OffersHandler) syncStatuses(ctx context.Context, offerID string) ([]syncv1alpha1.SyncStatus, error) {
+	var statuses []syncv1alpha1.SyncStatus
+	var offers []catalogv1alpha1.Offer
+	var err error
+	if offerID == "" {
+		statuses, err = oh.statuses.List(ctx)
+		if err == nil {
+			offers, err = oh.offers.List(ctx)
+		}
+	} else {
+		statuses, err = oh.statuses.ListByOffer(ctx, offerID)
+		if err == nil {
+			var offer *catalogv1alpha1.Offer
+			offer, err = oh.offers.Get(ctx, offerID)
+			if offer != nil {
+				offers = append(offers, *offer)
+			}
+			if errors.Is(err, store.ErrNotFound) {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := oh.outbox.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*syncv1alpha1.SyncStatus, len(statuses))
+	for i := range statuses {
+		byID[statuses[i].ID] = &statuses[i]
+	}
+	pending := make(map[string]bool)
+	// brokers with a pending clean sync, which sends every offer again
+	cleaning := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Operation == syncv1alpha1.SyncClean {
+			cleaning[entry.BrokerID] = true
+			continue
+		}
+		if offerID != "" && entry.OfferID != offerID {
+			continue
+		}
+		pending[entry.ID] = true
+		if _, ok := byID[entry.ID]; !ok {
+			// never attempted yet
+			statuses = append(statuses, syncv1alpha1.SyncStatus{ID: entry.ID, BrokerID: entry.BrokerID, OfferID: entry.OfferID})
+		}
+	}
+
+	current := make(map[string]*catalogv1alpha1.Offer, len(offers))
+	for i := range offers {
+		current[offers[i].OfferID] = &offers[i]
+	}
+	now := time.Now()
+	for i := range statuses {
+		status := &statuses[i]
+		expected := ""
+		if offer, ok := current[status.OfferID]; ok && listed(offer, now) && offer.TargetsBroker(status.BrokerID) {
+			expected = contentHash(offer)
+		}
+		status.Pending = pending[status.ID] || cleaning[status.BrokerID]
+		status.UpToDate = !status.Pending && status.LastError == "" && status.ContentHash == expected
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].BrokerID != statuses[j].BrokerID {
+			return statuses[i].BrokerID < statuses[j].BrokerID
+		}
+		return statuses[i].OfferID < statuses[j].OfferID
+	})
+	return statuses, nil
+}
+
+// getOfferSync returns the sync status of the offer with every broker
+func (oh *OffersHandler) getOfferSync(w http.ResponseWriter, req *http.Request) {
+	offerID := mux.Vars(req)["id"]
+	statuses, err := oh.syncStatuses(req.Context(), offerID)
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	if len(statuses) == 0 {
+		// an offer never sent to any broker has no status, one that does not exist is not found
+		if _, err := oh.offers.Get(req.Context(), offerID); err != nil {
+			utils.WriteResponseError(w, revisionErrorCode(err, false), err)
+			return
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	utils.WriteResponse(w, statuses, "offer sync status", "", false)
+}
+
+// getSyncStatus returns the sync status of the offers of every registered broker, optionally only of a broker
+func (oh *OffersHandler) getSyncStatus(w http.ResponseWriter, req *http.Request) {
+	brokers, err := oh.brokerHandler.GetBrokerList()
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	statuses, err := oh.syncStatuses(req.Context(), "")
+	if err != nil {
+		utils.WriteResponseError(w, 500, err)
+		return
+	}
+	brokerID := req.URL.Query().Get("broker-id")
+	summaries := []syncv1alpha1.BrokerSyncStatus{}
+	for _, broker := range *brokers {
+		if brokerID != "" && broker.ID != brokerID {
+			continue
+		}
+		summary := syncv1alpha1.BrokerSyncStatus{BrokerID: broker.ID, Offers: []syncv1alpha1.SyncStatus{}}
+		for _, status := range statuses {
+			if status.BrokerID != broker.ID {
+				continue
+			}
+			summary.Offers = append(summary.Offers, status)
+			if status.UpToDate {
+				summary.UpToDate++
+			} else {
+				summary.OutOfDate++
+			}
+			if status.LastSuccess > summary.LastSuccess {
+				summary.LastSuccess = status.LastSuccess
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	utils.WriteResponse(w, summaries, "sync status", "", false)
+}
@@ -15,12 +15,18 @@
 package offers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
 )
 
+// synchronizeSingleOffer records in the outbox that every broker targeted by the offer must be brought up to date,
+// and schedules the next change of its validity window. The outbox worker delivers the change to the brokers,
+// withdrawing the offer from those it must not be listed on. With deletion, the offer is withdrawn from every broker.
 func (oh *OffersHandler) synchronizeSingleOffer(offerID string, deletion bool) error {
 	var localOffer *catalogv1alpha1.Offer
 	var err error
@@ -29,6 +35,9 @@ func (oh *OffersHandler) synchronizeSingleOffer(offerID string, deletion bool) e
 		if err != nil {
 			return err
 		}
+		oh.schedule(localOffer)
+	} else {
+		oh.unschedule(offerID)
 	}
 
 	brokers, err := oh.brokerHandler.GetBrokerList()
@@ -36,38 +45,33 @@ func (oh *OffersHandler) synchronizeSingleOffer(offerID string, deletion bool) e
 		return err
 	}
 
+	operation := syncv1alpha1.SyncDelete
+	// offers that are not published anymore, or outside their validity window, are withdrawn
+	if localOffer != nil && listed(localOffer, time.Now()) {
+		operation = syncv1alpha1.SyncPost
+	}
 	for _, broker := range *brokers {
 		if !broker.Enabled {
 			continue
 		}
-		if deletion {
-			err := broker.DeleteOffer(offerID)
-			if err != nil {
-				return fmt.Errorf("Failed to delete offer %s from broker %s: %s", offerID, broker.Name, err)
-			}
-		} else {
-			err = broker.PostOffer(*localOffer)
-			if err != nil {
-				return fmt.Errorf("Failed to post offer %s to broker %s: %s", offerID, broker.Name, err)
-			}
+		// the offer has been withdrawn from the brokers it does not target anymore when its targets changed
+		if localOffer != nil && !localOffer.TargetsBroker(broker.ID) {
+			continue
+		}
+		if err := oh.enqueue(context.Background(), broker.ID, offerID, operation); err != nil {
+			return err
 		}
-		log.Printf("Broker %q updated", broker.ID)
 	}
-	log.Println("All brokers updated")
 	return nil
 }
 
 // synchronizeOffers updates the list of offers on each broker, bringing it up to date with the local version.
 // If deletion is true, the offers are only deleted from the brokers, not added.
 func (oh *OffersHandler) SyncOffers() error {
-	//var offers []manager.Offer
-	var localOffersMap map[string]catalogv1alpha1.Offer
-
-	offers, err := getMyOffers(oh.offersCollection)
+	offers, err := oh.publishedOffers(context.Background())
 	if err != nil {
 		return err
 	}
-	localOffersMap = sliceToMap(*offers)
 
 	brokers, err := oh.brokerHandler.GetBrokerList()
 	if err != nil {
@@ -78,27 +82,18 @@ func (oh *OffersHandler) SyncOffers() error {
 		if !broker.Enabled {
 			continue
 		}
-		for _, offer := range localOffersMap {
-			err = broker.PostOffer(offer)
-			if err != nil {
-				return fmt.Errorf(`{"error":"Failed to post offer %s to broker %s: %s"}`, offer.OfferID, broker.Name, err)
+		for _, offer := range offersForBroker(offers, broker.ID) {
+			if err := oh.enqueue(context.Background(), broker.ID, offer.OfferID, syncv1alpha1.SyncPost); err != nil {
+				return err
 			}
 		}
-		log.Printf("Broker %q updated: Sync", broker.ID)
+		log.Printf("Broker %q queued: Sync", broker.ID)
 	}
-	log.Println("All brokers updated")
 	return nil
 }
 
+// CleanSyncOffers records in the outbox that the offers of every broker must be replaced with the local ones.
 func (oh *OffersHandler) CleanSyncOffers() error {
-	//var offers []manager.Offer
-	var localOffersMap map[string]catalogv1alpha1.Offer
-	offers, err := getMyOffers(oh.offersCollection)
-	if err != nil {
-		return err
-	}
-	localOffersMap = sliceToMap(*offers)
-
 	brokers, err := oh.brokerHandler.GetBrokerList()
 	if err != nil {
 		return err
@@ -108,75 +103,50 @@ func (oh *OffersHandler) CleanSyncOffers() error {
 		if !broker.Enabled {
 			continue
 		}
-		err := broker.DeleteAllOffers()
-		if err != nil {
-			return fmt.Errorf(`{"error":"Failed to delete all offers from broker %s: %s"}`, broker.Name, err)
-		}
-		for _, offer := range localOffersMap {
-			err = broker.PostOffer(offer)
-			if err != nil {
-				return fmt.Errorf(`{"error":"Failed to post offer %s to broker %s: %s"}`, offer.OfferID, broker.Name, err)
-			}
+		if err := oh.enqueue(context.Background(), broker.ID, syncv1alpha1.CleanSyncOfferID, syncv1alpha1.SyncClean); err != nil {
+			return err
 		}
-
-		log.Printf("Broker %q updated: Clean Sync", broker.ID)
+		log.Printf("Broker %q queued: Clean Sync", broker.ID)
 	}
-	log.Println("All brokers updated")
 	return nil
 }
 
+// SelectiveSyncOffers records in the outbox that every offer targeting the broker must be sent to it.
 func (oh *OffersHandler) SelectiveSyncOffers(brokerID string) error {
-	//var localOffersMap map[string]connector.Offer
-	//var offers *[]connector.Offer
-
-	offers, err := getMyOffers(oh.offersCollection)
+	offers, err := oh.publishedOffers(context.Background())
 	if err != nil {
 		return err
 	}
-	//localOffersMap = sliceToMap(*offers)
 
-	log.Printf("Syncronizing offers to broker %s: %v, %v", brokerID, offers, *offers)
 	broker, err := oh.brokerHandler.GetBroker(brokerID)
 	if err != nil {
 		return err
 	}
-	if broker.Enabled {
-		err = broker.BulkPostOffer(*offers)
-		if err != nil {
-			return fmt.Errorf(`{"error":"Failed to post offers to broker %s: %s"}`, broker.Name, err)
+	if !broker.Enabled {
+		return nil
+	}
+	for _, offer := range offersForBroker(offers, broker.ID) {
+		if err := oh.enqueue(context.Background(), broker.ID, offer.OfferID, syncv1alpha1.SyncPost); err != nil {
+			return err
 		}
-		log.Printf("Broker %q updated: Selective Sync", broker.ID)
 	}
+	log.Printf("Broker %q queued: Selective Sync", broker.ID)
 	return nil
 }
 
+// SelectiveCleanSyncOffers records in the outbox that the offers of the broker must be replaced with the local ones.
 func (oh *OffersHandler) SelectiveCleanSyncOffers(brokerID string) error {
-	var localOffersMap map[string]catalogv1alpha1.Offer
-	offers, err := getMyOffers(oh.offersCollection)
-	if err != nil {
-		return err
-	}
-	localOffersMap = sliceToMap(*offers)
-
 	broker, err := oh.brokerHandler.GetBroker(brokerID)
 	if err != nil {
 		return err
 	}
-
 	if !broker.Enabled {
-		err := broker.DeleteAllOffers()
-		if err != nil {
-			return fmt.Errorf(`{"error":"Failed to delete all offers from broker %s: %s"}`, broker.Name, err)
-		}
-		for _, offer := range localOffersMap {
-			err = broker.PostOffer(offer)
-			if err != nil {
-				return fmt.Errorf(`{"error":"Failed to post offer %s to broker %s: %s"}`, offer.OfferID, broker.Name, err)
-			}
-		}
-		log.Printf("Broker %q updated: Selective Clean Sync", broker.ID)
+		return nil
 	}
-
+	if err := oh.enqueue(context.Background(), broker.ID, syncv1alpha1.CleanSyncOfferID, syncv1alpha1.SyncClean); err != nil {
+		return err
+	}
+	log.Printf("Broker %q queued: Selective Clean Sync", broker.ID)
 	return nil
 }
 
@@ -185,9 +155,63 @@ func (oh *OffersHandler) SelectiveDeleteSyncOffers(brokerID string) error {
 	if err != nil {
 		return err
 	}
-	err = broker.DeleteAllOffers()
+	ctx, cancel := oh.executor.WithTimeout(context.Background())
+	defer cancel()
+	client, err := oh.brokerHandler.BrokerClient(broker)
+	if err != nil {
+		return fmt.Errorf(`{"error":"Failed to reach broker %s: %s"}`, broker.Name, err)
+	}
+	err = client.DeleteAllOffers(ctx)
 	if err != nil {
 		return fmt.Errorf(`{"error":"Failed to delete all offers from broker %s: %s"}`, broker.Name, err)
 	}
 	return nil
 }
+
+// withdrawFromRemovedBrokers withdraws the offer from the brokers targeted by its previous version but not by the current one
+func (oh *OffersHandler) withdrawFromRemovedBrokers(previous, current *catalogv1alpha1.Offer) error {
+	if !listed(previous, time.Now()) {
+		return nil
+	}
+	brokers, err := oh.brokerHandler.GetBrokerList()
+	if err != nil {
+		return err
+	}
+	for _, broker := range *brokers {
+		if !broker.Enabled || !previous.TargetsBroker(broker.ID) || current.TargetsBroker(broker.ID) {
+			continue
+		}
+		if err := oh.enqueue(context.Background(), broker.ID, current.OfferID, syncv1alpha1.SyncDelete); err != nil {
+			return err
+		}
+		log.Printf("Offer %s queued for withdrawal from broker %q", current.OfferID, broker.ID)
+	}
+	return nil
+}
+
+// offersForBroker returns the offers that target the broker with the given ID
+func offersForBroker(offers []catalogv1alpha1.Offer, brokerID string) []catalogv1alpha1.Offer {
+	targeted := make([]catalogv1alpha1.Offer, 0, len(offers))
+	for i := range offers {
+		if offers[i].TargetsBroker(brokerID) {
+			targeted = append(targeted, offers[i])
+		}
+	}
+	return targeted
+}
+
+// publishedOffers returns the offers to be sent to the brokers
+func (oh *OffersHandler) publishedOffers(ctx context.Context) ([]catalogv1alpha1.Offer, error) {
+	offers, err := oh.offers.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	published := make([]catalogv1alpha1.Offer, 0, len(offers))
+	for i, offer := range offers {
+		if listed(&offers[i], now) {
+			published = append(published, offer)
+		}
+	}
+	return published, nil
+}
@@ -15,9 +15,11 @@
 package offers
 
 import (
+	"context"
+
 	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
 )
 
 func (oh *OffersHandler) GetOfferByID(offerID string) (*catalogv1alpha1.Offer, error) {
-	return getOfferByID(oh.offersCollection, offerID)
+	return oh.offers.Get(context.Background(), offerID)
 }
@@ -0,0 +1,125 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NewBoltStore returns a Store that keeps every document in a single bbolt file at path,
+// so that small clusters can run the connector without a MongoDB instance.
+// Each collection is a bucket whose keys are the identifiers used for lookups on MongoDB.
+func NewBoltStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	buckets := []string{BROKER_COLLECTION, OFFER_COLLECTION, OFFER_REVISION_COLLECTION, SYNC_OUTBOX_COLLECTION, SYNC_STATUS_COLLECTION, CONTRACT_COLLECTION, INFO_COLLECTION, MIGRATION_COLLECTION}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating buckets: %w", err)
+	}
+
+	s := newDocumentStore(
+		&boltCollection{db: db, bucket: []byte(BROKER_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(OFFER_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(OFFER_REVISION_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(SYNC_OUTBOX_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(SYNC_STATUS_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(CONTRACT_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(INFO_COLLECTION)},
+		&boltCollection{db: db, bucket: []byte(MIGRATION_COLLECTION)},
+	)
+	s.close = func(context.Context) error { return db.Close() }
+	return s, nil
+}
+
+// boltCollection stores BSON-encoded documents in a bbolt bucket. Documents are visited in key order.
+type boltCollection struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func (c *boltCollection) put(key string, doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).Put([]byte(key), raw)
+	})
+}
+
+func (c *boltCollection) get(key string, out interface{}) error {
+	return c.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(c.bucket).Get([]byte(key))
+		if raw == nil {
+			return ErrNotFound
+		}
+		// raw is only valid inside the transaction, Unmarshal copies what it needs
+		return bson.Unmarshal(raw, out)
+	})
+}
+
+func (c *boltCollection) delete(key string) (bool, error) {
+	deleted := false
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(c.bucket)
+		if b.Get([]byte(key)) == nil {
+			return nil
+		}
+		deleted = true
+		return b.Delete([]byte(key))
+	})
+	return deleted, err
+}
+
+// each copies the documents inside a read transaction and decodes them after it is closed,
+// so that a slow decode, e.g. writing a backup to a client, does not hold the transaction and block the writers.
+func (c *boltCollection) each(decode func(key string, raw []byte) error) error {
+	var keys []string
+	var raws [][]byte
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).ForEach(func(key, raw []byte) error {
+			// key and raw are only valid inside the transaction
+			keys = append(keys, string(key))
+			raws = append(raws, append([]byte(nil), raw...))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, raw := range raws {
+		if err := decode(keys[i], raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,726 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+)
+
+// collection is a minimal key-value document collection. Documents are BSON-encoded,
+// so that they keep the same layout they have on MongoDB.
+type collection interface {
+	put(key string, doc interface{}) error
+	// get returns ErrNotFound if there is no document with the given key.
+	get(key string, out interface{}) error
+	delete(key string) (bool, error)
+	// each calls decode on every document until it returns an error.
+	each(decode func(key string, raw []byte) error) error
+}
+
+// newDocumentStore returns a Store whose repositories are implemented on top of plain collections.
+// Secondary lookups (e.g. broker path, buyer-cluster-id) scan the whole collection.
+func newDocumentStore(brokers, offers, offerRevisions, syncOutbox, syncStatus, contracts, info, migrations collection) *Store {
+	revisions := &docOfferRevisions{c: offerRevisions}
+	return &Store{
+		Brokers:        &docBrokers{c: brokers},
+		Offers:         &historyOffers{OfferRepository: &docOffers{c: offers}, revisions: revisions},
+		OfferRevisions: revisions,
+		SyncOutbox:     &docSyncOutbox{c: syncOutbox},
+		SyncStatus:     &docSyncStatus{c: syncStatus},
+		Contracts:      &docContracts{c: contracts},
+		Info:           &docInfo{c: info},
+
+		migrations: &docMigrations{
+			collections: map[string]collection{
+				BROKER_COLLECTION:   brokers,
+				OFFER_COLLECTION:    offers,
+				CONTRACT_COLLECTION: contracts,
+				INFO_COLLECTION:     info,
+			},
+			records: migrations,
+		},
+	}
+}
+
+type docBrokers struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (b *docBrokers) List(ctx context.Context) ([]brokerv1alpha1.BrokerDocument, error) {
+	var brokers []brokerv1alpha1.BrokerDocument
+	err := b.c.each(func(_ string, raw []byte) error {
+		var broker brokerv1alpha1.BrokerDocument
+		if err := bson.Unmarshal(raw, &broker); err != nil {
+			return err
+		}
+		brokers = append(brokers, broker)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	return brokers, nil
+}
+
+func (b *docBrokers) Each(ctx context.Context, fn func(broker brokerv1alpha1.BrokerDocument) error) error {
+	return b.c.each(func(_ string, raw []byte) error {
+		var broker brokerv1alpha1.BrokerDocument
+		if err := bson.Unmarshal(raw, &broker); err != nil {
+			return fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+		}
+		return fn(broker)
+	})
+}
+
+func (b *docBrokers) Get(ctx context.Context, id string) (*brokerv1alpha1.BrokerDocument, error) {
+	var broker brokerv1alpha1.BrokerDocument
+	if err := b.c.get(id, &broker); err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, err)
+	}
+	return &broker, nil
+}
+
+func (b *docBrokers) GetByPath(ctx context.Context, path string) (*brokerv1alpha1.BrokerDocument, error) {
+	brokers, err := b.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range brokers {
+		if brokers[i].Path == path {
+			return &brokers[i], nil
+		}
+	}
+	return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, ErrNotFound)
+}
+
+func (b *docBrokers) Upsert(ctx context.Context, broker brokerv1alpha1.BrokerDocument) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	broker.SchemaVersion = SchemaVersion
+	if err := b.c.put(broker.ID, broker); err != nil {
+		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (b *docBrokers) SetEnabled(ctx context.Context, id string, enabled bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	broker := brokerv1alpha1.BrokerDocument{ID: id}
+	if err := b.c.get(id, &broker); err != nil && err != ErrNotFound {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	broker.Enabled = enabled
+	broker.SchemaVersion = SchemaVersion
+	if err := b.c.put(id, broker); err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	return nil
+}
+
+func (b *docBrokers) SetToken(ctx context.Context, id, token string, expiry int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var broker brokerv1alpha1.BrokerDocument
+	if err := b.c.get(id, &broker); err != nil {
+		return fmt.Errorf(`{"error":"updating broker %s: %w"}`, id, err)
+	}
+	broker.JWTToken = token
+	broker.TokenExpiry = expiry
+	if err := b.c.put(id, broker); err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	return nil
+}
+
+func (b *docBrokers) ReplaceToken(ctx context.Context, id, current, token string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var broker brokerv1alpha1.BrokerDocument
+	if err := b.c.get(id, &broker); err != nil {
+		return fmt.Errorf(`{"error":"updating broker %s: %w"}`, id, err)
+	}
+	if broker.JWTToken != current {
+		return fmt.Errorf(`{"error":"the token of broker %s has changed: %w"}`, id, ErrConflict)
+	}
+	broker.JWTToken = token
+	if err := b.c.put(id, broker); err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	return nil
+}
+
+func (b *docBrokers) Delete(ctx context.Context, id string) error {
+	if _, err := b.c.delete(id); err != nil {
+		return fmt.Errorf(`{"error":"deleting from database: %s"}`, err)
+	}
+	return nil
+}
+
+type docOffers struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (o *docOffers) List(ctx context.Context) ([]catalogv1alpha1.Offer, error) {
+	var offers []catalogv1alpha1.Offer
+	err := o.c.each(func(_ string, raw []byte) error {
+		var offer catalogv1alpha1.Offer
+		if err := bson.Unmarshal(raw, &offer); err != nil {
+			return err
+		}
+		offers = append(offers, offer)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding offers: %s"}`, err)
+	}
+	return offers, nil
+}
+
+func (o *docOffers) Each(ctx context.Context, fn func(offer catalogv1alpha1.Offer) error) error {
+	return o.c.each(func(_ string, raw []byte) error {
+		var offer catalogv1alpha1.Offer
+		if err := bson.Unmarshal(raw, &offer); err != nil {
+			return fmt.Errorf(`{"error":"Decoding offers: %s"}`, err)
+		}
+		return fn(offer)
+	})
+}
+
+// Find scans the whole collection, filtering and sorting the offers in memory.
+func (o *docOffers) Find(ctx context.Context, query OfferQuery) (*OfferPage, error) {
+	cursor, err := query.check()
+	if err != nil {
+		return nil, err
+	}
+	offers, err := o.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return query.page(offers, cursor), nil
+}
+
+func (o *docOffers) Get(ctx context.Context, offerID string) (*catalogv1alpha1.Offer, error) {
+	var offer catalogv1alpha1.Offer
+	if err := o.c.get(offerID, &offer); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding offer %s: %w"}`, offerID, err)
+	}
+	return &offer, nil
+}
+
+func (o *docOffers) Upsert(ctx context.Context, offer catalogv1alpha1.Offer) error {
+	offer.SchemaVersion = SchemaVersion
+	offer.Search = offerSearch(&offer)
+	if err := o.c.put(offer.OfferID, offer); err != nil {
+		return fmt.Errorf(`{"error":"saving offer to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (o *docOffers) Save(ctx context.Context, offer catalogv1alpha1.Offer, revision int64) (*catalogv1alpha1.Offer, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	current, err := o.check(offer.OfferID, revision)
+	if err != nil && !(errors.Is(err, ErrNotFound) && (revision == 0 || revision == AnyRevision)) {
+		return nil, err
+	}
+	if current != nil && revision == 0 {
+		return nil, fmt.Errorf(`{"error":"offer %s already exists: %w"}`, offer.OfferID, ErrConflict)
+	}
+
+	offer.SchemaVersion = SchemaVersion
+	offer.Search = offerSearch(&offer)
+	offer.Revision = 1
+	if current != nil {
+		offer.Revision = current.Revision + 1
+	}
+	if err := o.c.put(offer.OfferID, offer); err != nil {
+		return nil, fmt.Errorf(`{"error":"saving offer to database: %s"}`, err)
+	}
+	return &offer, nil
+}
+
+func (o *docOffers) Delete(ctx context.Context, offerID string, revision int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.check(offerID, revision); err != nil {
+		return err
+	}
+	if _, err := o.c.delete(offerID); err != nil {
+		return fmt.Errorf(`{"error":"deleting from database: %s"}`, err)
+	}
+	return nil
+}
+
+// check returns the stored offer if it has the given revision (or any revision if it is AnyRevision or 0)
+func (o *docOffers) check(offerID string, revision int64) (*catalogv1alpha1.Offer, error) {
+	var current catalogv1alpha1.Offer
+	if err := o.c.get(offerID, &current); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf(`{"error":"no such offer %s on database: %w"}`, offerID, ErrNotFound)
+		}
+		return nil, fmt.Errorf(`{"error":"Decoding offer %s: %s"}`, offerID, err)
+	}
+	if revision > 0 && current.Revision != revision {
+		return nil, fmt.Errorf(`{"error":"offer %s is at revision %d, not %d: %w"}`, offerID, current.Revision, revision, ErrConflict)
+	}
+	return &current, nil
+}
+
+// docOfferRevisions keys the revisions by offer-id and revision, e.g. "offer/3"
+type docOfferRevisions struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (r *docOfferRevisions) List(ctx context.Context, offerID string) ([]catalogv1alpha1.OfferRevision, error) {
+	var revisions []catalogv1alpha1.OfferRevision
+	err := r.c.each(func(_ string, raw []byte) error {
+		var rev catalogv1alpha1.OfferRevision
+		if err := bson.Unmarshal(raw, &rev); err != nil {
+			return err
+		}
+		if rev.OfferID == offerID {
+			revisions = append(revisions, rev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding revisions of offer %s: %s"}`, offerID, err)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+func (r *docOfferRevisions) Get(ctx context.Context, offerID string, revision int64) (*catalogv1alpha1.OfferRevision, error) {
+	var rev catalogv1alpha1.OfferRevision
+	if err := r.c.get(revisionKey(offerID, revision), &rev); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding revision %d of offer %s: %w"}`, revision, offerID, err)
+	}
+	return &rev, nil
+}
+
+func (r *docOfferRevisions) insert(ctx context.Context, rev catalogv1alpha1.OfferRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := revisionKey(rev.OfferID, rev.Revision)
+	var stored catalogv1alpha1.OfferRevision
+	if err := r.c.get(key, &stored); !errors.Is(err, ErrNotFound) {
+		// revisions are immutable: the first copy is kept
+		return err
+	}
+	if err := r.c.put(key, rev); err != nil {
+		return fmt.Errorf(`{"error":"saving revision %d of offer %s to database: %s"}`, rev.Revision, rev.OfferID, err)
+	}
+	return nil
+}
+
+func (r *docOfferRevisions) latest(ctx context.Context, offerID string) (*catalogv1alpha1.OfferRevision, error) {
+	revisions, err := r.List(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf(`{"error":"offer %s has no revisions: %w"}`, offerID, ErrNotFound)
+	}
+	return &revisions[len(revisions)-1], nil
+}
+
+func revisionKey(offerID string, revision int64) string {
+	return offerID + "/" + strconv.FormatInt(revision, 10)
+}
+
+// docSyncOutbox keys the entries by their ID, e.g. "broker/offer"
+type docSyncOutbox struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (o *docSyncOutbox) List(ctx context.Context) ([]syncv1alpha1.OutboxEntry, error) {
+	var entries []syncv1alpha1.OutboxEntry
+	err := o.c.each(func(_ string, raw []byte) error {
+		var entry syncv1alpha1.OutboxEntry
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading sync outbox from database: %s"}`, err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].NextAttempt < entries[j].NextAttempt })
+	return entries, nil
+}
+
+func (o *docSyncOutbox) Enqueue(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var pending syncv1alpha1.OutboxEntry
+	err := o.c.get(entry.ID, &pending)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf(`{"error":"reading sync outbox from database: %s"}`, err)
+	}
+	if err == nil {
+		entry.Created = pending.Created
+		entry.Attempts = pending.Attempts
+		entry.LastError = pending.LastError
+	}
+	if err := o.c.put(entry.ID, entry); err != nil {
+		return fmt.Errorf(`{"error":"saving sync outbox entry %s to database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *docSyncOutbox) Complete(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.current(entry) {
+		return nil
+	}
+	if _, err := o.c.delete(entry.ID); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync outbox entry %s from database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *docSyncOutbox) Retry(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.current(entry) {
+		return nil
+	}
+	if err := o.c.put(entry.ID, entry); err != nil {
+		return fmt.Errorf(`{"error":"saving sync outbox entry %s to database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *docSyncOutbox) DeleteBroker(ctx context.Context, brokerID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// collect first: some backends do not allow writing while iterating
+	var ids []string
+	err := o.c.each(func(key string, raw []byte) error {
+		var entry syncv1alpha1.OutboxEntry
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		if entry.BrokerID == brokerID {
+			ids = append(ids, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`{"error":"reading sync outbox from database: %s"}`, err)
+	}
+	for _, id := range ids {
+		if _, err := o.c.delete(id); err != nil {
+			return fmt.Errorf(`{"error":"deleting sync outbox entry %s from database: %s"}`, id, err)
+		}
+	}
+	return nil
+}
+
+// current reports whether the stored entry is the given one, i.e. it has not been replaced nor completed
+func (o *docSyncOutbox) current(entry syncv1alpha1.OutboxEntry) bool {
+	var stored syncv1alpha1.OutboxEntry
+	return o.c.get(entry.ID, &stored) == nil && stored.Sequence == entry.Sequence
+}
+
+// docSyncStatus keys the statuses by their ID, e.g. "broker/offer"
+type docSyncStatus struct {
+	c collection
+}
+
+func (s *docSyncStatus) List(ctx context.Context) ([]syncv1alpha1.SyncStatus, error) {
+	return s.filter(func(*syncv1alpha1.SyncStatus) bool { return true })
+}
+
+func (s *docSyncStatus) ListByOffer(ctx context.Context, offerID string) ([]syncv1alpha1.SyncStatus, error) {
+	return s.filter(func(status *syncv1alpha1.SyncStatus) bool { return status.OfferID == offerID })
+}
+
+func (s *docSyncStatus) Save(ctx context.Context, status syncv1alpha1.SyncStatus) error {
+	if err := s.c.put(status.ID, status); err != nil {
+		return fmt.Errorf(`{"error":"saving sync status %s to database: %s"}`, status.ID, err)
+	}
+	return nil
+}
+
+func (s *docSyncStatus) Delete(ctx context.Context, id string) error {
+	if _, err := s.c.delete(id); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync status %s from database: %s"}`, id, err)
+	}
+	return nil
+}
+
+func (s *docSyncStatus) DeleteBroker(ctx context.Context, brokerID string) error {
+	statuses, err := s.filter(func(status *syncv1alpha1.SyncStatus) bool { return status.BrokerID == brokerID })
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if err := s.Delete(ctx, status.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *docSyncStatus) filter(match func(*syncv1alpha1.SyncStatus) bool) ([]syncv1alpha1.SyncStatus, error) {
+	var statuses []syncv1alpha1.SyncStatus
+	err := s.c.each(func(_ string, raw []byte) error {
+		var status syncv1alpha1.SyncStatus
+		if err := bson.Unmarshal(raw, &status); err != nil {
+			return err
+		}
+		if match(&status) {
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading sync status from database: %s"}`, err)
+	}
+	return statuses, nil
+}
+
+type docContracts struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (c *docContracts) List(ctx context.Context) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.filter(func(*contractsv1alpha1.ContractDocument) bool { return true })
+}
+
+func (c *docContracts) Each(ctx context.Context, fn func(contract contractsv1alpha1.ContractDocument) error) error {
+	return c.c.each(func(_ string, raw []byte) error {
+		var contract contractsv1alpha1.ContractDocument
+		if err := bson.Unmarshal(raw, &contract); err != nil {
+			return fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
+		}
+		return fn(contract)
+	})
+}
+
+func (c *docContracts) ListByBuyerID(ctx context.Context, buyerID string) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.filter(func(contract *contractsv1alpha1.ContractDocument) bool { return contract.BuyerID == buyerID })
+}
+
+func (c *docContracts) Get(ctx context.Context, contractID string) (*contractsv1alpha1.ContractDocument, error) {
+	var contract contractsv1alpha1.ContractDocument
+	if err := c.c.get(contractID, &contract); err != nil {
+		return nil, fmt.Errorf(`{"error":"reading contract %s from database: %w"}`, contractID, err)
+	}
+	return &contract, nil
+}
+
+func (c *docContracts) filter(match func(*contractsv1alpha1.ContractDocument) bool) ([]contractsv1alpha1.ContractDocument, error) {
+	var contracts []contractsv1alpha1.ContractDocument
+	err := c.c.each(func(_ string, raw []byte) error {
+		var contract contractsv1alpha1.ContractDocument
+		if err := bson.Unmarshal(raw, &contract); err != nil {
+			return err
+		}
+		if match(&contract) {
+			contracts = append(contracts, contract)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
+	}
+	return contracts, nil
+}
+
+func (c *docContracts) Insert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	contract.Revision = 1
+	return c.Upsert(ctx, contract)
+}
+
+func (c *docContracts) Upsert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// contracts are already keyed by contract-id
+	contract.SchemaVersion = SchemaVersion
+	if err := c.c.put(contract.ContractID, contract); err != nil {
+		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (c *docContracts) ReplaceSellerToken(ctx context.Context, contractID, current, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var contract contractsv1alpha1.ContractDocument
+	if err := c.c.get(contractID, &contract); err != nil {
+		return fmt.Errorf(`{"error":"updating contract %s: %w"}`, contractID, err)
+	}
+	if contract.Seller.Token != current {
+		return fmt.Errorf(`{"error":"the token of contract %s has changed: %w"}`, contractID, ErrConflict)
+	}
+	contract.Seller.Token = token
+	if err := c.c.put(contractID, contract); err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	return nil
+}
+
+type docInfo struct {
+	mu sync.Mutex
+	c  collection
+}
+
+func (i *docInfo) Get(ctx context.Context) (*connectorv1alpha1.ConnectorInfo, error) {
+	var found *connectorv1alpha1.ConnectorInfo
+	err := i.c.each(func(_ string, raw []byte) error {
+		if found != nil {
+			return nil
+		}
+		found = &connectorv1alpha1.ConnectorInfo{}
+		return bson.Unmarshal(raw, found)
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	if found == nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, ErrNotFound)
+	}
+	return found, nil
+}
+
+func (i *docInfo) SetClusterParameters(ctx context.Context, parameters *connectorv1alpha1.ClusterParameters) error {
+	err := i.update(parameters.ClusterID, func(ci *connectorv1alpha1.ConnectorInfo) { ci.ClusterParameters = *parameters })
+	if err != nil {
+		return fmt.Errorf(`{"error":"saving Cluster Parameters to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *docInfo) SetPrettyName(ctx context.Context, clusterID, prettyName string) error {
+	err := i.update(clusterID, func(ci *connectorv1alpha1.ConnectorInfo) { ci.PrettyName = prettyName })
+	if err != nil {
+		return fmt.Errorf(`{"error":"saving Cluster Pretty Name to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *docInfo) SetContractEndpoint(ctx context.Context, clusterID, endpoint string) error {
+	err := i.update(clusterID, func(ci *connectorv1alpha1.ConnectorInfo) { ci.ContractEndpoint = endpoint })
+	if err != nil {
+		return fmt.Errorf(`{"error":"saving Contract Endpoint to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *docInfo) SetReady(ctx context.Context, clusterID string) error {
+	err := i.update(clusterID, func(ci *connectorv1alpha1.ConnectorInfo) { ci.Ready = true })
+	if err != nil {
+		return fmt.Errorf(`{"error":"saving Ready Catalog to database: %s"}`, err)
+	}
+	return nil
+}
+
+// update applies mutate to the info document of clusterID, creating it if missing (upsert).
+func (i *docInfo) update(clusterID string, mutate func(ci *connectorv1alpha1.ConnectorInfo)) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	ci := connectorv1alpha1.ConnectorInfo{ClusterID: clusterID}
+	if err := i.c.get(clusterID, &ci); err != nil && err != ErrNotFound {
+		return err
+	}
+	mutate(&ci)
+	ci.SchemaVersion = SchemaVersion
+	return i.c.put(clusterID, ci)
+}
+
+type docMigrations struct {
+	collections map[string]collection
+	records     collection
+}
+
+func (m *docMigrations) prepare(ctx context.Context) error {
+	// lookups are by key, there are no indexes to create
+	return nil
+}
+
+func (m *docMigrations) rewrite(ctx context.Context, name string, upgrade func(doc bson.M) (bool, error)) error {
+	c, ok := m.collections[name]
+	if !ok {
+		return fmt.Errorf("unknown collection %s", name)
+	}
+	// collect first: some backends do not allow writing while iterating
+	docs := make(map[string]bson.M)
+	var keys []string
+	err := c.each(func(key string, raw []byte) error {
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		docs[key] = doc
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		changed, err := upgrade(docs[key])
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := c.put(key, docs[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *docMigrations) applied(ctx context.Context) ([]MigrationRecord, error) {
+	var records []MigrationRecord
+	err := m.records.each(func(_ string, raw []byte) error {
+		var record MigrationRecord
+		if err := bson.Unmarshal(raw, &record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func (m *docMigrations) record(ctx context.Context, record MigrationRecord) error {
+	return m.records.put(strconv.Itoa(record.Version), record)
+}
@@ -0,0 +1,316 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// Cipher encrypts the credentials before they are written and decrypts them after they are read.
+type Cipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(value string) (string, error)
+}
+
+// WithEncryption returns a Store sharing the backend of s, which keeps the broker JWTs and the
+// Liqo token of the local cluster, including the copies in the sold contracts, encrypted with c.
+// Callers only ever see the decrypted values.
+func (s *Store) WithEncryption(c Cipher) *Store {
+	return &Store{
+		Brokers:        &encryptedBrokers{BrokerRepository: s.Brokers, cipher: c},
+		Offers:         s.Offers,
+		OfferRevisions: s.OfferRevisions,
+		SyncOutbox:     s.SyncOutbox,
+		SyncStatus:     s.SyncStatus,
+		Contracts:      &encryptedContracts{ContractRepository: s.Contracts, cipher: c},
+		Info:           &encryptedInfo{InfoRepository: s.Info, cipher: c},
+		migrations:     s.migrations,
+		close:          s.close,
+	}
+}
+
+// Reencrypt reads and writes back every encrypted field, so that it gets encrypted with the current
+// primary key of the Cipher. Values written before encryption was enabled are encrypted as well.
+// Only the token fields are rewritten, and only if they have not changed since they were read: a token renewed
+// or a contract terminated meanwhile is never overwritten. It returns the number of rewritten documents.
+func (s *Store) Reencrypt(ctx context.Context) (int, error) {
+	count := 0
+	brokers, err := s.Brokers.List(ctx)
+	if err != nil {
+		return count, err
+	}
+	for _, broker := range brokers {
+		err := s.Brokers.ReplaceToken(ctx, broker.ID, broker.JWTToken, broker.JWTToken)
+		if errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			// renewed or removed meanwhile: a renewed token is already encrypted with the primary key
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	contracts, err := s.Contracts.List(ctx)
+	if err != nil {
+		return count, err
+	}
+	for _, contract := range contracts {
+		err := s.Contracts.ReplaceSellerToken(ctx, contract.ContractID, contract.Seller.Token, contract.Seller.Token)
+		if errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	info, err := s.Info.Get(ctx)
+	if errors.Is(err, ErrNotFound) || (err == nil && info.ClusterParameters.ClusterID == "") {
+		return count, nil
+	}
+	if err != nil {
+		return count, err
+	}
+	if err := s.Info.SetClusterParameters(ctx, &info.ClusterParameters); err != nil {
+		return count, err
+	}
+	return count + 1, nil
+}
+
+type encryptedBrokers struct {
+	BrokerRepository
+	cipher Cipher
+}
+
+func (b *encryptedBrokers) List(ctx context.Context) ([]brokerv1alpha1.BrokerDocument, error) {
+	brokers, err := b.BrokerRepository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range brokers {
+		if err := b.decrypt(&brokers[i]); err != nil {
+			return nil, err
+		}
+	}
+	return brokers, nil
+}
+
+func (b *encryptedBrokers) Each(ctx context.Context, fn func(broker brokerv1alpha1.BrokerDocument) error) error {
+	return b.BrokerRepository.Each(ctx, func(broker brokerv1alpha1.BrokerDocument) error {
+		if err := b.decrypt(&broker); err != nil {
+			return err
+		}
+		return fn(broker)
+	})
+}
+
+func (b *encryptedBrokers) Get(ctx context.Context, id string) (*brokerv1alpha1.BrokerDocument, error) {
+	broker, err := b.BrokerRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return broker, b.decrypt(broker)
+}
+
+func (b *encryptedBrokers) GetByPath(ctx context.Context, path string) (*brokerv1alpha1.BrokerDocument, error) {
+	broker, err := b.BrokerRepository.GetByPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return broker, b.decrypt(broker)
+}
+
+func (b *encryptedBrokers) Upsert(ctx context.Context, broker brokerv1alpha1.BrokerDocument) error {
+	token, err := b.cipher.Encrypt(broker.JWTToken)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting broker token: %s"}`, err)
+	}
+	broker.JWTToken = token
+	return b.BrokerRepository.Upsert(ctx, broker)
+}
+
+func (b *encryptedBrokers) SetToken(ctx context.Context, id, token string, expiry int64) error {
+	token, err := b.cipher.Encrypt(token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting broker token: %s"}`, err)
+	}
+	return b.BrokerRepository.SetToken(ctx, id, token, expiry)
+}
+
+// ReplaceToken compares current with the decrypted stored token, since encrypting the same token never gives the same value.
+func (b *encryptedBrokers) ReplaceToken(ctx context.Context, id, current, token string) error {
+	stored, err := b.BrokerRepository.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	plaintext, err := b.cipher.Decrypt(stored.JWTToken)
+	if err != nil {
+		return fmt.Errorf(`{"error":"decrypting token of broker %s: %s"}`, id, err)
+	}
+	if plaintext != current {
+		return fmt.Errorf(`{"error":"the token of broker %s has changed: %w"}`, id, ErrConflict)
+	}
+	encrypted, err := b.cipher.Encrypt(token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting broker token: %s"}`, err)
+	}
+	return b.BrokerRepository.ReplaceToken(ctx, id, stored.JWTToken, encrypted)
+}
+
+func (b *encryptedBrokers) decrypt(broker *brokerv1alpha1.BrokerDocument) error {
+	token, err := b.cipher.Decrypt(broker.JWTToken)
+	if err != nil {
+		return fmt.Errorf(`{"error":"decrypting token of broker %s: %s"}`, broker.ID, err)
+	}
+	broker.JWTToken = token
+	return nil
+}
+
+type encryptedContracts struct {
+	ContractRepository
+	cipher Cipher
+}
+
+func (c *encryptedContracts) List(ctx context.Context) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.decryptAll(c.ContractRepository.List(ctx))
+}
+
+func (c *encryptedContracts) ListByBuyerID(ctx context.Context, buyerID string) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.decryptAll(c.ContractRepository.ListByBuyerID(ctx, buyerID))
+}
+
+func (c *encryptedContracts) Each(ctx context.Context, fn func(contract contractsv1alpha1.ContractDocument) error) error {
+	return c.ContractRepository.Each(ctx, func(contract contractsv1alpha1.ContractDocument) error {
+		if err := c.decrypt(&contract); err != nil {
+			return err
+		}
+		return fn(contract)
+	})
+}
+
+func (c *encryptedContracts) Get(ctx context.Context, contractID string) (*contractsv1alpha1.ContractDocument, error) {
+	contract, err := c.ContractRepository.Get(ctx, contractID)
+	if err != nil {
+		return nil, err
+	}
+	return contract, c.decrypt(contract)
+}
+
+func (c *encryptedContracts) Insert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	return c.write(contract, func(encrypted *contractsv1alpha1.ContractDocument) error {
+		return c.ContractRepository.Insert(ctx, encrypted)
+	})
+}
+
+func (c *encryptedContracts) Upsert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	return c.write(contract, func(encrypted *contractsv1alpha1.ContractDocument) error {
+		return c.ContractRepository.Upsert(ctx, encrypted)
+	})
+}
+
+// ReplaceSellerToken compares current with the decrypted stored token, like encryptedBrokers.ReplaceToken.
+func (c *encryptedContracts) ReplaceSellerToken(ctx context.Context, contractID, current, token string) error {
+	stored, err := c.ContractRepository.Get(ctx, contractID)
+	if err != nil {
+		return err
+	}
+	plaintext, err := c.cipher.Decrypt(stored.Seller.Token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"decrypting token of contract %s: %s"}`, contractID, err)
+	}
+	if plaintext != current {
+		return fmt.Errorf(`{"error":"the token of contract %s has changed: %w"}`, contractID, ErrConflict)
+	}
+	encrypted, err := c.cipher.Encrypt(token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting token of contract %s: %s"}`, contractID, err)
+	}
+	return c.ContractRepository.ReplaceSellerToken(ctx, contractID, stored.Seller.Token, encrypted)
+}
+
+// write stores an encrypted copy of the contract, since the caller keeps using its plaintext one,
+// and copies back the fields set by the repository.
+func (c *encryptedContracts) write(contract *contractsv1alpha1.ContractDocument, store func(*contractsv1alpha1.ContractDocument) error) error {
+	token, err := c.cipher.Encrypt(contract.Seller.Token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting token of contract %s: %s"}`, contract.ContractID, err)
+	}
+	encrypted := *contract
+	encrypted.Seller.Token = token
+	if err := store(&encrypted); err != nil {
+		return err
+	}
+	contract.Revision = encrypted.Revision
+	contract.SchemaVersion = encrypted.SchemaVersion
+	return nil
+}
+
+func (c *encryptedContracts) decryptAll(contracts []contractsv1alpha1.ContractDocument, err error) ([]contractsv1alpha1.ContractDocument, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range contracts {
+		if err := c.decrypt(&contracts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return contracts, nil
+}
+
+func (c *encryptedContracts) decrypt(contract *contractsv1alpha1.ContractDocument) error {
+	token, err := c.cipher.Decrypt(contract.Seller.Token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"decrypting token of contract %s: %s"}`, contract.ContractID, err)
+	}
+	contract.Seller.Token = token
+	return nil
+}
+
+type encryptedInfo struct {
+	InfoRepository
+	cipher Cipher
+}
+
+func (i *encryptedInfo) Get(ctx context.Context) (*connectorv1alpha1.ConnectorInfo, error) {
+	info, err := i.InfoRepository.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := i.cipher.Decrypt(info.ClusterParameters.Token)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"decrypting cluster token: %s"}`, err)
+	}
+	info.ClusterParameters.Token = token
+	return info, nil
+}
+
+func (i *encryptedInfo) SetClusterParameters(ctx context.Context, parameters *connectorv1alpha1.ClusterParameters) error {
+	token, err := i.cipher.Encrypt(parameters.Token)
+	if err != nil {
+		return fmt.Errorf(`{"error":"encrypting cluster token: %s"}`, err)
+	}
+	// the caller keeps using its plaintext copy
+	encrypted := *parameters
+	encrypted.Token = token
+	return i.InfoRepository.SetClusterParameters(ctx, &encrypted)
+}
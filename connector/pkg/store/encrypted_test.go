@@ -0,0 +1,177 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+// prefixCipher "encrypts" with the name of its primary key, and decrypts the values of any key
+type prefixCipher struct {
+	primary string
+}
+
+func (c *prefixCipher) Encrypt(plaintext string) (string, error) {
+	return c.primary + ":" + plaintext, nil
+}
+
+func (c *prefixCipher) Decrypt(value string) (string, error) {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return value, nil
+	}
+	return value[i+1:], nil
+}
+
+// racingBrokers renews the token of every broker as soon as they are listed
+type racingBrokers struct {
+	BrokerRepository
+}
+
+func (b *racingBrokers) List(ctx context.Context) ([]brokerv1alpha1.BrokerDocument, error) {
+	brokers, err := b.BrokerRepository.List(ctx)
+	for _, broker := range brokers {
+		if err := b.SetToken(ctx, broker.ID, "renewed", 100); err != nil {
+			return nil, err
+		}
+	}
+	return brokers, err
+}
+
+// racingContracts terminates every contract as soon as they are listed
+type racingContracts struct {
+	ContractRepository
+}
+
+func (c *racingContracts) List(ctx context.Context) ([]contractsv1alpha1.ContractDocument, error) {
+	contracts, err := c.ContractRepository.List(ctx)
+	for _, contract := range contracts {
+		contract.Enabled = false
+		if err := c.Upsert(ctx, &contract); err != nil {
+			return nil, err
+		}
+	}
+	return contracts, err
+}
+
+func seedEncrypted(t *testing.T, s *Store) {
+	ctx := context.Background()
+	if err := s.Brokers.Upsert(ctx, brokerv1alpha1.BrokerDocument{ID: "b1", Path: "/b1", JWTToken: "jwt"}); err != nil {
+		t.Fatal(err)
+	}
+	contract := &contractsv1alpha1.ContractDocument{
+		ContractID: "c1",
+		Enabled:    true,
+		Seller:     connectorv1alpha1.Provider{ClusterParameters: connectorv1alpha1.ClusterParameters{ClusterID: "local", Token: "liqo"}},
+	}
+	if err := s.Contracts.Insert(ctx, contract); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	plain := NewMemoryStore()
+	cipher := &prefixCipher{primary: "k1"}
+	seedEncrypted(t, plain.WithEncryption(cipher))
+
+	cipher.primary = "k2"
+	count, err := plain.WithEncryption(cipher).Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Reencrypt() rewrote %d documents, want 2", count)
+	}
+	broker, _ := plain.Brokers.Get(ctx, "b1")
+	contract, _ := plain.Contracts.Get(ctx, "c1")
+	if broker.JWTToken != "k2:jwt" || contract.Seller.Token != "k2:liqo" {
+		t.Errorf("stored tokens = %q, %q, want them encrypted with k2", broker.JWTToken, contract.Seller.Token)
+	}
+	if !contract.Enabled || contract.Revision != 1 {
+		t.Errorf("Reencrypt() changed the contract: %+v", contract)
+	}
+}
+
+func TestReencryptKeepsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	plain := NewMemoryStore()
+	cipher := &prefixCipher{primary: "k1"}
+	seedEncrypted(t, plain.WithEncryption(cipher))
+
+	cipher.primary = "k2"
+	racing := &Store{
+		Brokers:   &racingBrokers{BrokerRepository: plain.Brokers},
+		Contracts: &racingContracts{ContractRepository: plain.Contracts},
+		Info:      plain.Info,
+	}
+	count, err := racing.WithEncryption(cipher).Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the token of the terminated contract is still the one listed
+	if count != 1 {
+		t.Errorf("Reencrypt() rewrote %d documents, want 1", count)
+	}
+	broker, _ := plain.Brokers.Get(ctx, "b1")
+	if broker.JWTToken != "renewed" || broker.TokenExpiry != 100 {
+		t.Errorf("the renewed token has been overwritten: %q", broker.JWTToken)
+	}
+	contract, _ := plain.Contracts.Get(ctx, "c1")
+	if contract.Enabled || contract.Seller.Token != "k2:liqo" {
+		t.Errorf("the terminated contract has been rewritten: %+v", contract)
+	}
+}
+
+func TestReplaceToken(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore().WithEncryption(&prefixCipher{primary: "k1"})
+	seedEncrypted(t, s)
+	tests := []struct {
+		name    string
+		replace func() error
+		wantErr error
+	}{
+		{name: "broker", replace: func() error { return s.Brokers.ReplaceToken(ctx, "b1", "jwt", "new") }},
+		{name: "stale broker token", replace: func() error { return s.Brokers.ReplaceToken(ctx, "b1", "jwt", "newer") }, wantErr: ErrConflict},
+		{name: "missing broker", replace: func() error { return s.Brokers.ReplaceToken(ctx, "b2", "jwt", "new") }, wantErr: ErrNotFound},
+		{name: "contract", replace: func() error { return s.Contracts.ReplaceSellerToken(ctx, "c1", "liqo", "new") }},
+		{name: "stale contract token", replace: func() error { return s.Contracts.ReplaceSellerToken(ctx, "c1", "liqo", "newer") }, wantErr: ErrConflict},
+		{name: "missing contract", replace: func() error { return s.Contracts.ReplaceSellerToken(ctx, "c2", "liqo", "new") }, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.replace()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	broker, _ := s.Brokers.Get(ctx, "b1")
+	contract, _ := s.Contracts.Get(ctx, "c1")
+	if broker.JWTToken != "new" || contract.Seller.Token != "new" {
+		t.Errorf("tokens = %q, %q, want new", broker.JWTToken, contract.Seller.Token)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// offerRevisionLog is the write side of an OfferRevisionRepository, only used by historyOffers.
+type offerRevisionLog interface {
+	OfferRevisionRepository
+	// insert stores rev, unless a copy of the same revision is already stored.
+	insert(ctx context.Context, rev catalogv1alpha1.OfferRevision) error
+	// latest returns the last revision of the offer, ErrNotFound if the offer has no history.
+	latest(ctx context.Context, offerID string) (*catalogv1alpha1.OfferRevision, error)
+}
+
+// historyOffers copies every version of the offers written through the OfferRepository to the revision log.
+// The write of the offer is not undone when its copy fails: the error is returned, and the next Save copies
+// the missing revision.
+type historyOffers struct {
+	OfferRepository
+	revisions offerRevisionLog
+}
+
+func (h *historyOffers) Upsert(ctx context.Context, offer catalogv1alpha1.Offer) error {
+	if err := h.OfferRepository.Upsert(ctx, offer); err != nil {
+		return err
+	}
+	return h.record(ctx, offer)
+}
+
+func (h *historyOffers) Save(ctx context.Context, offer catalogv1alpha1.Offer, revision int64) (*catalogv1alpha1.Offer, error) {
+	if revision != 0 {
+		// the version being replaced may predate the history, or its copy may have failed
+		current, err := h.OfferRepository.Get(ctx, offer.OfferID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if current != nil {
+			if err := h.record(ctx, *current); err != nil {
+				return nil, err
+			}
+		}
+	}
+	saved, err := h.OfferRepository.Save(ctx, offer, revision)
+	if err != nil {
+		return nil, err
+	}
+	if saved.Revision == 1 {
+		if saved, err = h.continueHistory(ctx, saved); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.record(ctx, *saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// Delete keeps the history of the offer, closing it with a tombstone revision that holds the deleted version
+func (h *historyOffers) Delete(ctx context.Context, offerID string, revision int64) error {
+	current, err := h.OfferRepository.Get(ctx, offerID)
+	if err != nil {
+		return err
+	}
+	if err := h.OfferRepository.Delete(ctx, offerID, revision); err != nil {
+		return err
+	}
+	if err := h.record(ctx, *current); err != nil {
+		return err
+	}
+	return h.insert(ctx, catalogv1alpha1.OfferRevision{
+		OfferID:  offerID,
+		Revision: current.Revision + 1,
+		Created:  time.Now().Unix(),
+		Offer:    *current,
+		Deleted:  true,
+	})
+}
+
+// continueHistory numbers an offer created with the ID of a deleted one after the tombstone of the latter,
+// so that its revisions are not mistaken for the old ones
+func (h *historyOffers) continueHistory(ctx context.Context, created *catalogv1alpha1.Offer) (*catalogv1alpha1.Offer, error) {
+	last, err := h.revisions.latest(ctx, created.OfferID)
+	if errors.Is(err, ErrNotFound) {
+		return created, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !last.Deleted {
+		return created, nil
+	}
+	renumbered := *created
+	renumbered.Revision = last.Revision + 1
+	if err := h.OfferRepository.Upsert(ctx, renumbered); err != nil {
+		return nil, err
+	}
+	return &renumbered, nil
+}
+
+func (h *historyOffers) record(ctx context.Context, offer catalogv1alpha1.Offer) error {
+	return h.insert(ctx, catalogv1alpha1.OfferRevision{
+		OfferID:  offer.OfferID,
+		Revision: offer.Revision,
+		Created:  time.Now().Unix(),
+		Offer:    offer,
+	})
+}
+
+func (h *historyOffers) insert(ctx context.Context, rev catalogv1alpha1.OfferRevision) error {
+	if err := h.revisions.insert(ctx, rev); err != nil {
+		return fmt.Errorf(`{"error":"recording revision %d of offer %s: %w"}`, rev.Revision, rev.OfferID, err)
+	}
+	return nil
+}
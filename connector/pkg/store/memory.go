@@ -0,0 +1,97 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NewMemoryStore returns a Store that keeps every document in memory.
+// Nothing survives a restart: it is meant for development and testing only.
+func NewMemoryStore() *Store {
+	return newDocumentStore(newMemoryCollection(), newMemoryCollection(), newMemoryCollection(), newMemoryCollection(),
+		newMemoryCollection(), newMemoryCollection(), newMemoryCollection(), newMemoryCollection())
+}
+
+// memoryCollection holds BSON-encoded documents in insertion order, so that callers
+// always get their own copy of a document, exactly as with a real database.
+type memoryCollection struct {
+	mu   sync.RWMutex
+	keys []string
+	docs map[string][]byte
+}
+
+func newMemoryCollection() *memoryCollection {
+	return &memoryCollection{docs: make(map[string][]byte)}
+}
+
+func (c *memoryCollection) put(key string, doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.docs[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.docs[key] = raw
+	return nil
+}
+
+func (c *memoryCollection) get(key string, out interface{}) error {
+	c.mu.RLock()
+	raw, ok := c.docs[key]
+	c.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+func (c *memoryCollection) delete(key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.docs[key]; !ok {
+		return false, nil
+	}
+	delete(c.docs, key)
+	for i, k := range c.keys {
+		if k == key {
+			c.keys = append(c.keys[:i], c.keys[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// each visits the documents in insertion order.
+func (c *memoryCollection) each(decode func(key string, raw []byte) error) error {
+	c.mu.RLock()
+	keys := append([]string(nil), c.keys...)
+	raws := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		raws = append(raws, c.docs[k])
+	}
+	c.mu.RUnlock()
+	for i, raw := range raws {
+		if err := decode(keys[i], raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
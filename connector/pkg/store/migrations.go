@@ -0,0 +1,370 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// SchemaVersion is the layout version stamped on every document written by the connector.
+// It must always match the Version of the last entry of migrations.
+const SchemaVersion = 8
+
+// Migration upgrades the documents of every collection to Version.
+type Migration struct {
+	Version     int
+	Description string
+	// Upgrade rewrites in place a single document of the given collection.
+	// It must be idempotent, since it can be run again on a document it already upgraded.
+	Upgrade func(collection string, doc bson.M) error
+}
+
+// MigrationRecord is stored in the migrations collection for every applied Migration.
+type MigrationRecord struct {
+	Version     int    `json:"version" bson:"version"`
+	Description string `json:"description" bson:"description"`
+	Applied     int64  `json:"applied" bson:"applied"`
+}
+
+// migrations is the ordered list of the schema upgrades. Never edit or remove an entry: append a new one.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "stamp schema-version on every document",
+		Upgrade:     func(string, bson.M) error { return nil },
+	},
+	{
+		Version:     2,
+		Description: "info: fill cluster-id and move legacy parameters to cluster-parameters",
+		Upgrade:     upgradeInfoClusterParameters,
+	},
+	{
+		Version:     3,
+		Description: "offers, contracts: start the revision counter at 1",
+		Upgrade:     upgradeRevision,
+	},
+	{
+		Version:     4,
+		Description: "offers, contracts: replace the boolean offer status with the lifecycle status",
+		Upgrade:     upgradeOfferStatus,
+	},
+	{
+		Version:     5,
+		Description: "offers: mark the plans without units left as sold out",
+		Upgrade:     upgradePlanSoldOut,
+	},
+	{
+		Version:     6,
+		Description: "offers, contracts: store the plan costs as decimals",
+		Upgrade:     upgradePlanCostDecimal,
+	},
+	{
+		Version:     7,
+		Description: "offers: store the search fields",
+		Upgrade:     upgradeOfferSearch,
+	},
+	{
+		Version:     8,
+		Description: "offers: mark the published offers without units left as sold out",
+		Upgrade:     upgradeOfferSoldOutStatus,
+	},
+}
+
+// migratedCollections are the collections whose documents carry a schema-version.
+var migratedCollections = []string{BROKER_COLLECTION, OFFER_COLLECTION, CONTRACT_COLLECTION, INFO_COLLECTION}
+
+// migrationBackend is implemented by every storage backend to let Migrate work on raw documents.
+type migrationBackend interface {
+	// prepare creates the indexes the repositories rely on.
+	prepare(ctx context.Context) error
+	// rewrite calls upgrade on every document of the collection, storing it back when upgrade returns true.
+	rewrite(ctx context.Context, collection string, upgrade func(doc bson.M) (bool, error)) error
+	applied(ctx context.Context) ([]MigrationRecord, error)
+	record(ctx context.Context, record MigrationRecord) error
+}
+
+// Migrate applies, in order, every migration not yet recorded in the migrations collection.
+// It fails if the stored data has been written by a newer version of the connector.
+func (s *Store) Migrate(ctx context.Context) error {
+	if err := s.migrations.prepare(ctx); err != nil {
+		return err
+	}
+	records, err := s.migrations.applied(ctx)
+	if err != nil {
+		return fmt.Errorf("reading applied migrations: %w", err)
+	}
+	current := 0
+	for _, r := range records {
+		if r.Version > current {
+			current = r.Version
+		}
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", current, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Printf("\tApplying migration %d: %s", m.Version, m.Description)
+		for _, collection := range migratedCollections {
+			err := s.migrations.rewrite(ctx, collection, func(doc bson.M) (bool, error) {
+				version := documentVersion(doc)
+				if version > SchemaVersion {
+					return false, fmt.Errorf("document schema version %d is newer than the supported version %d", version, SchemaVersion)
+				}
+				if version >= m.Version {
+					return false, nil
+				}
+				if err := m.Upgrade(collection, doc); err != nil {
+					return false, err
+				}
+				doc["schema-version"] = m.Version
+				return true, nil
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d on %s: %w", m.Version, collection, err)
+			}
+		}
+		record := MigrationRecord{Version: m.Version, Description: m.Description, Applied: time.Now().Unix()}
+		if err := s.migrations.record(ctx, record); err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// UpgradeDocument applies to a document of the collection, written with the given schema version,
+// the migrations released since then. doc points to the decoded document, e.g. read from a backup archive,
+// and is rewritten in place, so that it can be stored with the current SchemaVersion.
+func UpgradeDocument(collection string, version int, doc interface{}) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("document schema version %d is newer than the supported version %d", version, SchemaVersion)
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var m bson.M
+	if err := bson.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+	// decoded documents always carry a revision: 0 is never stored, so the revision was not tracked yet
+	if revision, ok := m["revision"].(int64); ok && revision == 0 {
+		delete(m, "revision")
+	}
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := migration.Upgrade(collection, m); err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+	}
+	if raw, err = bson.Marshal(m); err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, doc)
+}
+
+func documentVersion(doc bson.M) int {
+	switch v := doc["schema-version"].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// upgradeInfoClusterParameters fixes the info documents written before the layout was versioned:
+// cluster-id was only stored as _id, and old builds read the parameters from a "parameters" field.
+func upgradeInfoClusterParameters(collection string, doc bson.M) error {
+	if collection != INFO_COLLECTION {
+		return nil
+	}
+	if _, ok := doc["cluster-id"]; !ok {
+		if id, ok := doc["_id"].(string); ok {
+			doc["cluster-id"] = id
+		}
+	}
+	if legacy, ok := doc["parameters"]; ok {
+		if _, ok := doc["cluster-parameters"]; !ok {
+			doc["cluster-parameters"] = legacy
+		}
+		delete(doc, "parameters")
+	}
+	return nil
+}
+
+// upgradeRevision sets the initial revision of the offers and contracts written before revisions were tracked,
+// since revision 0 is reserved to the offers that do not exist yet.
+func upgradeRevision(collection string, doc bson.M) error {
+	if collection != OFFER_COLLECTION && collection != CONTRACT_COLLECTION {
+		return nil
+	}
+	if _, ok := doc["revision"]; !ok {
+		doc["revision"] = int64(1)
+	}
+	return nil
+}
+
+// upgradeOfferStatus maps the old boolean status of the offers, also embedded in the contracts,
+// to the lifecycle status: enabled offers are published, disabled ones go back to draft.
+func upgradeOfferStatus(collection string, doc bson.M) error {
+	offer := doc
+	switch collection {
+	case OFFER_COLLECTION:
+	case CONTRACT_COLLECTION:
+		embedded, ok := doc["offer"].(bson.M)
+		if !ok {
+			return nil
+		}
+		offer = embedded
+	default:
+		return nil
+	}
+	switch status := offer["status"].(type) {
+	case bool:
+		if status {
+			offer["status"] = "published"
+		} else {
+			offer["status"] = "draft"
+		}
+	case nil:
+		offer["status"] = "draft"
+	}
+	return nil
+}
+
+// upgradePlanSoldOut sets the sold-out flag of the plans, which is otherwise only updated when an offer is written.
+func upgradePlanSoldOut(collection string, doc bson.M) error {
+	if collection != OFFER_COLLECTION {
+		return nil
+	}
+	plans, ok := doc["plans"].(bson.A)
+	if !ok {
+		return nil
+	}
+	for _, p := range plans {
+		plan, ok := p.(bson.M)
+		if !ok {
+			continue
+		}
+		switch quantity := plan["plan-quantity"].(type) {
+		case int32:
+			plan["sold-out"] = quantity <= 0
+		case int64:
+			plan["sold-out"] = quantity <= 0
+		default:
+			plan["sold-out"] = true
+		}
+	}
+	return nil
+}
+
+// upgradeOfferSoldOutStatus sets the sold-out flag of the plans and the status of the offers accordingly,
+// since migration 5 left published offers without units left published.
+func upgradeOfferSoldOutStatus(collection string, doc bson.M) error {
+	if collection != OFFER_COLLECTION {
+		return nil
+	}
+	plans, ok := doc["plans"].(bson.A)
+	if !ok {
+		return nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var offer catalogv1alpha1.Offer
+	if err := bson.Unmarshal(raw, &offer); err != nil {
+		return fmt.Errorf("decoding offer %v: %w", doc["offer-id"], err)
+	}
+	offer.UpdateSoldOut()
+	for i, p := range plans {
+		if plan, ok := p.(bson.M); ok && i < len(offer.Plans) {
+			plan["sold-out"] = offer.Plans[i].SoldOut
+		}
+	}
+	doc["status"] = string(offer.Status)
+	return nil
+}
+
+// upgradePlanCostDecimal rewrites the plan costs stored as doubles as Decimal128, reading them as their shortest
+// decimal representation. The documents not upgraded yet are still readable, since amounts also decode doubles.
+func upgradePlanCostDecimal(collection string, doc bson.M) error {
+	offer := doc
+	switch collection {
+	case OFFER_COLLECTION:
+	case CONTRACT_COLLECTION:
+		embedded, ok := doc["offer"].(bson.M)
+		if !ok {
+			return nil
+		}
+		offer = embedded
+	default:
+		return nil
+	}
+	plans, ok := offer["plans"].(bson.A)
+	if !ok {
+		return nil
+	}
+	for _, p := range plans {
+		plan, ok := p.(bson.M)
+		if !ok {
+			continue
+		}
+		cost, ok := plan["plan-cost"].(float64)
+		if !ok {
+			continue
+		}
+		decimal, err := primitive.ParseDecimal128(strconv.FormatFloat(cost, 'f', -1, 64))
+		if err != nil {
+			return fmt.Errorf("plan %v: converting cost %v: %w", plan["plan-id"], cost, err)
+		}
+		plan["plan-cost"] = decimal
+	}
+	return nil
+}
+
+// upgradeOfferSearch stores the fields the offers are searched on, which are otherwise only updated when an offer is written.
+func upgradeOfferSearch(collection string, doc bson.M) error {
+	if collection != OFFER_COLLECTION {
+		return nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var offer catalogv1alpha1.Offer
+	if err := bson.Unmarshal(raw, &offer); err != nil {
+		return fmt.Errorf("decoding offer %v: %w", doc["offer-id"], err)
+	}
+	doc["search"] = offerSearch(&offer)
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+)
+
+func TestUpgradeDocument(t *testing.T) {
+	archived := func() catalogv1alpha1.Offer {
+		return catalogv1alpha1.Offer{
+			OfferID: "o1",
+			Status:  catalogv1alpha1.OfferPublished,
+			Plans: []catalogv1alpha1.Plan{
+				{PlanID: "p1", PlanCost: catalogv1alpha1.MustParseAmount("9.99"), PlanCostPeriod: "month", PlanQuantity: 0},
+			},
+		}
+	}
+	tests := []struct {
+		name         string
+		version      int
+		revision     int64
+		wantRevision int64
+		wantSoldOut  bool
+		wantErr      bool
+	}{
+		{name: "before revisions", version: 2, wantRevision: 1, wantSoldOut: true},
+		{name: "before sold out", version: 4, revision: 3, wantRevision: 3, wantSoldOut: true},
+		{name: "current", version: SchemaVersion, revision: 3, wantRevision: 3},
+		{name: "newer", version: SchemaVersion + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer := archived()
+			offer.Revision = tt.revision
+			err := UpgradeDocument(OFFER_COLLECTION, tt.version, &offer)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("UpgradeDocument() did not fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpgradeDocument() error = %v", err)
+			}
+			if offer.Revision != tt.wantRevision {
+				t.Errorf("revision = %d, want %d", offer.Revision, tt.wantRevision)
+			}
+			if offer.Plans[0].SoldOut != tt.wantSoldOut {
+				t.Errorf("sold out = %t, want %t", offer.Plans[0].SoldOut, tt.wantSoldOut)
+			}
+			if tt.wantSoldOut && offer.Status != catalogv1alpha1.OfferSoldOut {
+				t.Errorf("status = %s, want %s", offer.Status, catalogv1alpha1.OfferSoldOut)
+			}
+			if offer.Plans[0].PlanCost.String() != "9.99" || offer.OfferID != "o1" {
+				t.Errorf("the offer has been altered: %+v", offer)
+			}
+		})
+	}
+}
+
+func TestUpgradeContract(t *testing.T) {
+	contract := contractsv1alpha1.ContractDocument{ContractID: "c1", Enabled: true, Offer: catalogv1alpha1.Offer{OfferID: "o1"}}
+	if err := UpgradeDocument(CONTRACT_COLLECTION, 2, &contract); err != nil {
+		t.Fatal(err)
+	}
+	if contract.Revision != 1 || !contract.Enabled || contract.Offer.OfferID != "o1" {
+		t.Errorf("upgraded contract = %+v", contract)
+	}
+}
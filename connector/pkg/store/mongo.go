@@ -0,0 +1,797 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+)
+
+// NewMongoStore returns a Store backed by the collections of the given MongoDB database.
+func NewMongoStore(mDatabase *mongo.Database) *Store {
+	revisions := &mongoOfferRevisions{c: mDatabase.Collection(OFFER_REVISION_COLLECTION)}
+	return &Store{
+		Brokers:        &mongoBrokers{c: mDatabase.Collection(BROKER_COLLECTION)},
+		Offers:         &historyOffers{OfferRepository: &mongoOffers{c: mDatabase.Collection(OFFER_COLLECTION)}, revisions: revisions},
+		OfferRevisions: revisions,
+		SyncOutbox:     &mongoSyncOutbox{c: mDatabase.Collection(SYNC_OUTBOX_COLLECTION)},
+		SyncStatus:     &mongoSyncStatus{c: mDatabase.Collection(SYNC_STATUS_COLLECTION)},
+		Contracts:      &mongoContracts{c: mDatabase.Collection(CONTRACT_COLLECTION)},
+		Info:           &mongoInfo{c: mDatabase.Collection(INFO_COLLECTION)},
+
+		migrations: &mongoMigrations{db: mDatabase},
+		close:      mDatabase.Client().Disconnect,
+	}
+}
+
+// mongoError maps mongo.ErrNoDocuments to ErrNotFound, leaving every other error untouched.
+func mongoError(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// mongoEach decodes the documents of c selected by filter one at a time with decode, until it returns an error.
+func mongoEach(ctx context.Context, c *mongo.Collection, filter bson.D, decode func(cursor *mongo.Cursor) error) error {
+	cursor, err := c.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err := decode(cursor); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	return nil
+}
+
+type mongoBrokers struct {
+	c *mongo.Collection
+}
+
+func (b *mongoBrokers) List(ctx context.Context) ([]brokerv1alpha1.BrokerDocument, error) {
+	cursor, err := b.c.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	var brokers []brokerv1alpha1.BrokerDocument
+	if err = cursor.All(ctx, &brokers); err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	return brokers, nil
+}
+
+func (b *mongoBrokers) Each(ctx context.Context, fn func(broker brokerv1alpha1.BrokerDocument) error) error {
+	return mongoEach(ctx, b.c, bson.D{}, func(cursor *mongo.Cursor) error {
+		var broker brokerv1alpha1.BrokerDocument
+		if err := cursor.Decode(&broker); err != nil {
+			return fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+		}
+		return fn(broker)
+	})
+}
+
+func (b *mongoBrokers) Get(ctx context.Context, id string) (*brokerv1alpha1.BrokerDocument, error) {
+	var broker brokerv1alpha1.BrokerDocument
+	err := b.c.FindOne(ctx, bson.D{{Key: "id", Value: id}}).Decode(&broker)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, mongoError(err))
+	}
+	return &broker, nil
+}
+
+func (b *mongoBrokers) GetByPath(ctx context.Context, path string) (*brokerv1alpha1.BrokerDocument, error) {
+	var broker brokerv1alpha1.BrokerDocument
+	err := b.c.FindOne(ctx, bson.D{{Key: "path", Value: path}}).Decode(&broker)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, mongoError(err))
+	}
+	return &broker, nil
+}
+
+func (b *mongoBrokers) Upsert(ctx context.Context, broker brokerv1alpha1.BrokerDocument) error {
+	broker.SchemaVersion = SchemaVersion
+	filter := bson.D{{Key: "id", Value: broker.ID}}
+	update := bson.D{{Key: "$set", Value: broker}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := b.c.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
+	}
+	return nil
+}
+
+// TODO: REVIEW
+func (b *mongoBrokers) SetEnabled(ctx context.Context, id string, enabled bool) error {
+	filter := bson.D{{Key: "id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "enabled", Value: enabled}, {Key: "schema-version", Value: SchemaVersion}}}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := b.c.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	return nil
+}
+
+func (b *mongoBrokers) SetToken(ctx context.Context, id, token string, expiry int64) error {
+	filter := bson.D{{Key: "id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "jwt-token", Value: token}, {Key: "token-expiry", Value: expiry}}}}
+	res, err := b.c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf(`{"error":"updating broker %s: %w"}`, id, ErrNotFound)
+	}
+	return nil
+}
+
+func (b *mongoBrokers) ReplaceToken(ctx context.Context, id, current, token string) error {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "jwt-token", Value: current}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "jwt-token", Value: token}}}}
+	res, err := b.c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	if _, err := b.Get(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf(`{"error":"the token of broker %s has changed: %w"}`, id, ErrConflict)
+}
+
+func (b *mongoBrokers) Delete(ctx context.Context, id string) error {
+	if _, err := b.c.DeleteOne(ctx, bson.D{{Key: "id", Value: id}}); err != nil {
+		return fmt.Errorf(`{"error":"deleting from database: %s"}`, err)
+	}
+	return nil
+}
+
+type mongoOffers struct {
+	c *mongo.Collection
+}
+
+func (o *mongoOffers) List(ctx context.Context) ([]catalogv1alpha1.Offer, error) {
+	cursor, err := o.c.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading offers from database: %s"}`, err)
+	}
+	var offers []catalogv1alpha1.Offer
+	if err = cursor.All(ctx, &offers); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding offers: %s"}`, err)
+	}
+	return offers, nil
+}
+
+func (o *mongoOffers) Each(ctx context.Context, fn func(offer catalogv1alpha1.Offer) error) error {
+	return mongoEach(ctx, o.c, bson.D{}, func(cursor *mongo.Cursor) error {
+		var offer catalogv1alpha1.Offer
+		if err := cursor.Decode(&offer); err != nil {
+			return fmt.Errorf(`{"error":"Decoding offers: %s"}`, err)
+		}
+		return fn(offer)
+	})
+}
+
+func (o *mongoOffers) Find(ctx context.Context, query OfferQuery) (*OfferPage, error) {
+	cursor, err := query.check()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := offerFilter(&query, cursor)
+	if err != nil {
+		return nil, err
+	}
+	sortKey := "created"
+	if query.sortField() == SortByCost {
+		sortKey = "search.cost"
+	}
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: sortKey, Value: direction}, {Key: "offer-id", Value: direction}})
+	if query.Limit > 0 {
+		// one more offer tells whether there is a next page
+		opts.SetLimit(int64(query.Limit) + 1)
+	}
+	found, err := o.c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading offers from database: %s"}`, err)
+	}
+	page := &OfferPage{}
+	if err = found.All(ctx, &page.Offers); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding offers: %s"}`, err)
+	}
+	if query.Limit > 0 && len(page.Offers) > query.Limit {
+		page.Offers = page.Offers[:query.Limit]
+		page.Next = query.cursorAfter(&page.Offers[query.Limit-1])
+	}
+	return page, nil
+}
+
+// offerFilter translates the query into a MongoDB filter, which is served by the indexes created in prepare.
+// The resource filters and the cost range must hold for the same plan, hence the $elemMatch on the search plans.
+func offerFilter(query *OfferQuery, cursor *offerCursor) (bson.D, error) {
+	filter := bson.D{}
+	if query.Type != "" {
+		filter = append(filter, bson.E{Key: "offer-type", Value: query.Type})
+	}
+	if len(query.Statuses) > 0 {
+		filter = append(filter, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: query.Statuses}}})
+	}
+	if query.Name != "" {
+		filter = append(filter, bson.E{Key: "offer-name", Value: primitive.Regex{Pattern: regexp.QuoteMeta(query.Name), Options: "i"}})
+	}
+
+	plan := bson.D{}
+	cost := bson.D{}
+	if query.MinCost != nil {
+		cost = append(cost, bson.E{Key: "$gte", Value: *query.MinCost})
+	}
+	if query.MaxCost != nil {
+		cost = append(cost, bson.E{Key: "$lte", Value: *query.MaxCost})
+	}
+	if len(cost) > 0 {
+		plan = append(plan, bson.E{Key: "cost", Value: cost})
+	}
+	// the filters on the same resource must hold for the same entry
+	var names []string
+	bounds := make(map[string]bson.D)
+	for _, f := range query.Resources {
+		if _, ok := bounds[f.Resource]; !ok {
+			names = append(names, f.Resource)
+		}
+		bounds[f.Resource] = append(bounds[f.Resource], bson.E{Key: mongoOps[f.Op], Value: f.Milli})
+	}
+	if len(names) > 0 {
+		all := bson.A{}
+		for _, name := range names {
+			all = append(all, bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "name", Value: name}, {Key: "milli", Value: bounds[name]}}}})
+		}
+		plan = append(plan, bson.E{Key: "resources", Value: bson.D{{Key: "$all", Value: all}}})
+	}
+	if len(plan) > 0 {
+		filter = append(filter, bson.E{Key: "search.plans", Value: bson.D{{Key: "$elemMatch", Value: plan}}})
+	}
+
+	if cursor != nil {
+		key := "created"
+		var value interface{}
+		if cursor.Sort == SortByCost {
+			key = "search.cost"
+			cost, err := primitive.ParseDecimal128(cursor.Value)
+			if err != nil {
+				return nil, fmt.Errorf(`{"error":"malformed cursor: %w"}`, ErrInvalidQuery)
+			}
+			value = cost
+		} else {
+			created, err := strconv.ParseInt(cursor.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf(`{"error":"malformed cursor: %w"}`, ErrInvalidQuery)
+			}
+			value = created
+		}
+		op := "$gt"
+		if cursor.Descending {
+			op = "$lt"
+		}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: key, Value: bson.D{{Key: op, Value: value}}}},
+			bson.D{{Key: key, Value: value}, {Key: "offer-id", Value: bson.D{{Key: op, Value: cursor.OfferID}}}},
+		}})
+	}
+	return filter, nil
+}
+
+// mongoOps are the MongoDB operators of the ResourceFilter operators
+var mongoOps = map[string]string{">=": "$gte", "<=": "$lte", ">": "$gt", "<": "$lt", "=": "$eq"}
+
+func (o *mongoOffers) Get(ctx context.Context, offerID string) (*catalogv1alpha1.Offer, error) {
+	filter := bson.D{{Key: "offer-id", Value: offerID}}
+	var offer catalogv1alpha1.Offer
+	if err := o.c.FindOne(ctx, filter).Decode(&offer); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding offer %s: %w"}`, offerID, mongoError(err))
+	}
+	return &offer, nil
+}
+
+func (o *mongoOffers) Upsert(ctx context.Context, offer catalogv1alpha1.Offer) error {
+	// upsert: https://www.mongodb.com/docs/drivers/go/current/fundamentals/crud/write-operations/upsert/
+	offer.SchemaVersion = SchemaVersion
+	offer.Search = offerSearch(&offer)
+	filter := bson.D{{Key: "offer-id", Value: offer.OfferID}}
+	update := bson.D{{Key: "$set", Value: offer}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := o.c.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf(`{"error":"saving offer to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (o *mongoOffers) Save(ctx context.Context, offer catalogv1alpha1.Offer, revision int64) (*catalogv1alpha1.Offer, error) {
+	if revision == AnyRevision {
+		// retry until no other write happens between the read of the revision and the update
+		for {
+			current, err := o.Get(ctx, offer.OfferID)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				revision = 0
+			case err != nil:
+				return nil, err
+			default:
+				revision = current.Revision
+			}
+			saved, err := o.Save(ctx, offer, revision)
+			if !errors.Is(err, ErrConflict) {
+				return saved, err
+			}
+		}
+	}
+
+	offer.SchemaVersion = SchemaVersion
+	offer.Search = offerSearch(&offer)
+	offer.Revision = revision + 1
+	if revision == 0 {
+		// the unique index on offer-id makes concurrent inserts fail
+		filter := bson.D{{Key: "offer-id", Value: offer.OfferID}}
+		update := bson.D{{Key: "$setOnInsert", Value: offer}}
+		result, err := o.c.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) || (err == nil && result.UpsertedCount == 0) {
+			return nil, fmt.Errorf(`{"error":"offer %s already exists: %w"}`, offer.OfferID, ErrConflict)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`{"error":"saving offer to database: %s"}`, err)
+		}
+		return &offer, nil
+	}
+
+	filter := bson.D{{Key: "offer-id", Value: offer.OfferID}, {Key: "revision", Value: revision}}
+	result, err := o.c.ReplaceOne(ctx, filter, offer)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"saving offer to database: %s"}`, err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, o.mismatch(ctx, offer.OfferID, revision)
+	}
+	return &offer, nil
+}
+
+func (o *mongoOffers) Delete(ctx context.Context, offerID string, revision int64) error {
+	filter := bson.D{{Key: "offer-id", Value: offerID}}
+	if revision != AnyRevision {
+		filter = append(filter, bson.E{Key: "revision", Value: revision})
+	}
+	result, err := o.c.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf(`{"error":"deleting from database: %s"}`, err.Error())
+	}
+	if result.DeletedCount == 0 {
+		return o.mismatch(ctx, offerID, revision)
+	}
+	return nil
+}
+
+// mismatch explains why a conditional write on offerID matched no document
+func (o *mongoOffers) mismatch(ctx context.Context, offerID string, revision int64) error {
+	current, err := o.Get(ctx, offerID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf(`{"error":"no such offer %s on database: %w"}`, offerID, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf(`{"error":"offer %s is at revision %d, not %d: %w"}`, offerID, current.Revision, revision, ErrConflict)
+}
+
+type mongoOfferRevisions struct {
+	c *mongo.Collection
+}
+
+func (r *mongoOfferRevisions) List(ctx context.Context, offerID string) ([]catalogv1alpha1.OfferRevision, error) {
+	filter := bson.D{{Key: "offer-id", Value: offerID}}
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: 1}})
+	cursor, err := r.c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading revisions of offer %s from database: %s"}`, offerID, err)
+	}
+	var revisions []catalogv1alpha1.OfferRevision
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding revisions of offer %s: %s"}`, offerID, err)
+	}
+	return revisions, nil
+}
+
+func (r *mongoOfferRevisions) Get(ctx context.Context, offerID string, revision int64) (*catalogv1alpha1.OfferRevision, error) {
+	filter := bson.D{{Key: "offer-id", Value: offerID}, {Key: "revision", Value: revision}}
+	var rev catalogv1alpha1.OfferRevision
+	if err := r.c.FindOne(ctx, filter).Decode(&rev); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding revision %d of offer %s: %w"}`, revision, offerID, mongoError(err))
+	}
+	return &rev, nil
+}
+
+func (r *mongoOfferRevisions) insert(ctx context.Context, rev catalogv1alpha1.OfferRevision) error {
+	// the unique index on offer-id and revision keeps the first copy of every revision
+	if _, err := r.c.InsertOne(ctx, rev); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf(`{"error":"saving revision %d of offer %s to database: %s"}`, rev.Revision, rev.OfferID, err)
+	}
+	return nil
+}
+
+func (r *mongoOfferRevisions) latest(ctx context.Context, offerID string) (*catalogv1alpha1.OfferRevision, error) {
+	filter := bson.D{{Key: "offer-id", Value: offerID}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+	var rev catalogv1alpha1.OfferRevision
+	if err := r.c.FindOne(ctx, filter, opts).Decode(&rev); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding revisions of offer %s: %w"}`, offerID, mongoError(err))
+	}
+	return &rev, nil
+}
+
+type mongoSyncOutbox struct {
+	c *mongo.Collection
+}
+
+func (o *mongoSyncOutbox) List(ctx context.Context) ([]syncv1alpha1.OutboxEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "next-attempt", Value: 1}})
+	cursor, err := o.c.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading sync outbox from database: %s"}`, err)
+	}
+	var entries []syncv1alpha1.OutboxEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding sync outbox: %s"}`, err)
+	}
+	return entries, nil
+}
+
+func (o *mongoSyncOutbox) Enqueue(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	filter := bson.D{{Key: "id", Value: entry.ID}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "broker-id", Value: entry.BrokerID},
+			{Key: "offer-id", Value: entry.OfferID},
+			{Key: "operation", Value: entry.Operation},
+			{Key: "sequence", Value: entry.Sequence},
+			{Key: "next-attempt", Value: entry.NextAttempt},
+		}},
+		// a replaced entry keeps its attempts, so that its backoff goes on
+		{Key: "$setOnInsert", Value: bson.D{
+			{Key: "created", Value: entry.Created},
+			{Key: "attempts", Value: entry.Attempts},
+		}},
+	}
+	if _, err := o.c.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf(`{"error":"saving sync outbox entry %s to database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *mongoSyncOutbox) Complete(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	filter := bson.D{{Key: "id", Value: entry.ID}, {Key: "sequence", Value: entry.Sequence}}
+	if _, err := o.c.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync outbox entry %s from database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *mongoSyncOutbox) Retry(ctx context.Context, entry syncv1alpha1.OutboxEntry) error {
+	filter := bson.D{{Key: "id", Value: entry.ID}, {Key: "sequence", Value: entry.Sequence}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "operation", Value: entry.Operation},
+		{Key: "attempts", Value: entry.Attempts},
+		{Key: "next-attempt", Value: entry.NextAttempt},
+		{Key: "last-error", Value: entry.LastError},
+	}}}
+	if _, err := o.c.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf(`{"error":"saving sync outbox entry %s to database: %s"}`, entry.ID, err)
+	}
+	return nil
+}
+
+func (o *mongoSyncOutbox) DeleteBroker(ctx context.Context, brokerID string) error {
+	if _, err := o.c.DeleteMany(ctx, bson.D{{Key: "broker-id", Value: brokerID}}); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync outbox of broker %s from database: %s"}`, brokerID, err)
+	}
+	return nil
+}
+
+type mongoSyncStatus struct {
+	c *mongo.Collection
+}
+
+func (s *mongoSyncStatus) List(ctx context.Context) ([]syncv1alpha1.SyncStatus, error) {
+	return s.find(ctx, bson.D{})
+}
+
+func (s *mongoSyncStatus) ListByOffer(ctx context.Context, offerID string) ([]syncv1alpha1.SyncStatus, error) {
+	return s.find(ctx, bson.D{{Key: "offer-id", Value: offerID}})
+}
+
+func (s *mongoSyncStatus) Save(ctx context.Context, status syncv1alpha1.SyncStatus) error {
+	filter := bson.D{{Key: "id", Value: status.ID}}
+	if _, err := s.c.ReplaceOne(ctx, filter, status, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf(`{"error":"saving sync status %s to database: %s"}`, status.ID, err)
+	}
+	return nil
+}
+
+func (s *mongoSyncStatus) Delete(ctx context.Context, id string) error {
+	if _, err := s.c.DeleteOne(ctx, bson.D{{Key: "id", Value: id}}); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync status %s from database: %s"}`, id, err)
+	}
+	return nil
+}
+
+func (s *mongoSyncStatus) DeleteBroker(ctx context.Context, brokerID string) error {
+	if _, err := s.c.DeleteMany(ctx, bson.D{{Key: "broker-id", Value: brokerID}}); err != nil {
+		return fmt.Errorf(`{"error":"deleting sync status of broker %s from database: %s"}`, brokerID, err)
+	}
+	return nil
+}
+
+func (s *mongoSyncStatus) find(ctx context.Context, filter bson.D) ([]syncv1alpha1.SyncStatus, error) {
+	cursor, err := s.c.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading sync status from database: %s"}`, err)
+	}
+	var statuses []syncv1alpha1.SyncStatus
+	if err = cursor.All(ctx, &statuses); err != nil {
+		return nil, fmt.Errorf(`{"error":"Decoding sync status: %s"}`, err)
+	}
+	return statuses, nil
+}
+
+type mongoContracts struct {
+	c *mongo.Collection
+}
+
+func (c *mongoContracts) List(ctx context.Context) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.find(ctx, bson.D{})
+}
+
+func (c *mongoContracts) Each(ctx context.Context, fn func(contract contractsv1alpha1.ContractDocument) error) error {
+	return mongoEach(ctx, c.c, bson.D{}, func(cursor *mongo.Cursor) error {
+		var contract contractsv1alpha1.ContractDocument
+		if err := cursor.Decode(&contract); err != nil {
+			return fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
+		}
+		return fn(contract)
+	})
+}
+
+func (c *mongoContracts) ListByBuyerID(ctx context.Context, buyerID string) ([]contractsv1alpha1.ContractDocument, error) {
+	return c.find(ctx, bson.D{{Key: "buyer-cluster-id", Value: buyerID}})
+}
+
+func (c *mongoContracts) Get(ctx context.Context, contractID string) (*contractsv1alpha1.ContractDocument, error) {
+	filter := bson.D{{Key: "contract-id", Value: contractID}}
+	var contract contractsv1alpha1.ContractDocument
+	if err := c.c.FindOne(ctx, filter).Decode(&contract); err != nil {
+		return nil, fmt.Errorf(`{"error":"reading contract %s from database: %w"}`, contractID, mongoError(err))
+	}
+	return &contract, nil
+}
+
+func (c *mongoContracts) find(ctx context.Context, filter bson.D) ([]contractsv1alpha1.ContractDocument, error) {
+	cursor, err := c.c.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %s"}`, err)
+	}
+	var contracts []contractsv1alpha1.ContractDocument
+	if err = cursor.All(ctx, &contracts); err != nil {
+		return nil, fmt.Errorf(`{"error":"parsing from database: %s"}`, err)
+	}
+	return contracts, nil
+}
+
+func (c *mongoContracts) Insert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	contract.SchemaVersion = SchemaVersion
+	contract.Revision = 1
+	if _, err := c.c.InsertOne(ctx, contract); err != nil {
+		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (c *mongoContracts) Upsert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error {
+	contract.SchemaVersion = SchemaVersion
+	filter := bson.D{{Key: "contract-id", Value: contract.ContractID}}
+	update := bson.D{{Key: "$set", Value: contract}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := c.c.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf(`{"error":"saving to database: %s"}`, err)
+	}
+	return nil
+}
+
+// sellerTokenField is the path of the seller token, stored in the embedded cluster parameters of the seller
+const sellerTokenField = "seller.clusterparameters.token"
+
+func (c *mongoContracts) ReplaceSellerToken(ctx context.Context, contractID, current, token string) error {
+	filter := bson.D{{Key: "contract-id", Value: contractID}, {Key: sellerTokenField, Value: current}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: sellerTokenField, Value: token}}}}
+	res, err := c.c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf(`{"error":"updating database: %s"}`, err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	if _, err := c.Get(ctx, contractID); err != nil {
+		return err
+	}
+	return fmt.Errorf(`{"error":"the token of contract %s has changed: %w"}`, contractID, ErrConflict)
+}
+
+type mongoInfo struct {
+	c *mongo.Collection
+}
+
+func (i *mongoInfo) Get(ctx context.Context) (*connectorv1alpha1.ConnectorInfo, error) {
+	var ci connectorv1alpha1.ConnectorInfo
+	if err := i.c.FindOne(ctx, bson.D{}).Decode(&ci); err != nil {
+		return nil, fmt.Errorf(`{"error":"reading from database: %w"}`, mongoError(err))
+	}
+	return &ci, nil
+}
+
+func (i *mongoInfo) SetClusterParameters(ctx context.Context, parameters *connectorv1alpha1.ClusterParameters) error {
+	if err := i.set(ctx, parameters.ClusterID, "cluster-parameters", parameters); err != nil {
+		return fmt.Errorf(`{"error":"saving Cluster Parameters to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *mongoInfo) SetPrettyName(ctx context.Context, clusterID, prettyName string) error {
+	if err := i.set(ctx, clusterID, "prettyname", prettyName); err != nil {
+		return fmt.Errorf(`{"error":"saving Cluster Pretty Name to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *mongoInfo) SetContractEndpoint(ctx context.Context, clusterID, endpoint string) error {
+	if err := i.set(ctx, clusterID, "contract-endpoint", endpoint); err != nil {
+		return fmt.Errorf(`{"error":"saving Contract Endpoint to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *mongoInfo) SetReady(ctx context.Context, clusterID string) error {
+	if err := i.set(ctx, clusterID, "ready", true); err != nil {
+		return fmt.Errorf(`{"error":"saving Ready Catalog to database: %s"}`, err)
+	}
+	return nil
+}
+
+func (i *mongoInfo) set(ctx context.Context, clusterID, key string, value interface{}) error {
+	filter := bson.D{{Key: "_id", Value: clusterID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: key, Value: value},
+		{Key: "cluster-id", Value: clusterID},
+		{Key: "schema-version", Value: SchemaVersion},
+	}}}
+	opts := options.Update().SetUpsert(true)
+	_, err := i.c.UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+type mongoMigrations struct {
+	db *mongo.Database
+}
+
+func (m *mongoMigrations) prepare(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "offer-id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := m.db.Collection(OFFER_COLLECTION).Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("creating offer-id index: %w", err)
+	}
+	index = mongo.IndexModel{
+		Keys:    bson.D{{Key: "offer-id", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := m.db.Collection(OFFER_REVISION_COLLECTION).Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("creating offer revision index: %w", err)
+	}
+	index = mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := m.db.Collection(SYNC_OUTBOX_COLLECTION).Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("creating sync outbox index: %w", err)
+	}
+	if _, err := m.db.Collection(SYNC_STATUS_COLLECTION).Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("creating sync status index: %w", err)
+	}
+	// indexes of the offer search, see offerFilter
+	search := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "offer-type", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "created", Value: 1}, {Key: "offer-id", Value: 1}}},
+		{Keys: bson.D{{Key: "search.cost", Value: 1}, {Key: "offer-id", Value: 1}}},
+		{Keys: bson.D{{Key: "search.plans.cost", Value: 1}}},
+		{Keys: bson.D{{Key: "search.plans.resources.name", Value: 1}, {Key: "search.plans.resources.milli", Value: 1}}},
+	}
+	if _, err := m.db.Collection(OFFER_COLLECTION).Indexes().CreateMany(ctx, search); err != nil {
+		return fmt.Errorf("creating offer search indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *mongoMigrations) rewrite(ctx context.Context, collection string, upgrade func(doc bson.M) (bool, error)) error {
+	c := m.db.Collection(collection)
+	cursor, err := c.Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		changed, err := upgrade(doc)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if _, err := c.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc["_id"]}}, doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (m *mongoMigrations) applied(ctx context.Context) ([]MigrationRecord, error) {
+	cursor, err := m.db.Collection(MIGRATION_COLLECTION).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var records []MigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (m *mongoMigrations) record(ctx context.Context, record MigrationRecord) error {
+	filter := bson.D{{Key: "version", Value: record.Version}}
+	update := bson.D{{Key: "$set", Value: record}}
+	_, err := m.db.Collection(MIGRATION_COLLECTION).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
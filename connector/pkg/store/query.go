@@ -0,0 +1,293 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+// ErrInvalidQuery is returned (wrapped) by OfferRepository.Find when the query or its cursor cannot be used.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// OfferSort is the field the offers returned by OfferRepository.Find are sorted on.
+// Offers with the same value are sorted by offer-id.
+type OfferSort string
+
+const (
+	SortByCreated OfferSort = "created"
+	// SortByCost sorts the offers by the lowest monthly estimate of their plans.
+	SortByCost OfferSort = "cost"
+)
+
+// ResourceFilter matches the plans selling a quantity of Resource that compares to Milli
+// (in milli-units) with Op, one of >=, <=, >, < and =.
+type ResourceFilter struct {
+	Resource string
+	Op       string
+	Milli    int64
+}
+
+// OfferQuery selects a page of offers. Empty fields match every offer.
+// An offer matches the resource filters and the cost range if at least one of its plans matches all of them.
+type OfferQuery struct {
+	Type      string
+	Statuses  []catalogv1alpha1.OfferStatus
+	Name      string // case-insensitive substring of the offer name
+	Resources []ResourceFilter
+	// MinCost and MaxCost bound the monthly estimate of the plans.
+	MinCost, MaxCost *catalogv1alpha1.Amount
+
+	Sort       OfferSort // SortByCreated if empty
+	Descending bool
+	Limit      int    // every offer if 0
+	Cursor     string // returned as OfferPage.Next by the previous page
+}
+
+// OfferPage is a page of the offers selected by an OfferQuery.
+type OfferPage struct {
+	Offers []catalogv1alpha1.Offer
+	// Next is the cursor of the next page, empty if this is the last one.
+	Next string
+}
+
+// offerCursor is the position of the last offer of a page, encoded as an opaque string
+type offerCursor struct {
+	Sort       OfferSort `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	OfferID    string    `json:"id"`
+}
+
+func (q *OfferQuery) sortField() OfferSort {
+	if q.Sort == "" {
+		return SortByCreated
+	}
+	return q.Sort
+}
+
+// check validates the query and decodes its cursor, if any
+func (q *OfferQuery) check() (*offerCursor, error) {
+	switch q.sortField() {
+	case SortByCreated, SortByCost:
+	default:
+		return nil, fmt.Errorf(`{"error":"unknown sort %q: %w"}`, q.Sort, ErrInvalidQuery)
+	}
+	for _, f := range q.Resources {
+		if _, ok := resourceOps[f.Op]; !ok {
+			return nil, fmt.Errorf(`{"error":"unknown operator %q: %w"}`, f.Op, ErrInvalidQuery)
+		}
+	}
+	if q.Limit < 0 {
+		return nil, fmt.Errorf(`{"error":"negative limit: %w"}`, ErrInvalidQuery)
+	}
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	var cursor offerCursor
+	if err == nil {
+		err = json.Unmarshal(raw, &cursor)
+	}
+	if err != nil || cursor.Sort != q.sortField() || cursor.Descending != q.Descending {
+		return nil, fmt.Errorf(`{"error":"the cursor does not belong to this query: %w"}`, ErrInvalidQuery)
+	}
+	if _, ok := new(big.Rat).SetString(cursor.Value); !ok {
+		return nil, fmt.Errorf(`{"error":"malformed cursor: %w"}`, ErrInvalidQuery)
+	}
+	return &cursor, nil
+}
+
+// cursorAfter returns the cursor pointing after offer
+func (q *OfferQuery) cursorAfter(offer *catalogv1alpha1.Offer) string {
+	raw, _ := json.Marshal(offerCursor{
+		Sort:       q.sortField(),
+		Descending: q.Descending,
+		Value:      q.sortString(offer),
+		OfferID:    offer.OfferID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sortString returns the sort value of the offer as a decimal number
+func (q *OfferQuery) sortString(offer *catalogv1alpha1.Offer) string {
+	if q.sortField() == SortByCost {
+		if offer.Search == nil {
+			return "0"
+		}
+		return offer.Search.Cost.String()
+	}
+	return strconv.FormatInt(offer.Created, 10)
+}
+
+func (q *OfferQuery) sortValue(offer *catalogv1alpha1.Offer) *big.Rat {
+	if q.sortField() == SortByCost {
+		if offer.Search == nil {
+			return new(big.Rat)
+		}
+		return offer.Search.Cost.Rat()
+	}
+	return new(big.Rat).SetInt64(offer.Created)
+}
+
+// resourceOps compare a quantity with the one of a filter
+var resourceOps = map[string]func(int) bool{
+	">=": func(c int) bool { return c >= 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"=":  func(c int) bool { return c == 0 },
+}
+
+// matches is the in-memory equivalent of the MongoDB filter of the query
+func (q *OfferQuery) matches(offer *catalogv1alpha1.Offer) bool {
+	if q.Type != "" && offer.OfferType != q.Type {
+		return false
+	}
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, status := range q.Statuses {
+			found = found || offer.Status == status
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(offer.OfferName), strings.ToLower(q.Name)) {
+		return false
+	}
+	if len(q.Resources) == 0 && q.MinCost == nil && q.MaxCost == nil {
+		return true
+	}
+	if offer.Search == nil {
+		return false
+	}
+	for i := range offer.Search.Plans {
+		if q.matchesPlan(&offer.Search.Plans[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *OfferQuery) matchesPlan(plan *catalogv1alpha1.PlanSearch) bool {
+	if q.MinCost != nil && plan.Cost.Cmp(*q.MinCost) < 0 {
+		return false
+	}
+	if q.MaxCost != nil && plan.Cost.Cmp(*q.MaxCost) > 0 {
+		return false
+	}
+	for _, f := range q.Resources {
+		found := false
+		for _, r := range plan.Resources {
+			if r.Name == f.Resource && resourceOps[f.Op](compareInt64(r.Milli, f.Milli)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// page sorts the offers matching the query and returns the page after the cursor
+func (q *OfferQuery) page(offers []catalogv1alpha1.Offer, cursor *offerCursor) *OfferPage {
+	// before reports whether a comes before b in the order of the query
+	before := func(aValue *big.Rat, aID string, bValue *big.Rat, bID string) bool {
+		c := aValue.Cmp(bValue)
+		if c == 0 {
+			c = strings.Compare(aID, bID)
+		}
+		if q.Descending {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	var after *big.Rat
+	if cursor != nil {
+		after, _ = new(big.Rat).SetString(cursor.Value)
+	}
+	selected := make([]catalogv1alpha1.Offer, 0, len(offers))
+	for i := range offers {
+		if !q.matches(&offers[i]) {
+			continue
+		}
+		if cursor != nil && !before(after, cursor.OfferID, q.sortValue(&offers[i]), offers[i].OfferID) {
+			continue
+		}
+		selected = append(selected, offers[i])
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return before(q.sortValue(&selected[i]), selected[i].OfferID, q.sortValue(&selected[j]), selected[j].OfferID)
+	})
+
+	page := &OfferPage{Offers: selected}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		page.Offers = selected[:q.Limit]
+		page.Next = q.cursorAfter(&page.Offers[q.Limit-1])
+	}
+	return page
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// offerSearch computes the search fields of the offer. Plans that cannot be priced cost 0,
+// and quantities that cannot be parsed are left out.
+func offerSearch(offer *catalogv1alpha1.Offer) *catalogv1alpha1.OfferSearch {
+	search := &catalogv1alpha1.OfferSearch{Plans: make([]catalogv1alpha1.PlanSearch, 0, len(offer.Plans))}
+	for i := range offer.Plans {
+		plan := &offer.Plans[i]
+		cost, _ := plan.MonthlyRecurring()
+		planSearch := catalogv1alpha1.PlanSearch{Cost: cost}
+		names := make([]string, 0, len(plan.PlanResources))
+		for name := range plan.PlanResources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			quantity, err := resource.ParseQuantity(plan.PlanResources[name])
+			if err != nil {
+				continue
+			}
+			planSearch.Resources = append(planSearch.Resources, catalogv1alpha1.ResourceSearch{Name: name, Milli: quantity.MilliValue()})
+		}
+		if i == 0 || cost.Cmp(search.Cost) < 0 {
+			search.Cost = cost
+		}
+		search.Plans = append(search.Plans, planSearch)
+	}
+	return search
+}
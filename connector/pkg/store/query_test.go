@@ -0,0 +1,173 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+func TestOfferQueryCheck(t *testing.T) {
+	cursor := (&OfferQuery{Sort: SortByCost, Descending: true}).cursorAfter(&catalogv1alpha1.Offer{OfferID: "o1"})
+	malformed := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"created","d":false,"v":"x","id":"o1"}`))
+	tests := []struct {
+		name    string
+		query   OfferQuery
+		wantErr bool
+	}{
+		{name: "empty", query: OfferQuery{}},
+		{name: "sort by cost", query: OfferQuery{Sort: SortByCost, Limit: 10}},
+		{name: "resource filter", query: OfferQuery{Resources: []ResourceFilter{{Resource: "cpu", Op: ">=", Milli: 1000}}}},
+		{name: "cursor of the same query", query: OfferQuery{Sort: SortByCost, Descending: true, Cursor: cursor}},
+		{name: "unknown sort", query: OfferQuery{Sort: "name"}, wantErr: true},
+		{name: "unknown operator", query: OfferQuery{Resources: []ResourceFilter{{Resource: "cpu", Op: "!="}}}, wantErr: true},
+		{name: "negative limit", query: OfferQuery{Limit: -1}, wantErr: true},
+		{name: "cursor of another sort", query: OfferQuery{Sort: SortByCreated, Descending: true, Cursor: cursor}, wantErr: true},
+		{name: "cursor of another order", query: OfferQuery{Sort: SortByCost, Cursor: cursor}, wantErr: true},
+		{name: "cursor not base64", query: OfferQuery{Cursor: "%%%"}, wantErr: true},
+		{name: "cursor not json", query: OfferQuery{Cursor: base64.RawURLEncoding.EncodeToString([]byte("nope"))}, wantErr: true},
+		{name: "cursor without a number", query: OfferQuery{Cursor: malformed}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.query.check()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("check() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("check() error = %v", err)
+			}
+		})
+	}
+}
+
+// testOffer returns an offer with one plan per resource list, each costing the given monthly amount
+func testOffer(id string, created int64, costs []string, resources []map[string]string) catalogv1alpha1.Offer {
+	offer := catalogv1alpha1.Offer{OfferID: id, OfferName: "Offer " + id, OfferType: "compute", Created: created, Status: catalogv1alpha1.OfferPublished}
+	for i, cost := range costs {
+		offer.Plans = append(offer.Plans, catalogv1alpha1.Plan{
+			PlanID:         id + "-plan",
+			PlanCost:       catalogv1alpha1.MustParseAmount(cost),
+			PlanCostPeriod: "month",
+			PlanResources:  resources[i],
+		})
+	}
+	offer.Search = offerSearch(&offer)
+	return offer
+}
+
+func offerIDs(offers []catalogv1alpha1.Offer) []string {
+	ids := make([]string, 0, len(offers))
+	for i := range offers {
+		ids = append(ids, offers[i].OfferID)
+	}
+	return ids
+}
+
+func TestOfferQueryPage(t *testing.T) {
+	small := map[string]string{"cpu": "2", "memory": "4Gi"}
+	large := map[string]string{"cpu": "8", "memory": "32Gi"}
+	offers := []catalogv1alpha1.Offer{
+		testOffer("c", 300, []string{"40"}, []map[string]string{large}),
+		testOffer("a", 100, []string{"10", "50"}, []map[string]string{small, large}),
+		testOffer("b", 200, []string{"10"}, []map[string]string{small}),
+		testOffer("d", 300, []string{"20.50"}, []map[string]string{small}),
+	}
+	offers[3].Status = catalogv1alpha1.OfferDraft
+	min, max := catalogv1alpha1.MustParseAmount("15"), catalogv1alpha1.MustParseAmount("45")
+
+	tests := []struct {
+		name  string
+		query OfferQuery
+		pages [][]string
+	}{
+		{name: "created", query: OfferQuery{}, pages: [][]string{{"a", "b", "c", "d"}}},
+		{name: "created descending", query: OfferQuery{Descending: true}, pages: [][]string{{"d", "c", "b", "a"}}},
+		{name: "cost with offer-id tie-break", query: OfferQuery{Sort: SortByCost}, pages: [][]string{{"a", "b", "d", "c"}}},
+		{name: "paged", query: OfferQuery{Limit: 3}, pages: [][]string{{"a", "b", "c"}, {"d"}}},
+		{name: "paged on ties", query: OfferQuery{Sort: SortByCost, Limit: 1}, pages: [][]string{{"a"}, {"b"}, {"d"}, {"c"}}},
+		{name: "paged descending", query: OfferQuery{Descending: true, Limit: 2}, pages: [][]string{{"d", "c"}, {"b", "a"}}},
+		{name: "status", query: OfferQuery{Statuses: []catalogv1alpha1.OfferStatus{catalogv1alpha1.OfferDraft}}, pages: [][]string{{"d"}}},
+		{name: "name", query: OfferQuery{Name: "OFFER B"}, pages: [][]string{{"b"}}},
+		{name: "type", query: OfferQuery{Type: "storage"}, pages: [][]string{{}}},
+		{
+			name:  "resources",
+			query: OfferQuery{Resources: []ResourceFilter{{Resource: "cpu", Op: ">=", Milli: 4000}, {Resource: "memory", Op: ">", Milli: 16 << 30 * 1000}}},
+			pages: [][]string{{"a", "c"}},
+		},
+		{name: "resource equal", query: OfferQuery{Resources: []ResourceFilter{{Resource: "cpu", Op: "=", Milli: 2000}}}, pages: [][]string{{"a", "b", "d"}}},
+		{name: "price range", query: OfferQuery{MinCost: &min, MaxCost: &max}, pages: [][]string{{"c", "d"}}},
+		{
+			// a matches the cost and the resources, but with different plans
+			name:  "price and resources on the same plan",
+			query: OfferQuery{MaxCost: &min, Resources: []ResourceFilter{{Resource: "cpu", Op: ">", Milli: 2000}}},
+			pages: [][]string{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			for i, want := range tt.pages {
+				cursor, err := query.check()
+				if err != nil {
+					t.Fatalf("page %d: check() error = %v", i, err)
+				}
+				page := query.page(offers, cursor)
+				if got := offerIDs(page.Offers); !reflect.DeepEqual(got, want) {
+					t.Fatalf("page %d = %v, want %v", i, got, want)
+				}
+				last := i == len(tt.pages)-1
+				if last != (page.Next == "") {
+					t.Fatalf("page %d: next cursor = %q", i, page.Next)
+				}
+				query.Cursor = page.Next
+			}
+		})
+	}
+}
+
+func TestOfferSearch(t *testing.T) {
+	offer := catalogv1alpha1.Offer{Plans: []catalogv1alpha1.Plan{
+		{PlanCost: catalogv1alpha1.MustParseAmount("30"), PlanCostPeriod: "month", PlanResources: map[string]string{"memory": "1Gi", "cpu": "500m"}},
+		{PlanCost: catalogv1alpha1.MustParseAmount("12.5"), PlanCostPeriod: "month", PlanResources: map[string]string{"cpu": "lots"}},
+	}}
+	got := offerSearch(&offer)
+	want := &catalogv1alpha1.OfferSearch{
+		Cost: catalogv1alpha1.MustParseAmount("12.5"),
+		Plans: []catalogv1alpha1.PlanSearch{
+			{Cost: catalogv1alpha1.MustParseAmount("30"), Resources: []catalogv1alpha1.ResourceSearch{{Name: "cpu", Milli: 500}, {Name: "memory", Milli: 1 << 30 * 1000}}},
+			{Cost: catalogv1alpha1.MustParseAmount("12.5")},
+		},
+	}
+	if got.Cost.Cmp(want.Cost) != 0 || len(got.Plans) != len(want.Plans) {
+		t.Fatalf("offerSearch() = %+v, want %+v", got, want)
+	}
+	for i := range want.Plans {
+		if got.Plans[i].Cost.Cmp(want.Plans[i].Cost) != 0 || !sameResources(got.Plans[i].Resources, want.Plans[i].Resources) {
+			t.Errorf("plan %d = %+v, want %+v", i, got.Plans[i], want.Plans[i])
+		}
+	}
+}
+
+func sameResources(a, b []catalogv1alpha1.ResourceSearch) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
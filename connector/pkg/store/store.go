@@ -0,0 +1,163 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+
+	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+	connectorv1alpha1 "connector/apis/connector/v1alpha1"
+	contractsv1alpha1 "connector/apis/contracts/v1alpha1"
+	syncv1alpha1 "connector/apis/sync/v1alpha1"
+)
+
+const (
+	BROKER_COLLECTION    = "brokers"
+	OFFER_COLLECTION     = "offers"
+	CONTRACT_COLLECTION  = "contracts"
+	INFO_COLLECTION      = "info"
+	MIGRATION_COLLECTION = "migrations"
+
+	OFFER_REVISION_COLLECTION = "offer-revisions"
+	SYNC_OUTBOX_COLLECTION    = "sync-outbox"
+	SYNC_STATUS_COLLECTION    = "sync-status"
+)
+
+// AnyRevision disables the revision check of the conditional writes.
+const AnyRevision int64 = -1
+
+var (
+	// ErrNotFound is returned (wrapped) by every repository when the requested document does not exist.
+	ErrNotFound = errors.New("document not found")
+	// ErrConflict is returned (wrapped) by the conditional writes when the stored revision is not the expected one.
+	ErrConflict = errors.New("revision conflict")
+)
+
+// BrokerRepository persists the brokers the connector is registered to.
+type BrokerRepository interface {
+	List(ctx context.Context) ([]brokerv1alpha1.BrokerDocument, error)
+	// Each calls fn on every broker, reading them one at a time, until fn returns an error.
+	Each(ctx context.Context, fn func(broker brokerv1alpha1.BrokerDocument) error) error
+	Get(ctx context.Context, id string) (*brokerv1alpha1.BrokerDocument, error)
+	GetByPath(ctx context.Context, path string) (*brokerv1alpha1.BrokerDocument, error)
+	Upsert(ctx context.Context, broker brokerv1alpha1.BrokerDocument) error
+	SetEnabled(ctx context.Context, id string, enabled bool) error
+	// SetToken stores a new token issued by the broker and its expiry. It fails with ErrNotFound if the broker does not exist.
+	SetToken(ctx context.Context, id, token string, expiry int64) error
+	// ReplaceToken stores token in place of current, keeping the expiry. It fails with ErrConflict if the stored token
+	// is not current anymore, e.g. because it has been renewed meanwhile, and with ErrNotFound if the broker does not exist.
+	ReplaceToken(ctx context.Context, id, current, token string) error
+	Delete(ctx context.Context, id string) error
+}
+
+// OfferRepository persists the offers published by the local cluster.
+type OfferRepository interface {
+	List(ctx context.Context) ([]catalogv1alpha1.Offer, error)
+	// Each calls fn on every offer, reading them one at a time, until fn returns an error.
+	Each(ctx context.Context, fn func(offer catalogv1alpha1.Offer) error) error
+	// Find returns the page of the offers selected by the query. It fails with ErrInvalidQuery if the query cannot be used.
+	Find(ctx context.Context, query OfferQuery) (*OfferPage, error)
+	Get(ctx context.Context, offerID string) (*catalogv1alpha1.Offer, error)
+	// Upsert stores the offer as it is, revision included.
+	Upsert(ctx context.Context, offer catalogv1alpha1.Offer) error
+	// Save stores the offer only if the stored one has the given revision (0 if the offer must not exist yet),
+	// and returns it with the incremented revision. It fails with ErrConflict or ErrNotFound otherwise.
+	Save(ctx context.Context, offer catalogv1alpha1.Offer, revision int64) (*catalogv1alpha1.Offer, error)
+	// Delete removes the offer only if the stored one has the given revision, unless it is AnyRevision.
+	Delete(ctx context.Context, offerID string, revision int64) error
+}
+
+// OfferRevisionRepository reads the immutable history of the offers, which is written by the OfferRepository
+// every time an offer is saved. The history of a deleted offer is kept, closed by a tombstone revision.
+type OfferRevisionRepository interface {
+	// List returns the revisions of the offer in ascending order.
+	List(ctx context.Context, offerID string) ([]catalogv1alpha1.OfferRevision, error)
+	Get(ctx context.Context, offerID string, revision int64) (*catalogv1alpha1.OfferRevision, error)
+}
+
+// SyncOutboxRepository persists the changes of the offers waiting to be delivered to the brokers,
+// so that they are retried until they succeed, across restarts too.
+type SyncOutboxRepository interface {
+	// List returns every pending entry, the first to be attempted first.
+	List(ctx context.Context) ([]syncv1alpha1.OutboxEntry, error)
+	// Enqueue stores the entry, replacing the pending entry of the same offer and broker but keeping its attempts.
+	Enqueue(ctx context.Context, entry syncv1alpha1.OutboxEntry) error
+	// Complete removes the delivered entry, unless it has been replaced since it was read.
+	Complete(ctx context.Context, entry syncv1alpha1.OutboxEntry) error
+	// Retry stores the outcome of a failed attempt, unless the entry has been replaced since it was read.
+	Retry(ctx context.Context, entry syncv1alpha1.OutboxEntry) error
+	// DeleteBroker removes the entries of the broker.
+	DeleteBroker(ctx context.Context, brokerID string) error
+}
+
+// SyncStatusRepository persists the outcome of the last delivery of every offer to every broker.
+type SyncStatusRepository interface {
+	List(ctx context.Context) ([]syncv1alpha1.SyncStatus, error)
+	ListByOffer(ctx context.Context, offerID string) ([]syncv1alpha1.SyncStatus, error)
+	// Save stores the status, replacing the one of the same offer and broker.
+	Save(ctx context.Context, status syncv1alpha1.SyncStatus) error
+	Delete(ctx context.Context, id string) error
+	// DeleteBroker removes the statuses of the broker.
+	DeleteBroker(ctx context.Context, brokerID string) error
+}
+
+// ContractRepository persists the contracts stipulated by the local cluster, both as buyer and as seller.
+type ContractRepository interface {
+	List(ctx context.Context) ([]contractsv1alpha1.ContractDocument, error)
+	// Each calls fn on every contract, reading them one at a time, until fn returns an error.
+	Each(ctx context.Context, fn func(contract contractsv1alpha1.ContractDocument) error) error
+	ListByBuyerID(ctx context.Context, buyerID string) ([]contractsv1alpha1.ContractDocument, error)
+	Get(ctx context.Context, contractID string) (*contractsv1alpha1.ContractDocument, error)
+	// Insert stores a new contract with revision 1.
+	Insert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error
+	// Upsert stores the contract as it is, revision included.
+	Upsert(ctx context.Context, contract *contractsv1alpha1.ContractDocument) error
+	// ReplaceSellerToken stores token in place of the current seller token, leaving the rest of the contract as it is.
+	// It fails with ErrConflict if the stored token is not current anymore, and with ErrNotFound if the contract does not exist.
+	ReplaceSellerToken(ctx context.Context, contractID, current, token string) error
+}
+
+// InfoRepository persists the configuration of the connector instance, keyed by the local cluster ID.
+type InfoRepository interface {
+	Get(ctx context.Context) (*connectorv1alpha1.ConnectorInfo, error)
+	SetClusterParameters(ctx context.Context, parameters *connectorv1alpha1.ClusterParameters) error
+	SetPrettyName(ctx context.Context, clusterID, prettyName string) error
+	SetContractEndpoint(ctx context.Context, clusterID, endpoint string) error
+	SetReady(ctx context.Context, clusterID string) error
+}
+
+// Store groups the repositories of every aggregate handled by the connector.
+type Store struct {
+	Brokers        BrokerRepository
+	Offers         OfferRepository
+	OfferRevisions OfferRevisionRepository
+	SyncOutbox     SyncOutboxRepository
+	SyncStatus     SyncStatusRepository
+	Contracts      ContractRepository
+	Info           InfoRepository
+
+	migrations migrationBackend
+	close      func(ctx context.Context) error
+}
+
+// Close releases the resources held by the underlying backend.
+func (s *Store) Close(ctx context.Context) error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close(ctx)
+}
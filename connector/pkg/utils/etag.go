@@ -0,0 +1,59 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AnyETag is the If-Match value matching any current revision.
+const AnyETag = "*"
+
+// ETag formats a document revision as a strong entity tag.
+func ETag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// ListETag returns a weak entity tag that changes whenever a document of a list is added, removed or updated.
+// Each key must identify both the document and its revision.
+func ListETag(keys []string) string {
+	h := fnv.New64a()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// IfMatch parses the If-Match header of req. ok is false if the header is missing.
+// tag is AnyETag, or the revision previously returned by ETag.
+func IfMatch(req *http.Request) (tag string, revision int64, ok bool, err error) {
+	tag = strings.TrimSpace(req.Header.Get("If-Match"))
+	if tag == "" {
+		return "", 0, false, nil
+	}
+	if tag == AnyETag {
+		return tag, 0, true, nil
+	}
+	revision, err = strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+	if err != nil || revision <= 0 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return "", 0, true, fmt.Errorf(`{"error":"invalid If-Match header %s"}`, tag)
+	}
+	return tag, revision, true, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation checks the documents received through the API before they are stored.
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+var (
+	// KnownResources are the resource names a plan can sell.
+	KnownResources = map[string]bool{
+		"cpu":               true,
+		"memory":            true,
+		"storage":           true,
+		"ephemeral-storage": true,
+		"gpu":               true,
+		"nvidia.com/gpu":    true,
+		"pods":              true,
+	}
+	// KnownCurrencies are the ISO 4217 codes accepted for the plan cost.
+	KnownCurrencies = map[string]bool{
+		"USD": true,
+		"EUR": true,
+		"GBP": true,
+	}
+	// KnownPeriods are the billing periods accepted for the plan cost.
+	KnownPeriods = map[string]bool{
+		"minute": true,
+		"hour":   true,
+		"day":    true,
+		"week":   true,
+		"month":  true,
+		"year":   true,
+	}
+)
+
+// FieldError describes why the value of a field is not valid. Field is the JSON path of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every invalid field of a document.
+type Errors []FieldError
+
+// Error returns the errors as a JSON object, like the other errors returned by the API.
+func (e Errors) Error() string {
+	body, err := json.Marshal(struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{Error: "validation failed", Fields: e})
+	if err != nil {
+		return fmt.Sprintf(`{"error":"validation failed: %d invalid fields"}`, len(e))
+	}
+	return string(body)
+}
+
+func (e *Errors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateOffer checks the offer and all its plans. It returns nil if the offer is valid.
+func ValidateOffer(offer *catalogv1alpha1.Offer) error {
+	var errs Errors
+	if strings.TrimSpace(offer.OfferID) == "" {
+		errs.add("offerID", "required")
+	}
+
+	if offer.ValidFrom < 0 {
+		errs.add("validFrom", "must be a unix time")
+	}
+	if offer.ValidUntil < 0 {
+		errs.add("validUntil", "must be a unix time")
+	} else if offer.ValidUntil != 0 && offer.ValidUntil <= offer.ValidFrom {
+		errs.add("validUntil", "must be after validFrom")
+	}
+
+	targets := make(map[string]int)
+	for i, id := range offer.Brokers {
+		path := fmt.Sprintf("brokers[%d]", i)
+		if strings.TrimSpace(id) == "" {
+			errs.add(path, "required")
+		} else if prev, ok := targets[id]; ok {
+			errs.add(path, "duplicate of brokers[%d] %q", prev, id)
+		} else {
+			targets[id] = i
+		}
+	}
+
+	seen := make(map[string]int)
+	for i := range offer.Plans {
+		path := fmt.Sprintf("plans[%d]", i)
+		plan := &offer.Plans[i]
+		if prev, ok := seen[plan.PlanID]; ok && plan.PlanID != "" {
+			errs.add(path+".planID", "duplicate of plans[%d].planID %q", prev, plan.PlanID)
+		} else {
+			seen[plan.PlanID] = i
+		}
+		errs = append(errs, validatePlan(path, plan)...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validatePlan checks the plan at path (e.g. plans[0]) of an offer
+func validatePlan(path string, plan *catalogv1alpha1.Plan) Errors {
+	var errs Errors
+	field := func(name string) string { return path + "." + name }
+
+	if strings.TrimSpace(plan.PlanID) == "" {
+		errs.add(field("planID"), "required")
+	}
+	if plan.PlanCost.Sign() < 0 {
+		errs.add(field("planCost"), "must be a non-negative number, got %s", plan.PlanCost)
+	}
+	if !KnownCurrencies[plan.PlanCostCurrency] {
+		errs.add(field("planCostCurrency"), "unknown currency %q, expected one of %s", plan.PlanCostCurrency, keys(KnownCurrencies))
+	}
+	if !KnownPeriods[plan.PlanCostPeriod] {
+		errs.add(field("planCostPeriod"), "unknown period %q, expected one of %s", plan.PlanCostPeriod, keys(KnownPeriods))
+	}
+	if plan.PlanQuantity < 0 {
+		errs.add(field("planQuantity"), "must be non-negative, got %d", plan.PlanQuantity)
+	}
+
+	// sorted, so that the errors always come back in the same order
+	names := make([]string, 0, len(plan.PlanResources))
+	for name := range plan.PlanResources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := plan.PlanResources[name]
+		if !KnownResources[name] {
+			errs.add(field("resources."+name), "unknown resource, expected one of %s", keys(KnownResources))
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			errs.add(field("resources."+name), "invalid quantity %q: %s", value, err)
+			continue
+		}
+		if quantity.Sign() < 0 {
+			errs.add(field("resources."+name), "must be non-negative, got %s", value)
+		}
+	}
+
+	if plan.Pricing != nil {
+		errs = append(errs, validatePricing(field("pricing"), plan)...)
+	}
+	return errs
+}
+
+// validatePricing checks the pricing model at path (e.g. plans[0].pricing) of a plan
+func validatePricing(path string, plan *catalogv1alpha1.Plan) Errors {
+	var errs Errors
+	pricing := plan.Pricing
+	field := func(name string) string { return path + "." + name }
+
+	if pricing.SetupFee.Sign() < 0 {
+		errs.add(field("setupFee"), "must be a non-negative number, got %s", pricing.SetupFee)
+	}
+
+	switch plan.Model() {
+	case catalogv1alpha1.PricingFlat:
+		return errs
+	case catalogv1alpha1.PricingPerUnit:
+		if pricing.UnitPrice.Sign() < 0 {
+			errs.add(field("unitPrice"), "must be a non-negative number, got %s", pricing.UnitPrice)
+		}
+	case catalogv1alpha1.PricingTiered:
+		if len(pricing.Tiers) == 0 {
+			errs.add(field("tiers"), "required by the tiered model")
+		}
+		var last int64
+		for i, tier := range pricing.Tiers {
+			tierPath := fmt.Sprintf("%s[%d]", field("tiers"), i)
+			if tier.UnitPrice.Sign() < 0 {
+				errs.add(tierPath+".unitPrice", "must be a non-negative number, got %s", tier.UnitPrice)
+			}
+			switch {
+			case i == len(pricing.Tiers)-1 && tier.UpTo != 0:
+				errs.add(tierPath+".upTo", "must be omitted: the last tier has no upper bound")
+			case i < len(pricing.Tiers)-1 && tier.UpTo <= last:
+				errs.add(tierPath+".upTo", "must be greater than %d, got %d", last, tier.UpTo)
+			}
+			last = tier.UpTo
+		}
+	default:
+		errs.add(field("model"), "unknown pricing model %q, expected one of %s, %s, %s", pricing.Model,
+			catalogv1alpha1.PricingFlat, catalogv1alpha1.PricingPerUnit, catalogv1alpha1.PricingTiered)
+		return errs
+	}
+
+	if _, ok := plan.PlanResources[pricing.Resource]; !ok {
+		errs.add(field("resource"), "must be one of the resources of the plan, got %q", pricing.Resource)
+	}
+	if pricing.Unit != "" {
+		unit, err := resource.ParseQuantity(pricing.Unit)
+		if err != nil {
+			errs.add(field("unit"), "invalid quantity %q: %s", pricing.Unit, err)
+		} else if unit.Sign() <= 0 {
+			errs.add(field("unit"), "must be positive, got %s", pricing.Unit)
+		}
+	}
+	return errs
+}
+
+func keys(set map[string]bool) string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
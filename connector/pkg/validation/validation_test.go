@@ -0,0 +1,185 @@
+// Copyright 2022-2023 Alessandro Cannarella
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	catalogv1alpha1 "connector/apis/catalog/v1alpha1"
+)
+
+func validOffer() *catalogv1alpha1.Offer {
+	return &catalogv1alpha1.Offer{
+		OfferID:   "offer-1",
+		OfferName: "Small",
+		Plans: []catalogv1alpha1.Plan{
+			{
+				PlanID:           "plan-1",
+				PlanCost:         catalogv1alpha1.MustParseAmount("10.50"),
+				PlanCostCurrency: "EUR",
+				PlanCostPeriod:   "month",
+				PlanQuantity:     3,
+				PlanResources:    map[string]string{"cpu": "2", "memory": "4Gi"},
+			},
+		},
+	}
+}
+
+func tiered(tiers ...int64) *catalogv1alpha1.Pricing {
+	pricing := &catalogv1alpha1.Pricing{Model: catalogv1alpha1.PricingTiered, Resource: "cpu"}
+	for _, upTo := range tiers {
+		pricing.Tiers = append(pricing.Tiers, catalogv1alpha1.PriceTier{UpTo: upTo, UnitPrice: catalogv1alpha1.MustParseAmount("1")})
+	}
+	return pricing
+}
+
+func TestValidateOffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(o *catalogv1alpha1.Offer)
+		fields []string // invalid fields, in order
+	}{
+		{name: "valid", mutate: func(o *catalogv1alpha1.Offer) {}},
+		{name: "missing offer ID", mutate: func(o *catalogv1alpha1.Offer) { o.OfferID = " " }, fields: []string{"offerID"}},
+		{name: "missing plan ID", mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].PlanID = "" }, fields: []string{"plans[0].planID"}},
+		{
+			name: "duplicate plan IDs",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.Plans = append(o.Plans, o.Plans[0], o.Plans[0])
+			},
+			fields: []string{"plans[1].planID", "plans[2].planID"},
+		},
+		{
+			name:   "unknown resource",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].PlanResources["bananas"] = "1" },
+			fields: []string{"plans[0].resources.bananas"},
+		},
+		{
+			name: "bad quantities",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.Plans[0].PlanResources["cpu"] = "two"
+				o.Plans[0].PlanResources["memory"] = "-1Gi"
+			},
+			fields: []string{"plans[0].resources.cpu", "plans[0].resources.memory"},
+		},
+		{
+			name: "negative cost and quantity",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.Plans[0].PlanCost = catalogv1alpha1.MustParseAmount("-1")
+				o.Plans[0].PlanQuantity = -1
+			},
+			fields: []string{"plans[0].planCost", "plans[0].planQuantity"},
+		},
+		{
+			name: "unknown currency and period",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.Plans[0].PlanCostCurrency = "XYZ"
+				o.Plans[0].PlanCostPeriod = "fortnight"
+			},
+			fields: []string{"plans[0].planCostCurrency", "plans[0].planCostPeriod"},
+		},
+		{
+			name: "validity window",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.ValidFrom = 200
+				o.ValidUntil = 100
+			},
+			fields: []string{"validUntil"},
+		},
+		{
+			name:   "duplicate broker",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Brokers = []string{"b1", "b1", ""} },
+			fields: []string{"brokers[1]", "brokers[2]"},
+		},
+		{name: "tiers in order", mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].Pricing = tiered(4, 8, 0) }},
+		{
+			name:   "tiers out of order",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].Pricing = tiered(8, 4, 0) },
+			fields: []string{"plans[0].pricing.tiers[1].upTo"},
+		},
+		{
+			name:   "bounded last tier",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].Pricing = tiered(4, 8) },
+			fields: []string{"plans[0].pricing.tiers[1].upTo"},
+		},
+		{
+			name:   "no tiers",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].Pricing = tiered() },
+			fields: []string{"plans[0].pricing.tiers"},
+		},
+		{
+			name: "per-unit pricing",
+			mutate: func(o *catalogv1alpha1.Offer) {
+				o.Plans[0].Pricing = &catalogv1alpha1.Pricing{
+					Model:     catalogv1alpha1.PricingPerUnit,
+					Resource:  "gpu",
+					Unit:      "0",
+					UnitPrice: catalogv1alpha1.MustParseAmount("-2"),
+					SetupFee:  catalogv1alpha1.MustParseAmount("-5"),
+				}
+			},
+			fields: []string{"plans[0].pricing.setupFee", "plans[0].pricing.unitPrice", "plans[0].pricing.resource", "plans[0].pricing.unit"},
+		},
+		{
+			name:   "unknown pricing model",
+			mutate: func(o *catalogv1alpha1.Offer) { o.Plans[0].Pricing = &catalogv1alpha1.Pricing{Model: "auction"} },
+			fields: []string{"plans[0].pricing.model"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer := validOffer()
+			tt.mutate(offer)
+			err := ValidateOffer(offer)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateOffer() = %v, want nil", err)
+				}
+				return
+			}
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("ValidateOffer() = %v, want validation errors", err)
+			}
+			fields := make([]string, 0, len(errs))
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestErrorsJSON(t *testing.T) {
+	errs := Errors{
+		{Field: "offerID", Message: "required"},
+		{Field: "plans[0].planCost", Message: `must be a non-negative number, got "-1"`},
+	}
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(errs.Error()), &body); err != nil {
+		t.Fatalf("Error() = %s is not JSON: %v", errs.Error(), err)
+	}
+	if body.Error != "validation failed" || !reflect.DeepEqual(body.Fields, []FieldError(errs)) {
+		t.Errorf("Error() = %s", errs.Error())
+	}
+}
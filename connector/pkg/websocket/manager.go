@@ -15,7 +15,9 @@
 package ws
 
 import (
-	//"context"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -25,53 +27,86 @@ import (
 	"github.com/gorilla/websocket"
 
 	brokerv1alpha1 "connector/apis/broker/v1alpha1"
+	"connector/pkg/store"
 )
 
+// maxBackoff is the longest wait, in seconds, between two attempts to subscribe to a broker.
+const maxBackoff = 300
+
 func (wh *WebsocketHandler) SubscribeToBroker(document brokerv1alpha1.BrokerDocument) {
 	backoff := 1
 	for {
 		time.Sleep(time.Duration(backoff) * time.Second)
-		err, conn := subscribeToBroker(document)
 
-		broker := &Broker{
-			ID:         document.ID,
-			Conn:       conn,
-			PoolClient: wh.PoolClient,
-			PoolBroker: wh.PoolBroker,
-			enabled:    true,
+		// Read the broker again, to pick up a renewed token and to stop once it is unregistered or disabled
+		current, err := wh.brokerHandler.GetBroker(document.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf("Broker %s has been removed, no longer subscribing to it", document.ID)
+			return
+		} else if err != nil {
+			log.Printf("Failed to read broker %s: %s", document.ID, err)
+		} else {
+			if !current.Enabled {
+				log.Printf("Broker %s has been disabled, no longer subscribing to it", document.ID)
+				return
+			}
+			document = *current
+		}
+
+		tlsConfig, err := wh.brokerHandler.BrokerTLSConfig(&document)
+		var conn *websocket.Conn
+		if err == nil {
+			err, conn = subscribeToBroker(document, tlsConfig)
+		}
+		if errors.Is(err, brokerv1alpha1.ErrUnauthorized) {
+			log.Printf("Broker %s rejected the token, authenticating again", document.ID)
+			if _, refreshErr := wh.brokerHandler.RefreshToken(context.Background(), document.ID, document.JWTToken); refreshErr != nil {
+				err = refreshErr
+			}
+			// the new token is tried after the backoff too, so that a broker that keeps rejecting
+			// the renewed tokens is not authenticated again in a tight loop
 		}
 		if err != nil {
 			log.Println(err)
+			// The broker is kept: it is retried until it is reachable again, or until it is unregistered
 			backoff = backoff * 2
-			if backoff > 300 {
-				// Broker is not reachable, remove it from DB
-				// TODO: another solution could be to disable the broker in the DB
-				wh.brokerHandler.RemoveBrokerFromDB(document.ID)
-				// Remove broker from ws pool
-				wh.PoolBroker.Unregister <- broker
-				log.Printf("Impossible to reconnect to broker %s, removing it from DB", document.Name)
-				// It is not possible to clear the offers of the broker, because the broker is not reachable.
-				// Needed to implement an automatic logic on the broker side to clear the offers of an unconnected cluster
-				return
+			if backoff > maxBackoff {
+				backoff = maxBackoff
 			}
 			continue
 		}
+		// only a connection that succeeds resets the backoff
 		backoff = 1
 
+		broker := &Broker{
+			ID:         document.ID,
+			Conn:       conn,
+			PoolClient: wh.PoolClient,
+			PoolBroker: wh.PoolBroker,
+			enabled:    true,
+		}
 		wh.PoolBroker.Register <- broker
-		// Push all the local offers to the broker
-		wh.offersHandler.SelectiveSyncOffers(document.ID)
+		// Send the broker only the offers it is not up to date with, or every offer if its catalog cannot be read
+		if err := wh.offersHandler.ReconcileOffers(document.ID); err != nil {
+			log.Printf("Failed to reconcile broker %s, pushing every offer: %s", document.ID, err)
+			wh.offersHandler.SelectiveSyncOffers(document.ID)
+		}
 		broker.Read()
 	}
 }
 
-func subscribeToBroker(broker brokerv1alpha1.BrokerDocument) (error, *websocket.Conn) {
+func subscribeToBroker(broker brokerv1alpha1.BrokerDocument, tlsConfig *tls.Config) (error, *websocket.Conn) {
 	header := make(http.Header)
 	header["Cookie"] = []string{"jwt-token=" + broker.JWTToken}
 	brokerPath := strings.ToLower(broker.Path[:5]) + broker.Path[5:]      // lowercase protocol
 	wsPath := strings.Replace(brokerPath, "http", "ws", 1) + "/subscribe" // note that this takes care of wss too
-	conn, _, err := websocket.DefaultDialer.Dial(wsPath, header)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+	conn, resp, err := dialer.Dial(wsPath, header)
 	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("could not subscribe to broker %s: %w", broker.ID, brokerv1alpha1.ErrUnauthorized), nil
+		}
 		return fmt.Errorf("could not subscribe to broker: %w", err), nil
 	}
 	return nil, conn